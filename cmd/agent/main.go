@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
-	"github.com/andrei-cloud/go-devops/internal/agent"
-	"github.com/andrei-cloud/go-devops/internal/collector"
+	"github.com/andrei-cloud/go-devops/pkg/agent"
+	"github.com/andrei-cloud/go-devops/pkg/config"
 )
 
 var (
@@ -19,9 +22,27 @@ var (
 )
 
 func main() {
+	cfg := config.AgentConfig{}
+	loader := config.NewLoader(flag.CommandLine, &cfg)
+	flag.Parse()
+	if err := loader.Load(&cfg); err != nil {
+		log.Fatal().AnErr("Load", err).Msg("invalid configuration")
+	}
+	if loader.PrintConfig() {
+		if err := config.Print(os.Stdout, &cfg); err != nil {
+			log.Fatal().AnErr("Print", err).Msg("main")
+		}
+		return
+	}
+
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
-	collector := collector.NewCollector()
-	a := agent.NewAgent(collector, nil)
+	zerolog.SetGlobalLevel(cfg.Level())
+	log.Debug().Msg("DEBUG LEVEL IS ENABLED")
+
+	a, err := agent.New(agent.WithConfig(cfg), agent.WithBuild(buildVersion, buildCommit))
+	if err != nil {
+		log.Fatal().AnErr("New", err).Msg("failed to create agent")
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
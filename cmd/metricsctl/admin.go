@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+)
+
+// adminDo sends admin request req of action signed with admin key over the configured transport.
+func (c *ctl) adminDo(ctx context.Context, action string, req admin.Request) (admin.Result, error) {
+	var res admin.Result
+	if c.cfg.AdminKey == "" {
+		return res, errors.New("admin key is required: -admin-key or ADMIN_KEY")
+	}
+	req = req.Signed(action, []byte(c.cfg.AdminKey), time.Now())
+
+	if !c.cfg.Grpc {
+		err := c.do(ctx, http.MethodPost, "/admin/"+action, nil, req, &res)
+		return res, err
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+
+	cl := pb.NewAdminClient(conn)
+	call := map[string]func(context.Context, *pb.AdminRequest, ...grpc.CallOption) (*pb.AdminResponse, error){
+		admin.ActionDelete: cl.Delete,
+		admin.ActionReset:  cl.ResetCounter,
+		admin.ActionRename: cl.Rename,
+	}[action]
+	resp, err := call(ctx, rpc.AdminRequestToProto(req))
+	if err != nil {
+		return res, err
+	}
+	for _, m := range resp.Metrics {
+		res.Metrics = append(res.Metrics, admin.Series{Type: m.Type, ID: m.Id})
+	}
+	return res, nil
+}
+
+// seriesTable returns table of metrics affected by admin action.
+func seriesTable(res admin.Result) table {
+	t := table{header: []string{"TYPE", "ID"}, v: res}
+	for _, m := range res.Metrics {
+		t.rows = append(t.rows, []string{m.Type, m.ID})
+	}
+	return t
+}
+
+// deleteMetrics deletes push group, single metric or metrics matching glob or regex.
+func deleteMetrics(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	const usage = "-group job[/instance] | <gauge|counter> <name> | [-type t] [-dry-run] -glob pattern | -regex expr"
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	group := fs.String("group", "", "push group to delete: job or job/instance")
+	glob := fs.String("glob", "", "glob pattern of metric IDs to delete")
+	regex := fs.String("regex", "", "regular expression of metric IDs to delete")
+	mtype := fs.String("type", "", "type of metrics deleted by pattern, any if empty")
+	dryRun := fs.Bool("dry-run", false, "list matching metrics without deleting them")
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	var req admin.Request
+	switch {
+	case *group != "" && fs.NArg() == 0:
+		return deleteGroup(ctx, c, *group, w)
+	case (*glob != "" || *regex != "") && fs.NArg() == 0:
+		req = admin.Request{Type: *mtype, Glob: *glob, Regex: *regex, DryRun: *dryRun}
+	case *group == "" && *glob == "" && *regex == "" && fs.NArg() == 2:
+		req = admin.Request{Type: fs.Arg(0), ID: fs.Arg(1), DryRun: *dryRun}
+	default:
+		return fmt.Errorf("usage: metricsctl delete %s", usage)
+	}
+
+	res, err := c.adminDo(ctx, admin.ActionDelete, req)
+	if err != nil {
+		return err
+	}
+	return seriesTable(res).print(w, c.cfg.Output)
+}
+
+// reset sets counter to zero.
+func reset(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	if err := parseArgs(fs, args, 1, "<counter name>"); err != nil {
+		return err
+	}
+
+	res, err := c.adminDo(ctx, admin.ActionReset, admin.Request{Type: "counter", ID: fs.Arg(0)})
+	if err != nil {
+		return err
+	}
+	return seriesTable(res).print(w, c.cfg.Output)
+}
+
+// rename renames metric, with -merge into existing metric.
+func rename(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("rename", flag.ContinueOnError)
+	merge := fs.Bool("merge", false, "merge into existing metric: counters are summed, gauge takes renamed value")
+	if err := parseArgs(fs, args, 3, "[-merge] <gauge|counter> <name> <new name>"); err != nil {
+		return err
+	}
+
+	req := admin.Request{Type: fs.Arg(0), ID: fs.Arg(1), To: fs.Arg(2), Merge: *merge}
+	res, err := c.adminDo(ctx, admin.ActionRename, req)
+	if err != nil {
+		return err
+	}
+	return seriesTable(res).print(w, c.cfg.Output)
+}
+
+// audit prints recent admin actions recorded by the server.
+func audit(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	if err := parseArgs(fs, args, 0, ""); err != nil {
+		return err
+	}
+	if c.cfg.AdminKey == "" {
+		return errors.New("admin key is required: -admin-key or ADMIN_KEY")
+	}
+
+	entries, err := c.auditEntries(ctx, admin.Request{}.Signed(admin.ActionAudit, []byte(c.cfg.AdminKey), time.Now()))
+	if err != nil {
+		return err
+	}
+	t := table{header: []string{"TIME", "ACTOR", "ACTION", "TYPE", "ID", "PATTERN", "TO", "AFFECTED", "ERROR"}, v: entries}
+	for _, e := range entries {
+		pattern := e.Request.Glob
+		if pattern == "" {
+			pattern = e.Request.Regex
+		}
+		t.rows = append(t.rows, []string{e.Time.Format(time.RFC3339), e.Actor, e.Action, e.Request.Type, e.Request.ID,
+			pattern, e.Request.To, strconv.Itoa(e.Affected), e.Error})
+	}
+	return t.print(w, c.cfg.Output)
+}
+
+// auditEntries requests audit records over "/admin/audit" or gRPC Audit with signed request req.
+func (c *ctl) auditEntries(ctx context.Context, req admin.Request) ([]admin.Entry, error) {
+	var entries []admin.Entry
+	if !c.cfg.Grpc {
+		err := c.do(ctx, http.MethodPost, "/admin/"+admin.ActionAudit, nil, req, &entries)
+		return entries, err
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := pb.NewAdminClient(conn).Audit(ctx, rpc.AdminRequestToProto(req))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range resp.Entries {
+		entries = append(entries, rpc.AuditEntryFromProto(e))
+	}
+	return entries, nil
+}
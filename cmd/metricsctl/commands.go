@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	"github.com/andrei-cloud/go-devops/internal/federate"
+	"github.com/andrei-cloud/go-devops/internal/groups"
+	"github.com/andrei-cloud/go-devops/internal/handlers"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+)
+
+// stringList - repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// filterFlags registers flags of metric filters in fs.
+func filterFlags(fs *flag.FlagSet) (*stringList, *stringList) {
+	match, labels := &stringList{}, &stringList{}
+	fs.Var(match, "match", "metric name prefix, repeatable, any must match")
+	fs.Var(labels, "label", "label filter key=value, repeatable, all must match")
+	return match, labels
+}
+
+// federateQuery builds query of metrics filters.
+func federateQuery(match, labels stringList) (federate.Query, error) {
+	q := federate.Query{Match: match}
+	for _, l := range labels {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || k == "" || v == "" {
+			return q, fmt.Errorf("invalid label filter %q", l)
+		}
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[k] = v
+	}
+	return q, nil
+}
+
+// snapshot requests metrics matching q over "/federate" or gRPC Federate, signing query with key.
+func (c *ctl) snapshot(ctx context.Context, q federate.Query) (federate.Response, error) {
+	var resp federate.Response
+	raw := q.Values().Encode()
+	var sign string
+	if len(c.key) != 0 {
+		sign = federate.SignQuery(raw, c.key)
+	}
+
+	if !c.cfg.Grpc {
+		h := http.Header{}
+		if sign != "" {
+			h.Set("X-Hash", sign)
+		}
+		err := c.do(ctx, http.MethodGet, "/federate?"+raw, h, nil, &resp)
+		return resp, err
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+
+	r, err := pb.NewFederationClient(conn).Federate(ctx, &pb.FederateRequest{Query: raw, Hash: sign})
+	if err != nil {
+		return resp, err
+	}
+	return rpc.FederateResponseFromProto(r), nil
+}
+
+// parseArgs parses command flags of fs and checks number of positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string, n int, usage string) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", fs.Name(), err)
+	}
+	if fs.NArg() != n {
+		return fmt.Errorf("usage: metricsctl %s %s", fs.Name(), usage)
+	}
+	return nil
+}
+
+// get prints values of metrics given as type and name pairs, missing metrics are reported as error.
+func get(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if fs.NArg() == 0 || fs.NArg()%2 != 0 {
+		return errors.New("usage: metricsctl get <gauge|counter> <name> [<gauge|counter> <name>...]")
+	}
+
+	var req []model.Metric
+	for i := 0; i < fs.NArg(); i += 2 {
+		req = append(req, model.Metric{MType: fs.Arg(i), ID: fs.Arg(i + 1)})
+	}
+	results, err := c.getMetrics(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	var (
+		found   []model.Metric
+		missing []string
+	)
+	for _, res := range results {
+		if res.Error != "" {
+			missing = append(missing, fmt.Sprintf("%s %s: %s", res.MType, res.ID, res.Error))
+			continue
+		}
+		found = append(found, res.Metric)
+	}
+	if len(found) > 0 {
+		if err := metricsTable(withoutHashes(found)).print(w, c.cfg.Output); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New(strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// list prints metrics matching filters.
+func list(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	match, labels := filterFlags(fs)
+	if err := parseArgs(fs, args, 0, "[-match prefix] [-label key=value]"); err != nil {
+		return err
+	}
+
+	q, err := federateQuery(*match, *labels)
+	if err != nil {
+		return err
+	}
+	resp, err := c.snapshot(ctx, q)
+	if err != nil {
+		return err
+	}
+	return metricsTable(withoutHashes(resp.Metrics)).print(w, c.cfg.Output)
+}
+
+// push updates single metric, counter value is added to the current value.
+func push(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("push", flag.ContinueOnError)
+	if err := parseArgs(fs, args, 3, "<gauge|counter> <name> <value>"); err != nil {
+		return err
+	}
+
+	m := model.Metric{MType: fs.Arg(0), ID: fs.Arg(1)}
+	switch m.MType {
+	case "counter":
+		d, err := strconv.ParseInt(fs.Arg(2), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid counter value: %w", err)
+		}
+		m.Delta = &d
+	case "gauge":
+		v, err := strconv.ParseFloat(fs.Arg(2), 64)
+		if err != nil {
+			return fmt.Errorf("invalid gauge value: %w", err)
+		}
+		m.Value = &v
+	default:
+		return fmt.Errorf("invalid metric type %q", m.MType)
+	}
+
+	if err := c.pushMetrics(ctx, []model.Metric{m}); err != nil {
+		return err
+	}
+	return metricsTable([]model.Metric{m}).print(w, c.cfg.Output)
+}
+
+// pushMetrics sends metrics with client library in single batch.
+func (c *ctl) pushMetrics(ctx context.Context, metrics []model.Metric) error {
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		switch {
+		case m.MType == "counter" && m.Delta != nil:
+			cl.Counter(m.ID).Add(*m.Delta)
+		case m.MType == "gauge" && m.Value != nil:
+			cl.Gauge(m.ID).Set(*m.Value)
+		default:
+			return fmt.Errorf("invalid metric %q of type %q", m.ID, m.MType)
+		}
+	}
+	return cl.Shutdown(ctx)
+}
+
+// watch prints metrics matching filters as they change until interrupted or n polls are done.
+func watch(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	match, labels := filterFlags(fs)
+	interval := fs.Duration("interval", 2*time.Second, "interval between polls")
+	n := fs.Int("n", 0, "number of polls, 0 polls until interrupted")
+	if err := parseArgs(fs, args, 0, "[-interval d] [-n polls] [-match prefix] [-label key=value]"); err != nil {
+		return err
+	}
+
+	q, err := federateQuery(*match, *labels)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for i := 0; *n == 0 || i < *n; i++ {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		resp, err := c.snapshot(ctx, q)
+		if err != nil {
+			return err
+		}
+		// the next poll returns metrics updated after this one
+		q.Epoch, q.SinceVersion = resp.Epoch, resp.Version
+		if len(resp.Metrics) == 0 {
+			continue
+		}
+		if err := metricsTable(withoutHashes(resp.Metrics)).print(w, c.cfg.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteGroup deletes push group job[/instance].
+func deleteGroup(ctx context.Context, c *ctl, group string, w io.Writer) error {
+	var g groups.Group
+	g.Job, g.Instance, _ = strings.Cut(group, "/")
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	var ts int64
+	var sign string
+	if len(c.key) != 0 {
+		ts = time.Now().Unix()
+		sign = hash.CreateTimed(g.Path(), ts, c.key)
+	}
+
+	if !c.cfg.Grpc {
+		h := http.Header{}
+		if sign != "" {
+			h.Set("X-Hash", sign)
+			h.Set(handlers.HeaderTimestamp, strconv.FormatInt(ts, 10))
+		}
+		if err := c.do(ctx, http.MethodDelete, g.Path(), h, nil, &result); err != nil {
+			return err
+		}
+	} else {
+		conn, err := c.dial(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		resp, err := pb.NewMetricsClient(conn).DeleteGroup(ctx, &pb.DeleteGroupRequest{
+			Job: g.Job, Instance: g.Instance, Timestamp: ts, Hash: sign,
+		})
+		if err != nil {
+			return err
+		}
+		result.Deleted = int(resp.Deleted)
+	}
+	return table{
+		header: []string{"JOB", "INSTANCE", "DELETED"},
+		rows:   [][]string{{g.Job, g.Instance, strconv.Itoa(result.Deleted)}},
+		v:      result,
+	}.print(w, c.cfg.Output)
+}
+
+// export writes metrics matching filters as JSON array accepted by import,
+// counters are exported with their totals.
+func export(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	match, labels := filterFlags(fs)
+	file := fs.String("f", "", "file to write, standard output if empty")
+	if err := parseArgs(fs, args, 0, "[-f file] [-match prefix] [-label key=value]"); err != nil {
+		return err
+	}
+
+	q, err := federateQuery(*match, *labels)
+	if err != nil {
+		return err
+	}
+	resp, err := c.snapshot(ctx, q)
+	if err != nil {
+		return err
+	}
+	metrics := withoutHashes(resp.Metrics)
+	for i := range metrics {
+		metrics[i].Updated, metrics[i].Source = nil, ""
+	}
+
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(metrics)
+}
+
+// importMetrics pushes metrics written by export, counters are added to current values.
+func importMetrics(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("f", "", "file to read, standard input if empty")
+	if err := parseArgs(fs, args, 0, "[-f file]"); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	var metrics []model.Metric
+	if err := json.NewDecoder(r).Decode(&metrics); err != nil {
+		return fmt.Errorf("invalid metrics: %w", err)
+	}
+	if err := c.pushMetrics(ctx, metrics); err != nil {
+		return err
+	}
+
+	result := struct {
+		Imported int `json:"imported"`
+	}{len(metrics)}
+	return table{
+		header: []string{"IMPORTED"},
+		rows:   [][]string{{strconv.Itoa(result.Imported)}},
+		v:      result,
+	}.print(w, c.cfg.Output)
+}
+
+// agents prints agents known to the server, admin key required.
+func agents(ctx context.Context, c *ctl, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("agents", flag.ContinueOnError)
+	if err := parseArgs(fs, args, 0, ""); err != nil {
+		return err
+	}
+	if c.cfg.AdminKey == "" {
+		return errors.New("admin key is required: -admin-key or ADMIN_KEY")
+	}
+
+	list, err := c.agentList(ctx, admin.Request{}.Signed(admin.ActionAgents, []byte(c.cfg.AdminKey), time.Now()))
+	if err != nil {
+		return err
+	}
+	t := table{header: []string{"ID", "HOSTNAME", "TRANSPORT", "VERSION", "CONFIG", "STATUS", "LAST SEEN"}, v: list}
+	for _, a := range list {
+		t.rows = append(t.rows, []string{a.ID, a.Hostname, a.Transport, a.Version, a.ConfigVersion, a.Status,
+			a.LastSeen.Format(time.RFC3339)})
+	}
+	return t.print(w, c.cfg.Output)
+}
+
+// agentList requests agents over "/admin/agents" or gRPC Agents with signed request req.
+func (c *ctl) agentList(ctx context.Context, req admin.Request) ([]registry.Agent, error) {
+	var list []registry.Agent
+	if !c.cfg.Grpc {
+		err := c.do(ctx, http.MethodPost, "/admin/"+admin.ActionAgents, nil, req, &list)
+		return list, err
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := pb.NewAdminClient(conn).Agents(ctx, rpc.AdminRequestToProto(req))
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range resp.Agents {
+		list = append(list, rpc.AgentFromProto(a))
+	}
+	return list, nil
+}
+
+// withoutHashes returns metrics without hashes, which are not shown.
+func withoutHashes(metrics []model.Metric) []model.Metric {
+	for i := range metrics {
+		metrics[i].Hash = ""
+	}
+	return metrics
+}
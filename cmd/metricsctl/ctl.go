@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+
+	"github.com/andrei-cloud/go-devops/internal/bulk"
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/pkg/client"
+)
+
+// ctl - connection settings shared by commands.
+type ctl struct {
+	cfg  settings
+	http *http.Client
+	encr encrypt.Encrypter
+	base string
+	key  []byte
+}
+
+func newCtl(cfg settings) (*ctl, error) {
+	switch cfg.Output {
+	case formatTable, formatJSON, formatCSV:
+	default:
+		return nil, fmt.Errorf("unknown output format %q", cfg.Output)
+	}
+
+	c := &ctl{
+		cfg:  cfg,
+		http: &http.Client{Timeout: cfg.Timeout},
+		base: "http://" + cfg.Address,
+	}
+	if cfg.Key != "" {
+		c.key = []byte(cfg.Key)
+	}
+	if cfg.CryptoKey != "" {
+		e, err := encrypt.Load(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crypto key: %w", err)
+		}
+		c.encr = e
+		// request bodies are encrypted like agent does
+		c.http.Transport = middlewares.NewCryptoRT(e)
+	}
+	return c, nil
+}
+
+// client returns client library pushing metrics over the configured transport.
+func (c *ctl) client() (*client.Client, error) {
+	opts := []client.Option{client.WithHTTPClient(c.http)}
+	if c.cfg.Grpc {
+		opts = append(opts, client.WithGRPC())
+	}
+	if c.cfg.Key != "" {
+		opts = append(opts, client.WithKey(c.cfg.Key))
+	}
+	if c.encr != nil {
+		opts = append(opts, client.WithEncrypter(c.encr))
+	}
+	return client.New(c.cfg.Address, opts...)
+}
+
+// do sends request to path with JSON body in, if not nil, and decodes JSON response into out.
+// Headers h are added to request.
+func (c *ctl) do(ctx context.Context, method, path string, h http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// getMetrics requests values of metrics over "/values/" or gRPC GetMetrics.
+func (c *ctl) getMetrics(ctx context.Context, metrics []model.Metric) ([]bulk.Result, error) {
+	var results []bulk.Result
+	if !c.cfg.Grpc {
+		err := c.do(ctx, http.MethodPost, "/values/", nil, metrics, &results)
+		return results, err
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := &pb.GetMetricsRequest{}
+	for _, m := range metrics {
+		req.Metrics = append(req.Metrics, rpc.MetricToProto(m))
+	}
+	resp, err := pb.NewMetricsClient(conn).GetMetrics(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range resp.Results {
+		res := rpc.MetricResultFromProto(r)
+		// type of unknown metric is not representable in gRPC message
+		if i < len(metrics) && res.MType == "" {
+			res.MType = metrics[i].MType
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// dial connects to gRPC server, messages are encrypted with public key if set.
+func (c *ctl) dial(ctx context.Context) (*grpc.ClientConn, error) {
+	callOpts := []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+	if c.encr != nil {
+		callOpts = append(callOpts, grpc.ForceCodec(encrypt.Encodec{Enc: c.encr}))
+	}
+	return grpc.DialContext(ctx, c.cfg.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(callOpts...))
+}
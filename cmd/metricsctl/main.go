@@ -0,0 +1,127 @@
+// Command metricsctl queries and administers the metrics server over HTTP or gRPC.
+//
+// Usage:
+//
+//	metricsctl [global flags] <command> [command flags] [arguments]
+//
+// Commands:
+//
+//	get <type> <name>...        values of metrics
+//	list [-match p] [-label k=v] metrics with name prefixes and labels
+//	push <type> <name> <value>  updates single metric
+//	watch [-interval d] [-n n]  prints metrics as they change
+//	delete -group job[/inst]    deletes push group
+//	delete <type> <name>        deletes metric, admin key required
+//	delete -glob p | -regex r   deletes matching metrics, -type and -dry-run narrow them
+//	reset <name>                sets counter to zero, admin key required
+//	rename [-merge] <type> <name> <new name>
+//	                            renames metric or merges it into existing one
+//	audit                       recent admin actions
+//	export [-f file]            writes metrics in import format
+//	import [-f file]            pushes metrics written by export
+//	agents                      agents known to the server, admin key required
+//
+// Global flags and environment variables are shared with the agent: -a (ADDRESS),
+// -k (KEY), -crypto-key (CRYPTO_KEY) and -grpc (ENABLE_GRPC); -o selects table,
+// json or csv output. Admin commands sign requests with -admin-key (ADMIN_KEY).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// settings - metricsctl configuration loaded by config.Loader.
+type settings struct {
+	Address   string        `json:"address" env:"ADDRESS" flag:"a" default:"localhost:8080" usage:"server address format: host:port, gRPC address with -grpc"`
+	Grpc      bool          `json:"grpc" env:"ENABLE_GRPC" flag:"grpc" usage:"talk to the server over gRPC"`
+	Key       string        `json:"key" env:"KEY" flag:"k" secret:"true" usage:"secret key"`
+	CryptoKey string        `json:"crypto_key" env:"CRYPTO_KEY" flag:"crypto-key" usage:"path to public key file"`
+	AdminKey  string        `json:"admin_key" env:"ADMIN_KEY" flag:"admin-key" secret:"true" usage:"secret key of admin requests"`
+	Output    string        `json:"output" flag:"o" default:"table" usage:"output format: table, json or csv"`
+	Timeout   time.Duration `json:"timeout" flag:"timeout" default:"10s" usage:"request timeout"`
+}
+
+// command - subcommand writing its result to w.
+type command func(ctx context.Context, c *ctl, args []string, w io.Writer) error
+
+var commands = map[string]command{
+	"get":    get,
+	"list":   list,
+	"push":   push,
+	"watch":  watch,
+	"delete": deleteMetrics,
+	"reset":  reset,
+	"rename": rename,
+	"audit":  audit,
+	"export": export,
+	"import": importMetrics,
+	"agents": agents,
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// errors are reported in human readable form, informational logs of libraries are hidden
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, PartsExclude: []string{zerolog.TimestampFieldName}})
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		log.Fatal().Err(err).Msg("metricsctl")
+	}
+}
+
+// run parses global flags and runs command of args.
+func run(ctx context.Context, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("metricsctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(fs.Output(), "Usage: metricsctl [flags] <%s> [arguments]\n", strings.Join(names, "|"))
+		fs.PrintDefaults()
+	}
+
+	cfg := settings{}
+	loader := config.NewLoader(fs, &cfg)
+	if err := loader.Parse(args); err != nil {
+		return err
+	}
+	if err := loader.Load(&cfg); err != nil {
+		return err
+	}
+	if loader.PrintConfig() {
+		return config.Print(w, &cfg)
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("command is required")
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	c, err := newCtl(cfg)
+	if err != nil {
+		return err
+	}
+	return cmd(ctx, c, fs.Args()[1:], w)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	"github.com/andrei-cloud/go-devops/internal/federate"
+	"github.com/andrei-cloud/go-devops/internal/interceptors"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func testServer(t *testing.T, key string) (repo.Repository, string) {
+	t.Helper()
+	r, _, addr, _ := testServers(t, key)
+	return r, addr
+}
+
+// testServers starts HTTP and gRPC servers sharing repository, registry and admin service,
+// returns their addresses.
+func testServers(t *testing.T, key string) (repo.Repository, *registry.Registry, string, string) {
+	t.Helper()
+	j := federate.NewJournal()
+	r := federate.Repository(inmem.New(), j)
+	reg := registry.New(0)
+	svc := testAdmin(t, r)
+	mux := router.SetupRouter(r, []byte(key), nil)
+	mux = router.WithGroups(mux, r, []byte(key), nil, 0)
+	mux = router.WithFederation(mux, r, j, []byte(key))
+	mux = router.WithAgents(mux, reg, profiles.New(nil), []byte(key), nil)
+	mux = router.WithAdmin(mux, svc, reg, nil)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer(grpc.UnaryInterceptor(interceptors.SourceInject))
+	pb.RegisterMetricsServer(g, rpc.NewMetricsServer(r, []byte(key)))
+	pb.RegisterFederationServer(g, rpc.NewFederationServer(r, j, []byte(key)))
+	pb.RegisterAdminServer(g, rpc.NewAdminServer(svc, reg))
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+	return r, reg, strings.TrimPrefix(ts.URL, "http://"), lis.Addr().String()
+}
+
+func testAdmin(t *testing.T, r repo.Repository) *admin.Service {
+	t.Helper()
+	audit, err := admin.OpenAuditLog("", admin.DefaultAuditSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admin.NewService(r, []byte("admin"), audit)
+}
+
+func ctlRun(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	err := run(context.Background(), args, &buf)
+	return buf.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	r, addr := testServer(t, "secret")
+	ctx := context.Background()
+
+	if _, err := ctlRun(t, "-a", addr, "-k", "secret", "push", "counter", "requests", "3"); err != nil {
+		t.Fatalf("push error = %v", err)
+	}
+	if _, err := ctlRun(t, "-a", addr, "-k", "secret", "push", "gauge", "temp;room=a", "21.5"); err != nil {
+		t.Fatalf("push error = %v", err)
+	}
+	if _, err := ctlRun(t, "-a", addr, "-k", "wrong", "push", "counter", "requests", "3"); err == nil {
+		t.Error("push with wrong key, error expected")
+	}
+	if v, err := r.GetCounter(ctx, "requests"); err != nil || v != 3 {
+		t.Errorf("requests = %v, %v, want 3", v, err)
+	}
+
+	out, err := ctlRun(t, "-a", addr, "get", "gauge", "temp;room=a", "counter", "requests")
+	if err != nil || !strings.Contains(out, "21.5") || !strings.Contains(out, "requests") {
+		t.Errorf("get = %q, %v", out, err)
+	}
+	out, err = ctlRun(t, "-a", addr, "get", "gauge", "temp;room=a", "gauge", "missing")
+	if err == nil || !strings.Contains(err.Error(), "gauge missing: not found") || !strings.Contains(out, "21.5") {
+		t.Errorf("get missing = %q, %v", out, err)
+	}
+
+	out, err = ctlRun(t, "-a", addr, "-k", "secret", "-o", "csv", "list", "-label", "room=a")
+	if err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "temp;room=a,gauge,21.5,") {
+		t.Errorf("list = %q", out)
+	}
+	if _, err := ctlRun(t, "-a", addr, "list"); err == nil {
+		t.Error("list without key, error expected")
+	}
+
+	out, err = ctlRun(t, "-a", addr, "-k", "secret", "-o", "json", "watch", "-n", "2", "-interval", "1ms", "-match", "req")
+	if err != nil {
+		t.Fatalf("watch error = %v", err)
+	}
+	var watched []model.Metric
+	if err := json.Unmarshal([]byte(out), &watched); err != nil || len(watched) != 1 || watched[0].ID != "requests" {
+		t.Errorf("watch = %q, %v", out, err)
+	}
+
+	out, err = ctlRun(t, "-a", addr, "-k", "secret", "delete", "-group", "batch/host1")
+	if err != nil || !strings.Contains(out, "batch") {
+		t.Errorf("delete = %q, %v", out, err)
+	}
+
+	if _, err := ctlRun(t, "-a", addr, "alerts"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("alerts error = %v", err)
+	}
+	if _, err := ctlRun(t, "-a", addr, "agents"); err == nil {
+		t.Error("agents without admin key, error expected")
+	}
+	if _, err := ctlRun(t, "-a", addr, "-admin-key", "admin", "-o", "xml", "agents"); err == nil {
+		t.Error("unknown output format, error expected")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	_, src := testServer(t, "")
+	dst, dstAddr := testServer(t, "")
+	file := filepath.Join(t.TempDir(), "metrics.json")
+
+	for _, args := range [][]string{{"counter", "jobs", "4"}, {"gauge", "load", "0.5"}} {
+		if _, err := ctlRun(t, append([]string{"-a", src, "push"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ctlRun(t, "-a", src, "export", "-f", file); err != nil {
+		t.Fatalf("export error = %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "updated") {
+		t.Errorf("export contains metadata: %s", b)
+	}
+
+	out, err := ctlRun(t, "-a", dstAddr, "import", "-f", file)
+	if err != nil || !strings.Contains(out, "2") {
+		t.Fatalf("import = %q, %v", out, err)
+	}
+	ctx := context.Background()
+	if v, err := dst.GetCounter(ctx, "jobs"); err != nil || v != 4 {
+		t.Errorf("jobs = %v, %v, want 4", v, err)
+	}
+	if v, err := dst.GetGauge(ctx, "load"); err != nil || v != 0.5 {
+		t.Errorf("load = %v, %v, want 0.5", v, err)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	r, addr := testServer(t, "")
+	ctx := context.Background()
+	for _, id := range []string{"cpu;host=a", "cpu;host=b", "typo"} {
+		if err := r.UpdateGauge(ctx, id, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.UpdateCounter(ctx, "requests", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ctlRun(t, "-a", addr, "delete", "gauge", "typo"); err == nil || !strings.Contains(err.Error(), "admin key") {
+		t.Errorf("delete without admin key error = %v", err)
+	}
+	if _, err := ctlRun(t, "-a", addr, "-admin-key", "wrong", "delete", "gauge", "typo"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("delete with wrong admin key error = %v", err)
+	}
+	out, err := ctlRun(t, "-a", addr, "-admin-key", "admin", "-o", "csv", "delete", "-glob", "cpu;*")
+	if err != nil || out != "TYPE,ID\ngauge,cpu;host=a\ngauge,cpu;host=b\n" {
+		t.Errorf("delete -glob = %q, %v", out, err)
+	}
+	if _, err := ctlRun(t, "-a", addr, "-admin-key", "admin", "rename", "gauge", "missing", "x"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("rename missing error = %v", err)
+	}
+
+	// admin service over gRPC
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := grpc.NewServer(grpc.UnaryInterceptor(interceptors.SourceInject))
+	pb.RegisterAdminServer(g, rpc.NewAdminServer(testAdmin(t, r), registry.New(0)))
+	pb.RegisterMetricsServer(g, rpc.NewMetricsServer(r, nil))
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+
+	grpcArgs := []string{"-grpc", "-a", lis.Addr().String(), "-admin-key", "admin"}
+	if _, err := ctlRun(t, append(grpcArgs, "reset", "requests")...); err != nil {
+		t.Fatalf("reset over gRPC error = %v", err)
+	}
+	if v, err := r.GetCounter(ctx, "requests"); err != nil || v != 0 {
+		t.Errorf("requests = %v, %v, want 0", v, err)
+	}
+	if _, err := ctlRun(t, append(grpcArgs, "rename", "gauge", "typo", "fixed")...); err != nil {
+		t.Fatalf("rename over gRPC error = %v", err)
+	}
+	out, err = ctlRun(t, append(grpcArgs, "-o", "csv", "get", "gauge", "fixed", "counter", "requests")...)
+	if err != nil || !strings.Contains(out, "fixed,gauge,1,") || !strings.Contains(out, "requests,counter,0,") {
+		t.Errorf("get over gRPC = %q, %v", out, err)
+	}
+
+	out, err = ctlRun(t, "-a", addr, "-admin-key", "admin", "-o", "json", "audit")
+	if err != nil {
+		t.Fatalf("audit error = %v", err)
+	}
+	var entries []admin.Entry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil || len(entries) != 3 || entries[0].Error != "invalid hash" {
+		t.Errorf("audit = %q, %v", out, err)
+	}
+}
+
+func TestCommandsGRPC(t *testing.T) {
+	r, reg, _, addr := testServers(t, "secret")
+	ctx := context.Background()
+	reg.Seen(model.Source{Agent: "host1", Transport: model.TransportGRPC}, time.Now())
+	if err := r.UpdateGauge(ctx, "temp;room=a", 21.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateGauge(ctx, "up;job=batch;instance=host1", 1); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-grpc", "-a", addr, "-k", "secret"}
+
+	out, err := ctlRun(t, append(args, "-o", "csv", "list", "-label", "room=a")...)
+	if err != nil || !strings.HasPrefix(strings.Split(strings.TrimSpace(out), "\n")[1], "temp;room=a,gauge,21.5,") {
+		t.Errorf("list over gRPC = %q, %v", out, err)
+	}
+	if _, err := ctlRun(t, "-grpc", "-a", addr, "-k", "wrong", "list"); err == nil || !strings.Contains(err.Error(), "invalid hash") {
+		t.Errorf("list over gRPC with wrong key error = %v", err)
+	}
+
+	out, err = ctlRun(t, append(args, "-o", "json", "watch", "-n", "2", "-interval", "1ms", "-match", "temp")...)
+	var watched []model.Metric
+	if err != nil || json.Unmarshal([]byte(out), &watched) != nil || len(watched) != 1 || watched[0].ID != "temp;room=a" {
+		t.Errorf("watch over gRPC = %q, %v", out, err)
+	}
+
+	out, err = ctlRun(t, append(args, "export", "-match", "temp")...)
+	var exported []model.Metric
+	if err != nil || json.Unmarshal([]byte(out), &exported) != nil || len(exported) != 1 || exported[0].Updated != nil {
+		t.Errorf("export over gRPC = %q, %v", out, err)
+	}
+
+	out, err = ctlRun(t, append(args, "-o", "csv", "delete", "-group", "batch/host1")...)
+	if err != nil || out != "JOB,INSTANCE,DELETED\nbatch,host1,1\n" {
+		t.Errorf("delete -group over gRPC = %q, %v", out, err)
+	}
+	if _, err := r.GetGauge(ctx, "up;job=batch;instance=host1"); err == nil {
+		t.Error("metric of deleted group is found")
+	}
+
+	args = append(args, "-admin-key", "admin")
+	out, err = ctlRun(t, append(args, "-o", "csv", "agents")...)
+	if err != nil || !strings.Contains(out, "host1,,grpc,") {
+		t.Errorf("agents over gRPC = %q, %v", out, err)
+	}
+	if _, err := ctlRun(t, append(args, "reset", "missing")...); err == nil {
+		t.Error("reset of missing counter, error expected")
+	}
+	out, err = ctlRun(t, append(args, "-o", "json", "audit")...)
+	var entries []admin.Entry
+	if err != nil || json.Unmarshal([]byte(out), &entries) != nil || len(entries) != 1 || entries[0].Transport != model.TransportGRPC {
+		t.Errorf("audit over gRPC = %q, %v", out, err)
+	}
+}
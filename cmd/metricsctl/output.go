@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// table - command result printed as table or CSV rows, or as JSON value v.
+type table struct {
+	header []string
+	rows   [][]string
+	v      interface{}
+}
+
+// print writes t to w in format.
+func (t table) print(w io.Writer, format string) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t.v)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(t.header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// metricsTable returns table of metrics.
+func metricsTable(metrics []model.Metric) table {
+	t := table{header: []string{"ID", "TYPE", "VALUE", "UPDATED", "SOURCE"}, v: metrics}
+	for _, m := range metrics {
+		var updated string
+		if m.Updated != nil {
+			updated = m.Updated.Format(time.RFC3339)
+		}
+		t.rows = append(t.rows, []string{m.ID, m.MType, metricValue(m), updated, m.Source})
+	}
+	return t
+}
+
+// metricValue formats value or delta of metric m.
+func metricValue(m model.Metric) string {
+	switch {
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'g', -1, 64)
+	}
+	return ""
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
-	"github.com/andrei-cloud/go-devops/internal/server"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+	"github.com/andrei-cloud/go-devops/pkg/server"
 )
 
 var (
@@ -18,8 +22,33 @@ var (
 )
 
 func main() {
+	cfg := config.ServerConfig{}
+	loader := config.NewLoader(flag.CommandLine, &cfg)
+	flag.Parse()
+	if err := loader.Load(&cfg); err != nil {
+		log.Fatal().AnErr("Load", err).Msg("invalid configuration")
+	}
+	if loader.PrintConfig() {
+		if err := config.Print(os.Stdout, &cfg); err != nil {
+			log.Fatal().AnErr("Print", err).Msg("main")
+		}
+		return
+	}
+
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
-	s := server.NewServer()
+	zerolog.SetGlobalLevel(cfg.Level())
+	log.Debug().Msg("DEBUG LEVEL IS ENABLED")
+
+	// configuration is loaded from the same sources on SIGHUP
+	reload := func() (config.ServerConfig, error) {
+		c := config.ServerConfig{}
+		err := loader.Load(&c)
+		return c, err
+	}
+	s, err := server.New(server.WithConfig(cfg), server.WithReload(reload))
+	if err != nil {
+		log.Fatal().AnErr("New", err).Msg("failed to create server")
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
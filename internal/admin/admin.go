@@ -0,0 +1,302 @@
+// Package admin implements administrative actions on stored metrics: deletion
+// by name, glob or regular expression, counter reset and rename or merge of
+// series. Requests are signed with admin key and every action, allowed or
+// not, is recorded in audit log.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Actions of admin requests.
+const (
+	ActionDelete = "delete"
+	ActionReset  = "reset"
+	ActionRename = "rename"
+	ActionAudit  = "audit"  // lists recent audit records, not recorded itself
+	ActionAgents = "agents" // lists agents known to the server, not recorded itself
+)
+
+// Errors of admin requests, repository errors repo.ErrNotFound and
+// repo.ErrExists are returned as is.
+var (
+	ErrUnauthorized = errors.New("invalid hash")
+	ErrInvalid      = errors.New("invalid request")
+)
+
+// Request - admin request, fields used depend on action:
+// delete takes ID and Type or one of Glob and Regex with optional Type,
+// reset takes ID of counter, rename takes Type, ID, To and Merge.
+// Requests are signed together with Timestamp and accepted within hash.MaxSkew of it.
+type Request struct {
+	Type      string `json:"type,omitempty"`      // "gauge" or "counter"
+	ID        string `json:"id,omitempty"`        // metric ID
+	Glob      string `json:"glob,omitempty"`      // path.Match pattern of metric IDs to delete
+	Regex     string `json:"regex,omitempty"`     // regular expression of metric IDs to delete
+	To        string `json:"to,omitempty"`        // new ID of renamed metric
+	Merge     bool   `json:"merge,omitempty"`     // merge renamed metric into existing metric To
+	DryRun    bool   `json:"dry_run,omitempty"`   // report matching metrics without deleting them
+	Timestamp int64  `json:"timestamp,omitempty"` // unix time of signing
+	Hash      string `json:"hash,omitempty"`      // Sign of request with admin key
+}
+
+// Sign - returns hash of request r of action and its Timestamp with key.
+func (r Request) Sign(action string, key []byte) string {
+	return hash.CreateTimed(r.payload(action), r.Timestamp, key)
+}
+
+// Signed - returns request r of action signed with key at now.
+func (r Request) Signed(action string, key []byte, now time.Time) Request {
+	r.Timestamp = now.Unix()
+	r.Hash = r.Sign(action, key)
+	return r
+}
+
+// payload returns fields of request r of action covered by hash.
+func (r Request) payload(action string) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s:%s:%t:%t",
+		action, r.Type, r.ID, r.Glob, r.Regex, r.To, r.Merge, r.DryRun)
+}
+
+// Series - metric affected by admin action.
+type Series struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Result - metrics affected by admin action.
+type Result struct {
+	Metrics []Series `json:"metrics"`
+}
+
+// Service - executes signed admin requests on repository.
+type Service struct {
+	repo  repo.Repository
+	key   []byte
+	audit *AuditLog
+}
+
+// NewService - creates new instance of Service executing requests on r,
+// requests are validated with key and recorded in audit.
+func NewService(r repo.Repository, key []byte, audit *AuditLog) *Service {
+	return &Service{repo: r, key: key, audit: audit}
+}
+
+// Audit - returns recent audit records, req must be signed for ActionAudit.
+func (s *Service) Audit(req Request) ([]Entry, error) {
+	if err := s.Authorize(ActionAudit, req); err != nil {
+		return nil, err
+	}
+	return s.audit.Recent(), nil
+}
+
+// Authorize - returns error wrapping ErrUnauthorized unless req is freshly signed for action,
+// used by read-only actions which are not recorded in audit log.
+func (s *Service) Authorize(action string, req Request) error {
+	if len(s.key) == 0 {
+		return ErrUnauthorized
+	}
+	err := hash.ValidateTimed(req.payload(action), req.Timestamp, req.Hash, s.key, time.Now())
+	if errors.Is(err, hash.ErrStale) {
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	if err != nil {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Do - executes request req of action and records it in audit log
+// with actor of ctx, returns metrics affected.
+func (s *Service) Do(ctx context.Context, action string, req Request) (Result, error) {
+	var res Result
+	err := s.Authorize(action, req)
+	if err == nil {
+		switch action {
+		case ActionDelete:
+			res, err = s.delete(ctx, req)
+		case ActionReset:
+			res, err = s.reset(ctx, req)
+		case ActionRename:
+			res, err = s.rename(ctx, req)
+		default:
+			err = fmt.Errorf("%w: unknown action %q", ErrInvalid, action)
+		}
+	}
+
+	e := Entry{Time: time.Now(), Action: action, Request: req, Affected: len(res.Metrics)}
+	e.Request.Hash = ""
+	if src, ok := model.SourceFromContext(ctx); ok {
+		e.Actor, e.Transport = src.Agent, src.Transport
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.audit.Record(e)
+	return res, err
+}
+
+func (s *Service) delete(ctx context.Context, req Request) (Result, error) {
+	var res Result
+	if req.ID != "" {
+		if req.Glob != "" || req.Regex != "" {
+			return res, fmt.Errorf("%w: id, glob and regex are exclusive", ErrInvalid)
+		}
+		if err := validType(req.Type); err != nil {
+			return res, err
+		}
+		res.Metrics = []Series{{Type: req.Type, ID: req.ID}}
+		if req.DryRun {
+			if err := s.exists(ctx, req.Type, req.ID); err != nil {
+				return Result{}, err
+			}
+			return res, nil
+		}
+		if err := s.deleteSeries(ctx, res.Metrics[0]); err != nil {
+			return Result{}, err
+		}
+		return res, nil
+	}
+
+	match, err := matcher(req)
+	if err != nil {
+		return res, err
+	}
+	if req.Type != "" {
+		if err := validType(req.Type); err != nil {
+			return res, err
+		}
+	}
+	matched, err := s.matching(ctx, req.Type, match)
+	if err != nil {
+		return res, err
+	}
+	if req.DryRun {
+		res.Metrics = matched
+		return res, nil
+	}
+	for _, m := range matched {
+		if err := s.deleteSeries(ctx, m); err != nil {
+			return res, err
+		}
+		res.Metrics = append(res.Metrics, m)
+	}
+	return res, nil
+}
+
+func (s *Service) reset(ctx context.Context, req Request) (Result, error) {
+	if req.ID == "" || (req.Type != "" && req.Type != "counter") {
+		return Result{}, fmt.Errorf("%w: id of counter is required", ErrInvalid)
+	}
+	if err := s.repo.ResetCounter(ctx, req.ID); err != nil {
+		return Result{}, err
+	}
+	return Result{Metrics: []Series{{Type: "counter", ID: req.ID}}}, nil
+}
+
+func (s *Service) rename(ctx context.Context, req Request) (Result, error) {
+	if err := validType(req.Type); err != nil {
+		return Result{}, err
+	}
+	if req.ID == "" || req.To == "" || req.ID == req.To {
+		return Result{}, fmt.Errorf("%w: id and different to are required", ErrInvalid)
+	}
+	if err := s.repo.Rename(ctx, req.Type, req.ID, req.To, req.Merge); err != nil {
+		return Result{}, err
+	}
+	return Result{Metrics: []Series{{Type: req.Type, ID: req.To}}}, nil
+}
+
+// matching returns sorted metrics of type mtype, any type if empty, with IDs matching match.
+func (s *Service) matching(ctx context.Context, mtype string, match func(string) bool) ([]Series, error) {
+	var matched []Series
+	if mtype == "" || mtype == "counter" {
+		counters, err := s.repo.GetCounterAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for id := range counters {
+			if match(id) {
+				matched = append(matched, Series{Type: "counter", ID: id})
+			}
+		}
+	}
+	if mtype == "" || mtype == "gauge" {
+		gauges, err := s.repo.GetGaugeAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for id := range gauges {
+			if match(id) {
+				matched = append(matched, Series{Type: "gauge", ID: id})
+			}
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].ID != matched[j].ID {
+			return matched[i].ID < matched[j].ID
+		}
+		return matched[i].Type < matched[j].Type
+	})
+	return matched, nil
+}
+
+func (s *Service) exists(ctx context.Context, mtype, id string) error {
+	var err error
+	if mtype == "gauge" {
+		_, err = s.repo.GetGauge(ctx, id)
+	} else {
+		_, err = s.repo.GetCounter(ctx, id)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %s", repo.ErrNotFound, mtype, id)
+	}
+	return nil
+}
+
+func (s *Service) deleteSeries(ctx context.Context, m Series) error {
+	if m.Type == "gauge" {
+		return s.repo.DeleteGauge(ctx, m.ID)
+	}
+	return s.repo.DeleteCounter(ctx, m.ID)
+}
+
+// matcher returns function matching IDs with glob or regular expression of req.
+func matcher(req Request) (func(string) bool, error) {
+	switch {
+	case req.Glob != "" && req.Regex != "":
+		return nil, fmt.Errorf("%w: id, glob and regex are exclusive", ErrInvalid)
+	case req.Glob != "":
+		if _, err := path.Match(req.Glob, ""); err != nil {
+			return nil, fmt.Errorf("%w: glob: %v", ErrInvalid, err)
+		}
+		return func(id string) bool {
+			ok, _ := path.Match(req.Glob, id)
+			return ok
+		}, nil
+	case req.Regex != "":
+		re, err := regexp.Compile(req.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("%w: regex: %v", ErrInvalid, err)
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("%w: id, glob or regex is required", ErrInvalid)
+}
+
+func validType(mtype string) error {
+	if mtype != "gauge" && mtype != "counter" {
+		return fmt.Errorf("%w: invalid metric type %q", ErrInvalid, mtype)
+	}
+	return nil
+}
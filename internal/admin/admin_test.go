@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestService(t *testing.T) {
+	key := []byte("admin")
+	ctx := model.WithSource(context.Background(), model.Source{Agent: "10.0.0.1", Transport: model.TransportHTTP})
+	r := inmem.New()
+	for _, id := range []string{"cpu;host=a", "cpu;host=b", "mem;host=a", "typo"} {
+		require.NoError(t, r.UpdateGauge(ctx, id, 1))
+	}
+	require.NoError(t, r.UpdateCounter(ctx, "requests", 5))
+	require.NoError(t, r.UpdateCounter(ctx, "reqs", 2))
+	require.NoError(t, r.UpdateCounter(ctx, "cpu;host=c", 1))
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditLog(file, 3)
+	require.NoError(t, err)
+	svc := NewService(r, key, audit)
+
+	signed := func(action string, req Request) Request {
+		req = req.Signed(action, key, time.Now())
+		return req
+	}
+	ids := func(res Result) []string {
+		var ids []string
+		for _, m := range res.Metrics {
+			ids = append(ids, m.Type+":"+m.ID)
+		}
+		return ids
+	}
+
+	_, err = svc.Do(ctx, ActionDelete, Request{Type: "gauge", ID: "typo", Hash: "bad"})
+	require.ErrorIs(t, err, ErrUnauthorized)
+	_, err = svc.Do(ctx, ActionDelete, Request{Type: "gauge", ID: "typo"}.Signed(ActionDelete, key, time.Now().Add(-time.Hour)))
+	require.ErrorIs(t, err, ErrUnauthorized)
+	require.Contains(t, err.Error(), "stale")
+
+	res, err := svc.Do(ctx, ActionDelete, signed(ActionDelete, Request{Glob: "cpu;*", DryRun: true}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"gauge:cpu;host=a", "gauge:cpu;host=b", "counter:cpu;host=c"}, ids(res))
+	_, err = r.GetGauge(ctx, "cpu;host=a")
+	require.NoError(t, err, "dry run deleted metric")
+
+	res, err = svc.Do(ctx, ActionDelete, signed(ActionDelete, Request{Type: "gauge", Regex: `^cpu;host=[ab]$`}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"gauge:cpu;host=a", "gauge:cpu;host=b"}, ids(res))
+	_, err = r.GetCounter(ctx, "cpu;host=c")
+	require.NoError(t, err, "counter deleted by gauge pattern")
+
+	_, err = svc.Do(ctx, ActionDelete, signed(ActionDelete, Request{Type: "gauge", ID: "typo"}))
+	require.NoError(t, err)
+	_, err = svc.Do(ctx, ActionDelete, signed(ActionDelete, Request{Type: "gauge", ID: "typo"}))
+	require.ErrorIs(t, err, repo.ErrNotFound)
+	_, err = svc.Do(ctx, ActionDelete, signed(ActionDelete, Request{Glob: "[", Regex: "x"}))
+	require.ErrorIs(t, err, ErrInvalid)
+	_, err = svc.Do(ctx, ActionDelete, signed(ActionDelete, Request{Glob: "["}))
+	require.ErrorIs(t, err, ErrInvalid)
+
+	_, err = svc.Do(ctx, ActionReset, signed(ActionReset, Request{ID: "requests"}))
+	require.NoError(t, err)
+	v, err := r.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), v)
+
+	require.NoError(t, r.UpdateCounter(ctx, "requests", 3))
+	_, err = svc.Do(ctx, ActionRename, signed(ActionRename, Request{Type: "counter", ID: "reqs", To: "requests"}))
+	require.ErrorIs(t, err, repo.ErrExists)
+	_, err = svc.Do(ctx, ActionRename, signed(ActionRename, Request{Type: "counter", ID: "reqs", To: "requests", Merge: true}))
+	require.NoError(t, err)
+	v, err = r.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), v)
+	_, err = r.GetCounter(ctx, "reqs")
+	require.Error(t, err)
+
+	_, err = svc.Audit(Request{})
+	require.ErrorIs(t, err, ErrUnauthorized)
+	entries, err := svc.Audit(signed(ActionAudit, Request{}))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, ActionRename, entries[2].Action)
+	require.Equal(t, "10.0.0.1", entries[2].Actor)
+	require.Equal(t, 1, entries[2].Affected)
+	require.Empty(t, entries[2].Request.Hash)
+
+	require.NoError(t, audit.Close())
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 11, "every action is recorded")
+	var first Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.Equal(t, ErrUnauthorized.Error(), first.Error)
+}
@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultAuditSize - number of recent audit records kept in memory.
+const DefaultAuditSize = 1000
+
+// Entry - audit record of admin action.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`     // agent ID header or address of client
+	Transport string    `json:"transport,omitempty"` // model.TransportHTTP or model.TransportGRPC
+	Action    string    `json:"action"`
+	Request   Request   `json:"request"`
+	Affected  int       `json:"affected"`        // number of affected metrics
+	Error     string    `json:"error,omitempty"` // empty if action succeeded
+}
+
+// AuditLog - keeps recent audit records in memory and appends every record
+// to file as JSON line.
+type AuditLog struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	recent []Entry
+	size   int
+}
+
+// OpenAuditLog - creates audit log appending to file path, records are kept
+// in memory only if path is empty. Up to size recent records are kept in memory.
+func OpenAuditLog(path string, size int) (*AuditLog, error) {
+	l := &AuditLog{size: size}
+	if path == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l.w = f
+	return l, nil
+}
+
+// Record - records entry e, failure to write file is logged.
+func (l *AuditLog) Record(e Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	log.Info().Str("action", e.Action).Str("actor", e.Actor).Int("affected", e.Affected).Str("error", e.Error).Msg("Admin")
+	l.recent = append(l.recent, e)
+	if len(l.recent) > l.size {
+		l.recent = l.recent[len(l.recent)-l.size:]
+	}
+	if l.w == nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Error().AnErr("Marshal", err).Msg("AuditLog")
+		return
+	}
+	if _, err := l.w.Write(append(b, '\n')); err != nil {
+		log.Error().AnErr("Write", err).Msg("AuditLog")
+	}
+}
+
+// Recent - returns copy of recent records, oldest first.
+func (l *AuditLog) Recent() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry{}, l.recent...)
+}
+
+// Close - closes audit log file.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.w == nil {
+		return nil
+	}
+	err := l.w.Close()
+	l.w = nil
+	return err
+}
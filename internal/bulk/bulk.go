@@ -0,0 +1,183 @@
+// Package bulk implements requests on many metrics at once shared by
+// HTTP and gRPC handlers, reporting result of every metric separately.
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Reasons of rejected updates.
+var (
+	ErrInvalid     = errors.New("invalid metric")
+	ErrUnknownType = errors.New("invalid metric type")
+	ErrNotApplied  = errors.New("not applied: batch rejected")
+)
+
+// Statuses of updates.
+const (
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+// Result - result of single metric of bulk request,
+// Error is empty if the metric was processed.
+type Result struct {
+	model.Metric
+	Error string `json:"error,omitempty"`
+}
+
+// Get - returns values of metrics identified by ID and MType of metrics in
+// the same order, with metadata of their last update and signed with key if set.
+// Missing metrics and metrics of unknown type are reported in Error of their result.
+func Get(ctx context.Context, r repo.Repository, metrics []model.Metric, key []byte) []Result {
+	results := make([]Result, 0, len(metrics))
+	for _, m := range metrics {
+		res := Result{Metric: model.Metric{ID: m.ID, MType: m.MType}}
+		switch m.MType {
+		case "gauge":
+			v, err := r.GetGauge(ctx, m.ID)
+			if err != nil {
+				res.Error = "not found"
+				break
+			}
+			res.Value = &v
+		case "counter":
+			d, err := r.GetCounter(ctx, m.ID)
+			if err != nil {
+				res.Error = "not found"
+				break
+			}
+			res.Delta = &d
+		default:
+			res.Error = fmt.Sprintf("invalid metric type %q", m.MType)
+		}
+
+		if res.Error == "" {
+			res.Metric = hash.Sign(res.Metric, key)
+			if md, err := r.GetMetadata(ctx, m.MType, m.ID); err == nil {
+				updated := md.Updated
+				res.Updated, res.Source = &updated, md.Source
+			}
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// UpdateResult - result of single metric of bulk update, Error is reason of rejection.
+type UpdateResult struct {
+	ID     string `json:"id"`
+	MType  string `json:"type"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	err error
+}
+
+// Err - returns reason of rejection, nil if the update was accepted.
+func (u UpdateResult) Err() error {
+	return u.err
+}
+
+// Report - result of bulk update with results of metrics in the request order.
+type Report struct {
+	Atomic   bool           `json:"atomic"`
+	Accepted int            `json:"accepted"`
+	Rejected int            `json:"rejected"`
+	Results  []UpdateResult `json:"results"`
+}
+
+// Err - returns reason of the first rejection caused by the metric itself
+// or by the repository, nil if all updates were accepted.
+func (r Report) Err() error {
+	var first error
+	for _, res := range r.Results {
+		switch {
+		case res.err == nil:
+		case !errors.Is(res.err, ErrNotApplied):
+			return res.err
+		case first == nil:
+			first = res.err
+		}
+	}
+	return first
+}
+
+// Update - validates metrics and their hashes with key and applies them to r.
+// Invalid metrics are rejected and the rest applied one by one, unless atomic is set:
+// then all metrics are applied with r.UpdateMetrics or none of them.
+func Update(ctx context.Context, r repo.Repository, metrics []model.Metric, key []byte, atomic bool) Report {
+	report := Report{Atomic: atomic, Results: make([]UpdateResult, 0, len(metrics))}
+	valid := true
+	for _, m := range metrics {
+		res := UpdateResult{ID: m.ID, MType: m.MType, err: validate(m, key)}
+		valid = valid && res.err == nil
+		report.Results = append(report.Results, res)
+	}
+
+	if atomic {
+		var err error
+		if valid {
+			err = r.UpdateMetrics(ctx, metrics)
+		}
+		for i := range report.Results {
+			res := &report.Results[i]
+			switch {
+			case res.err != nil:
+			case !valid:
+				res.err = ErrNotApplied
+			case err != nil:
+				res.err = fmt.Errorf("failed to update: %w", err)
+			}
+		}
+	} else {
+		for i, m := range metrics {
+			res := &report.Results[i]
+			if res.err != nil {
+				continue
+			}
+			var err error
+			if m.MType == "gauge" {
+				err = r.UpdateGauge(ctx, m.ID, *m.Value)
+			} else {
+				err = r.UpdateCounter(ctx, m.ID, *m.Delta)
+			}
+			if err != nil {
+				res.err = fmt.Errorf("failed to update: %w", err)
+			}
+		}
+	}
+
+	for i := range report.Results {
+		res := &report.Results[i]
+		if res.err != nil {
+			res.Status, res.Error = StatusRejected, res.err.Error()
+			report.Rejected++
+			continue
+		}
+		res.Status = StatusAccepted
+		report.Accepted++
+	}
+	return report
+}
+
+// validate checks fields of m and its hash.
+func validate(m model.Metric, key []byte) error {
+	if m.MType != "gauge" && m.MType != "counter" {
+		return fmt.Errorf("%w %q", ErrUnknownType, m.MType)
+	}
+	if err := m.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	ok, err := hash.Validate(m, key)
+	if err != nil || !ok {
+		return fmt.Errorf("%w: hash mismatch", ErrInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/mocks"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestGet(t *testing.T) {
+	ctx := model.WithSource(context.Background(), model.Source{Agent: "host1", Transport: model.TransportHTTP})
+	r := inmem.New()
+	require.NoError(t, r.UpdateGauge(ctx, "alloc", 1.5))
+	require.NoError(t, r.UpdateCounter(ctx, "poll_count", 3))
+
+	results := Get(ctx, r, []model.Metric{
+		{ID: "alloc", MType: "gauge"},
+		{ID: "alloc", MType: "counter"},
+		{ID: "poll_count", MType: "counter"},
+		{ID: "poll_count", MType: "histogram"},
+	}, nil)
+	require.Len(t, results, 4)
+
+	require.Empty(t, results[0].Error)
+	require.Equal(t, 1.5, *results[0].Value)
+	require.Equal(t, "host1", results[0].Source)
+	require.Empty(t, results[0].Hash)
+	require.Equal(t, "not found", results[1].Error)
+	require.Nil(t, results[1].Delta)
+	require.Equal(t, int64(3), *results[2].Delta)
+	require.Equal(t, `invalid metric type "histogram"`, results[3].Error)
+
+	results = Get(ctx, r, []model.Metric{{ID: "alloc", MType: "gauge"}}, []byte("secret"))
+	require.NotEmpty(t, results[0].Hash)
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("secret")
+	v, d := 1.5, int64(3)
+	metrics := []model.Metric{
+		hash.Sign(model.Metric{ID: "alloc", MType: "gauge", Value: &v}, key),
+		{ID: "poll_count", MType: "counter", Delta: &d, Hash: "00"},
+		{ID: "heap", MType: "gauge"},
+		{ID: "x", MType: "histogram"},
+		hash.Sign(model.Metric{ID: "poll_count", MType: "counter", Delta: &d}, key),
+	}
+	statuses := func(rep Report) []string {
+		var s []string
+		for _, res := range rep.Results {
+			s = append(s, res.Status)
+		}
+		return s
+	}
+
+	r := inmem.New()
+	rep := Update(ctx, r, metrics, key, false)
+	require.Equal(t, []string{StatusAccepted, StatusRejected, StatusRejected, StatusRejected, StatusAccepted}, statuses(rep))
+	require.Equal(t, 2, rep.Accepted)
+	require.Equal(t, 3, rep.Rejected)
+	require.ErrorIs(t, rep.Err(), ErrInvalid)
+	require.ErrorIs(t, rep.Results[3].Err(), ErrUnknownType)
+	require.Equal(t, "invalid metric: hash mismatch", rep.Results[1].Error)
+	c, err := r.GetCounter(ctx, "poll_count")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), c)
+
+	// atomic batch with invalid metric is not applied
+	r = inmem.New()
+	rep = Update(ctx, r, metrics, key, true)
+	require.True(t, rep.Atomic)
+	require.Equal(t, 0, rep.Accepted)
+	require.ErrorIs(t, rep.Results[0].Err(), ErrNotApplied)
+	require.ErrorIs(t, rep.Err(), ErrInvalid)
+	_, err = r.GetGauge(ctx, "alloc")
+	require.Error(t, err)
+
+	valid := []model.Metric{metrics[0], metrics[4]}
+	rep = Update(ctx, r, valid, key, true)
+	require.NoError(t, rep.Err())
+	require.Equal(t, []string{StatusAccepted, StatusAccepted}, statuses(rep))
+
+	ctrl := gomock.NewController(t)
+	m := mocks.NewMockRepository(ctrl)
+	m.EXPECT().UpdateMetrics(gomock.Any(), valid).Return(errors.New("DB error"))
+	rep = Update(ctx, m, valid, key, true)
+	require.Equal(t, 2, rep.Rejected)
+	require.Equal(t, "failed to update: DB error", rep.Err().Error())
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+// Aggregator - thread safe accumulator for metrics pushed into the agent.
+// Gauges are last-write-wins, counters are summed between reports.
+type Aggregator struct {
+	mu       sync.Mutex
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+var _ Collector = &Aggregator{}
+
+// NewAggregator - creates new instance of metrics aggregator.
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		gauges:   make(map[string]float64),
+		counters: make(map[string]int64),
+	}
+}
+
+// SetGauge - sets gauge g to value v.
+func (a *Aggregator) SetGauge(g string, v float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gauges[g] = v
+}
+
+// AddGauge - adds delta d to gauge g.
+func (a *Aggregator) AddGauge(g string, d float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.gauges[g] += d
+}
+
+// AddCounter - adds delta d to counter c.
+func (a *Aggregator) AddCounter(c string, d int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counters[c] += d
+}
+
+// Add - applies metric in model.Metric format
+// returns error if metric is not valid.
+func (a *Aggregator) Add(m model.Metric) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	if m.MType == "gauge" {
+		a.SetGauge(m.ID, *m.Value)
+	} else {
+		a.AddCounter(m.ID, *m.Delta)
+	}
+	return nil
+}
+
+// Gauge - returns the last value of gauge g.
+func (a *Aggregator) Gauge(g string) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	v, ok := a.gauges[g]
+	return v, ok
+}
+
+// Counter - returns increment of counter c accumulated since the previous report.
+func (a *Aggregator) Counter(c string) (int64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	v, ok := a.counters[c]
+	return v, ok
+}
+
+// DeleteGauge - removes gauge g, returns whether it was present.
+func (a *Aggregator) DeleteGauge(g string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.gauges[g]
+	delete(a.gauges, g)
+	return ok
+}
+
+// DeleteCounter - removes buffered increment of counter c, returns whether it was present.
+func (a *Aggregator) DeleteCounter(c string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.counters[c]
+	delete(a.counters, c)
+	return ok
+}
+
+// Do - calls f with gauges and counter increments under lock, so changes of
+// several metrics made by f are seen by reports at once. f must not retain the maps.
+func (a *Aggregator) Do(f func(gauges map[string]float64, counters map[string]int64) error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return f(a.gauges, a.counters)
+}
+
+// Counters - returns copy of counter increments accumulated since the previous report.
+func (a *Aggregator) Counters() map[string]int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counters := make(map[string]int64, len(a.counters))
+	for k, v := range a.counters {
+		counters[k] = v
+	}
+	return counters
+}
+
+// Collect - aggregator is fed externally, nothing to collect.
+func (a *Aggregator) Collect() {}
+
+// CollectExtra - aggregator is fed externally, nothing to collect.
+func (a *Aggregator) CollectExtra() {}
+
+// GetGauges - returns copy of the last gauge values.
+func (a *Aggregator) GetGauges() map[string]float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	gauges := make(map[string]float64, len(a.gauges))
+	for k, v := range a.gauges {
+		gauges[k] = v
+	}
+	return gauges
+}
+
+// GetCounter - returns counter increments accumulated since the previous call.
+func (a *Aggregator) GetCounter() map[string]int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counters := a.counters
+	a.counters = make(map[string]int64, len(counters))
+	return counters
+}
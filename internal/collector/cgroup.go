@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CgroupRoot - default mount point of cgroup v2 unified hierarchy.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// CgroupSelf - cgroup path value selecting the agent's own cgroup.
+const CgroupSelf = "self"
+
+type cgroupCollector struct {
+	dir      string
+	mu       sync.RWMutex
+	gauges   map[string]float64
+	counters cumulative
+}
+
+var _ Collector = &cgroupCollector{}
+
+// NewCgroupCollector - creates collector of container resources for cgroup v2.
+// root is the cgroup2 mount point, path is the cgroup relative to the root.
+func NewCgroupCollector(root, path string) *cgroupCollector {
+	return &cgroupCollector{
+		dir:      filepath.Join(root, path),
+		gauges:   make(map[string]float64),
+		counters: newCumulative(),
+	}
+}
+
+// SelfCgroup - reads cgroup v2 path of the current process from proc file
+// (normally /proc/self/cgroup), the entry has format "0::/path".
+func SelfCgroup(procFile string) (string, error) {
+	f, err := os.Open(procFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("cgroup v2 entry not found in %s", procFile)
+}
+
+// Collect - cgroup metrics are collected by CollectExtra.
+func (c *cgroupCollector) Collect() {}
+
+// CollectExtra - reads memory, cpu, io and pids controllers of the cgroup.
+// Missing files (disabled controllers) are skipped.
+func (c *cgroupCollector) CollectExtra() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.readValue("memory.current"); ok {
+		c.gauges["cgroup_memory_current"] = v
+	}
+	if v, ok := c.readValue("memory.max"); ok {
+		c.gauges["cgroup_memory_max"] = v
+	}
+	if v, ok := c.readValue("pids.current"); ok {
+		c.gauges["cgroup_pids_current"] = v
+	}
+	if v, ok := c.readValue("pids.max"); ok {
+		c.gauges["cgroup_pids_max"] = v
+	}
+	if fields, err := c.readFields("cpu.max"); err == nil && len(fields) == 2 && fields[0] != "max" {
+		quota, qErr := strconv.ParseFloat(fields[0], 64)
+		period, pErr := strconv.ParseFloat(fields[1], 64)
+		if qErr == nil && pErr == nil && period > 0 {
+			c.gauges["cgroup_cpu_limit"] = quota / period
+		}
+	}
+
+	if stat, err := c.readKeyValues("cpu.stat"); err == nil {
+		for k, v := range stat {
+			c.counters.set("cgroup_cpu_"+k, v)
+		}
+	} else {
+		log.Debug().AnErr("cpu.stat", err).Msg("CgroupCollector")
+	}
+
+	if stat, err := c.readIOStat(); err == nil {
+		for k, v := range stat {
+			c.counters.set("cgroup_io_"+k, v)
+		}
+	} else {
+		log.Debug().AnErr("io.stat", err).Msg("CgroupCollector")
+	}
+}
+
+// GetGauges - returns memory, pids and cpu limit gauges.
+func (c *cgroupCollector) GetGauges() map[string]float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	gauges := make(map[string]float64, len(c.gauges))
+	for k, v := range c.gauges {
+		gauges[k] = v
+	}
+	return gauges
+}
+
+// GetCounter - returns increments of cpu and io usage since the previous call.
+func (c *cgroupCollector) GetCounter() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counters.deltas()
+}
+
+// readValue reads single value file, "max" means no limit and is not reported.
+func (c *cgroupCollector) readValue(name string) (float64, bool) {
+	fields, err := c.readFields(name)
+	if err != nil || len(fields) != 1 || fields[0] == "max" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		log.Debug().AnErr("ParseFloat", err).Str("file", name).Msg("CgroupCollector")
+		return 0, false
+	}
+	return v, true
+}
+
+func (c *cgroupCollector) readFields(name string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// readKeyValues parses flat keyed files like cpu.stat: "<key> <value>" per line.
+func (c *cgroupCollector) readKeyValues(name string) (map[string]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		values[fields[0]] = v
+	}
+	return values, nil
+}
+
+// readIOStat parses nested keyed io.stat: "<major>:<minor> rbytes=1 wbytes=2 ..."
+// values are summed over all devices.
+func (c *cgroupCollector) readIOStat() (map[string]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, kv := range fields[1:] {
+			k, raw, ok := strings.Cut(kv, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("io.stat: %w", err)
+			}
+			values[k] += v
+		}
+	}
+	return values, nil
+}
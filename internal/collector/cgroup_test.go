@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfCgroup(t *testing.T) {
+	path, err := SelfCgroup("testdata/proc/cgroup")
+	require.NoError(t, err)
+	require.Equal(t, "/system.slice/agent.service", path)
+
+	_, err = SelfCgroup("testdata/proc/cgroup_v1")
+	require.Error(t, err)
+
+	_, err = SelfCgroup("testdata/proc/missing")
+	require.Error(t, err)
+}
+
+func TestCgroupCollector(t *testing.T) {
+	c := NewCgroupCollector("testdata/cgroup", "/system.slice/agent.service")
+	c.CollectExtra()
+
+	gauges := c.GetGauges()
+	require.Equal(t, float64(52428800), gauges["cgroup_memory_current"])
+	require.Equal(t, float64(268435456), gauges["cgroup_memory_max"])
+	require.Equal(t, float64(12), gauges["cgroup_pids_current"])
+	require.Equal(t, 1.5, gauges["cgroup_cpu_limit"])
+	require.NotContains(t, gauges, "cgroup_pids_max")
+
+	counters := c.GetCounter()
+	require.Equal(t, int64(2500000), counters["cgroup_cpu_usage_usec"])
+	require.Equal(t, int64(3), counters["cgroup_cpu_nr_throttled"])
+	require.Equal(t, int64(120000), counters["cgroup_cpu_throttled_usec"])
+	require.Equal(t, int64(5120), counters["cgroup_io_rbytes"])
+	require.Equal(t, int64(8192), counters["cgroup_io_wbytes"])
+
+	c.CollectExtra()
+	counters = c.GetCounter()
+	require.Equal(t, int64(0), counters["cgroup_cpu_usage_usec"])
+}
+
+func TestCgroupCollectorMissingControllers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.current"), []byte("1024\n"), 0o644))
+
+	c := NewCgroupCollector(dir, "/")
+	c.CollectExtra()
+
+	require.Equal(t, map[string]float64{"cgroup_memory_current": 1024}, c.GetGauges())
+	require.Empty(t, c.GetCounter())
+}
@@ -2,6 +2,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"runtime"
@@ -20,6 +21,12 @@ type Collector interface {
 	GetCounter() map[string]int64
 }
 
+// Runner is implemented by collectors running their own background loop
+// (listeners, scheduled commands). Run blocks until ctx is done.
+type Runner interface {
+	Run(ctx context.Context)
+}
+
 type collector struct {
 	gauges  map[string]float64
 	mu      sync.RWMutex
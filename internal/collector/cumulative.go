@@ -0,0 +1,42 @@
+package collector
+
+// cumulative keeps monotonic totals and the values last handed out as counters.
+// Server counters are additive, so only increments are reported.
+type cumulative struct {
+	current  map[string]uint64
+	reported map[string]uint64
+}
+
+func newCumulative() cumulative {
+	return cumulative{
+		current:  make(map[string]uint64),
+		reported: make(map[string]uint64),
+	}
+}
+
+func (c cumulative) set(key string, v uint64) {
+	c.current[key] = v
+}
+
+// baseline marks current totals as reported, so the next deltas
+// count only increments after this call.
+func (c cumulative) baseline() {
+	for k, v := range c.current {
+		c.reported[k] = v
+	}
+}
+
+// deltas returns increments since previous call, a reset of the source
+// (e.g. recreated cgroup) is reported as the new total.
+func (c cumulative) deltas() map[string]int64 {
+	deltas := make(map[string]int64, len(c.current))
+	for k, v := range c.current {
+		prev := c.reported[k]
+		if v < prev {
+			prev = 0
+		}
+		deltas[k] = int64(v - prev)
+		c.reported[k] = v
+	}
+	return deltas
+}
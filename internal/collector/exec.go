@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Output formats supported by exec collector.
+const (
+	FormatJSON = "json" // JSON array of model.Metric, as accepted by "/updates/"
+	FormatLine = "line" // "<name> <type> <value>" per line
+)
+
+const (
+	defaultExecInterval = 10 * time.Second
+	defaultExecTimeout  = 5 * time.Second
+)
+
+type execCollector struct {
+	*Aggregator
+	commands []config.ExecCommand
+}
+
+var (
+	_ Collector = &execCollector{}
+	_ Runner    = &execCollector{}
+)
+
+// NewExecCollector - creates collector running commands on their intervals
+// and parsing metrics from standard output.
+// For every command status metrics are reported as well:
+//
+//	exec_<name>_exit_code - gauge, exit code of the last run (-1 if not started or killed)
+//	exec_<name>_duration  - gauge, duration of the last run in seconds
+//	exec_<name>_failures  - counter, runs finished with non-zero exit code
+//	exec_<name>_timeouts  - counter, runs killed by timeout
+func NewExecCollector(commands []config.ExecCommand) *execCollector {
+	c := &execCollector{Aggregator: NewAggregator()}
+	for _, cmd := range commands {
+		if cmd.Name == "" {
+			cmd.Name = cmd.Command
+		}
+		if cmd.Interval.Duration <= 0 {
+			cmd.Interval.Duration = defaultExecInterval
+		}
+		if cmd.Timeout.Duration <= 0 {
+			cmd.Timeout.Duration = defaultExecTimeout
+		}
+		if cmd.Format == "" {
+			cmd.Format = FormatLine
+		}
+		c.commands = append(c.commands, cmd)
+	}
+	return c
+}
+
+// Run - runs every command on its own ticker until ctx is done.
+func (c *execCollector) Run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	for _, cmd := range c.commands {
+		wg.Add(1)
+		go func(cmd config.ExecCommand) {
+			defer wg.Done()
+			ticker := time.NewTicker(cmd.Interval.Duration)
+			defer ticker.Stop()
+			for {
+				c.execute(ctx, cmd)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(cmd)
+	}
+	wg.Wait()
+}
+
+func (c *execCollector) execute(ctx context.Context, cmd config.ExecCommand) {
+	prefix := "exec_" + sanitizeName(cmd.Name)
+
+	lctx, cancel := context.WithTimeout(ctx, cmd.Timeout.Duration)
+	defer cancel()
+
+	start := time.Now()
+	stdout, stderr, err := run(lctx, exec.CommandContext(lctx, cmd.Command, cmd.Args...))
+	c.SetGauge(prefix+"_duration", time.Since(start).Seconds())
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if errors.Is(lctx.Err(), context.DeadlineExceeded) {
+		log.Warn().Str("command", cmd.Name).Dur("timeout", cmd.Timeout.Duration).Msg("ExecCollector: timeout")
+		c.SetGauge(prefix+"_exit_code", -1)
+		c.AddCounter(prefix+"_timeouts", 1)
+		return
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		log.Warn().Str("command", cmd.Name).Int("code", exitErr.ExitCode()).Str("stderr", string(stderr)).Msg("ExecCollector: failed")
+		c.SetGauge(prefix+"_exit_code", float64(exitErr.ExitCode()))
+		c.AddCounter(prefix+"_failures", 1)
+	case err != nil:
+		log.Error().AnErr("Run", err).Str("command", cmd.Name).Msg("ExecCollector")
+		c.SetGauge(prefix+"_exit_code", -1)
+		c.AddCounter(prefix+"_failures", 1)
+		return
+	default:
+		c.SetGauge(prefix+"_exit_code", 0)
+	}
+
+	metrics, err := ParseOutput(cmd.Format, stdout)
+	if err != nil {
+		log.Error().AnErr("ParseOutput", err).Str("command", cmd.Name).Msg("ExecCollector")
+	}
+	for _, m := range metrics {
+		if err := c.Add(m); err != nil {
+			log.Error().AnErr("Add", err).Str("command", cmd.Name).Msg("ExecCollector")
+		}
+	}
+}
+
+// run runs command and returns its output. Output is not awaited after ctx is done:
+// processes started by killed command may still hold the pipes open.
+func run(ctx context.Context, command *exec.Cmd) ([]byte, []byte, error) {
+	outPipe, err := command.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	errPipe, err := command.StderrPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := command.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	outCh, errCh := readAll(outPipe), readAll(errPipe)
+	wait := func(ch <-chan []byte) []byte {
+		select {
+		case b := <-ch:
+			return b
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	stdout, stderr := wait(outCh), wait(errCh)
+	// Wait closes the pipes, so readers left after timeout return as well
+	return stdout, stderr, command.Wait()
+}
+
+// readAll reads r in background, the result is sent when r is drained or closed.
+func readAll(r io.Reader) <-chan []byte {
+	ch := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(r)
+		ch <- b
+	}()
+	return ch
+}
+
+// ParseOutput - parses command output in given format into list of metrics.
+// Parsing of line format continues on invalid lines, all valid metrics
+// are returned together with the first error.
+func ParseOutput(format string, out []byte) ([]model.Metric, error) {
+	switch format {
+	case FormatJSON:
+		metrics := []model.Metric{}
+		if len(bytes.TrimSpace(out)) == 0 {
+			return metrics, nil
+		}
+		if err := json.Unmarshal(out, &metrics); err != nil {
+			return nil, err
+		}
+		return metrics, nil
+	case FormatLine:
+		return parseLines(out)
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+func parseLines(out []byte) ([]model.Metric, error) {
+	var (
+		metrics  []model.Metric
+		firstErr error
+		n        int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m, err := parseLine(line)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("line %d: %w", n, err)
+			}
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	if err := scanner.Err(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return metrics, firstErr
+}
+
+func parseLine(line string) (model.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return model.Metric{}, fmt.Errorf("expected \"name type value\", got %q", line)
+	}
+	m := model.Metric{ID: fields[0], MType: fields[1]}
+	switch m.MType {
+	case "gauge":
+		v, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return model.Metric{}, err
+		}
+		m.Value = &v
+	case "counter":
+		d, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return model.Metric{}, err
+		}
+		m.Delta = &d
+	default:
+		return model.Metric{}, fmt.Errorf("invalid metric type %q", m.MType)
+	}
+	return m, nil
+}
+
+// sanitizeName replaces characters other than letters, digits and underscore.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
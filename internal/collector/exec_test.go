@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		out     string
+		want    int
+		wantErr bool
+	}{
+		{"json", FormatJSON, `[{"id":"a","type":"gauge","value":1.5},{"id":"b","type":"counter","delta":2}]`, 2, false},
+		{"json empty", FormatJSON, "\n", 0, false},
+		{"json invalid", FormatJSON, `{"id":"a"`, 0, true},
+		{"line", FormatLine, "a gauge 1.5\n# comment\n\nb counter 2\n", 2, false},
+		{"line partially invalid", FormatLine, "a gauge 1.5\nb counter 2.5\nc histogram 1\n", 1, true},
+		{"unknown format", "xml", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOutput(tt.format, []byte(tt.out))
+			require.Equal(t, tt.wantErr, err != nil, err)
+			require.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestExecCollector(t *testing.T) {
+	c := NewExecCollector([]config.ExecCommand{
+		{Name: "ok", Command: "sh", Args: []string{"-c", "echo 'disk_free gauge 42.5'; echo 'checks counter 3'"}},
+		{Name: "json", Command: "sh", Args: []string{"-c", `echo '[{"id":"queue","type":"gauge","value":7}]'`}, Format: FormatJSON},
+		{Name: "fail", Command: "sh", Args: []string{"-c", "exit 3"}},
+		{Name: "slow", Command: "sleep", Args: []string{"5"}, Timeout: config.Duration{Duration: 50 * time.Millisecond}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		_, ok := c.GetGauges()["exec_slow_exit_code"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	gauges := c.GetGauges()
+	require.Equal(t, 42.5, gauges["disk_free"])
+	require.Equal(t, float64(7), gauges["queue"])
+	require.Equal(t, float64(0), gauges["exec_ok_exit_code"])
+	require.Equal(t, float64(3), gauges["exec_fail_exit_code"])
+	require.Equal(t, float64(-1), gauges["exec_slow_exit_code"])
+
+	counters := c.GetCounter()
+	require.Equal(t, int64(3), counters["checks"])
+	require.Equal(t, int64(1), counters["exec_fail_failures"])
+	require.Equal(t, int64(1), counters["exec_slow_timeouts"])
+	require.Empty(t, c.GetCounter())
+}
+
+func TestExecTimeoutShell(t *testing.T) {
+	// sleep is started as child of the shell and keeps stdout open after the shell is killed
+	c := NewExecCollector([]config.ExecCommand{
+		{Name: "slow", Command: "sh", Args: []string{"-c", "sleep 10; echo 'done gauge 1'"}, Timeout: config.Duration{Duration: 50 * time.Millisecond}},
+	})
+
+	start := time.Now()
+	c.execute(context.Background(), c.commands[0])
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.Equal(t, float64(-1), c.GetGauges()["exec_slow_exit_code"])
+	require.Equal(t, int64(1), c.GetCounter()["exec_slow_timeouts"])
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+type group struct {
+	members []Collector
+}
+
+var _ Collector = &group{}
+
+// NewGroup - combines several collectors into single one.
+// Gauges with the same name reported by several members are taken from the last one,
+// counter increments are summed.
+func NewGroup(members ...Collector) *group {
+	return &group{members: members}
+}
+
+// Add - adds collector to the group.
+func (g *group) Add(c Collector) {
+	g.members = append(g.members, c)
+}
+
+// Run - starts every member implementing Runner and waits for them to stop.
+func (g *group) Run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	for _, c := range g.members {
+		if r, ok := c.(Runner); ok {
+			wg.Add(1)
+			go func(r Runner) {
+				defer wg.Done()
+				r.Run(ctx)
+			}(r)
+		}
+	}
+	wg.Wait()
+}
+
+// Collect - calls Collect on every member.
+func (g *group) Collect() {
+	for _, c := range g.members {
+		c.Collect()
+	}
+}
+
+// CollectExtra - calls CollectExtra on every member.
+func (g *group) CollectExtra() {
+	for _, c := range g.members {
+		c.CollectExtra()
+	}
+}
+
+// GetGauges - merges gauges of all members.
+func (g *group) GetGauges() map[string]float64 {
+	gauges := make(map[string]float64)
+	for _, c := range g.members {
+		for k, v := range c.GetGauges() {
+			gauges[k] = v
+		}
+	}
+	return gauges
+}
+
+// GetCounter - sums counter increments of all members.
+func (g *group) GetCounter() map[string]int64 {
+	counters := make(map[string]int64)
+	for _, c := range g.members {
+		for k, v := range c.GetCounter() {
+			counters[k] += v
+		}
+	}
+	return counters
+}
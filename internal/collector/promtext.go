@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of Prometheus text exposition format.
+const (
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promHistogram = "histogram"
+	promSummary   = "summary"
+	promUntyped   = "untyped"
+)
+
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+type promFamily struct {
+	name    string
+	typ     string
+	samples []promSample
+}
+
+// parsePrometheusText parses Prometheus text exposition format (version 0.0.4).
+// Families are returned in order of appearance, samples without preceding
+// TYPE line form untyped families.
+func parsePrometheusText(r io.Reader) ([]*promFamily, error) {
+	var (
+		families []*promFamily
+		current  *promFamily
+		n        int
+	)
+	byName := make(map[string]*promFamily)
+
+	family := func(name, typ string) *promFamily {
+		if f, ok := byName[name]; ok {
+			return f
+		}
+		f := &promFamily{name: name, typ: typ}
+		byName[name] = f
+		families = append(families, f)
+		return f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				current = family(fields[2], fields[3])
+				current.typ = fields[3]
+			}
+			continue
+		}
+
+		s, err := parsePromSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		f := current
+		if f == nil || !belongsTo(f, s.name) {
+			f = family(s.name, promUntyped)
+		}
+		f.samples = append(f.samples, s)
+	}
+	return families, scanner.Err()
+}
+
+func belongsTo(f *promFamily, name string) bool {
+	if name == f.name {
+		return true
+	}
+	switch f.typ {
+	case promHistogram:
+		return name == f.name+"_bucket" || name == f.name+"_sum" || name == f.name+"_count"
+	case promSummary:
+		return name == f.name+"_sum" || name == f.name+"_count"
+	}
+	return false
+}
+
+// parsePromSample parses `name{label="value",...} value [timestamp]`.
+func parsePromSample(line string) (promSample, error) {
+	s := promSample{labels: map[string]string{}}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("invalid sample %q", line)
+	}
+	s.name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if rest, err = parsePromLabels(rest[1:], s.labels); err != nil {
+			return s, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return s, fmt.Errorf("invalid sample value in %q", line)
+	}
+	v, err := parsePromValue(fields[0])
+	if err != nil {
+		return s, err
+	}
+	s.value = v
+	return s, nil
+}
+
+// parsePromLabels parses label pairs up to closing brace, returns the remainder.
+func parsePromLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+		eq := strings.Index(s, "=")
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", fmt.Errorf("invalid labels %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+			case c == '"':
+				s = s[i+1:]
+				closed = true
+			default:
+				value.WriteByte(c)
+			}
+			if closed {
+				break
+			}
+		}
+		if !closed {
+			return "", fmt.Errorf("unterminated label value of %q", name)
+		}
+		labels[name] = value.String()
+	}
+}
+
+func parsePromValue(s string) (float64, error) {
+	switch s {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+type pushCollector struct {
+	*Aggregator
+	addr   string
+	labels map[string]string
+}
+
+var (
+	_ Collector = &pushCollector{}
+	_ Runner    = &pushCollector{}
+)
+
+// NewPushCollector - creates local push API listening on addr.
+// Applications post metrics in the same JSON format as accepted by the server
+// on "/update/" and "/updates/", without hash. Labels are added to every
+// pushed metric, unless the metric ID already carries the same label.
+func NewPushCollector(addr string, labels map[string]string) *pushCollector {
+	return &pushCollector{
+		Aggregator: NewAggregator(),
+		addr:       addr,
+		labels:     labels,
+	}
+}
+
+// Run - serves push API until ctx is done.
+func (c *pushCollector) Run(ctx context.Context) {
+	l, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		log.Error().AnErr("Listen", err).Msgf("push API: failed to listen on %s", c.addr)
+		return
+	}
+
+	s := &http.Server{
+		Handler:      c.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Shutdown(sctx); err != nil {
+			log.Error().AnErr("Shutdown", err).Msg("push API")
+		}
+	}()
+
+	log.Info().Msgf("push API listening on: %s", l.Addr())
+	if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().AnErr("Serve", err).Msg("push API")
+	}
+}
+
+// Handler - returns http handler of the push API:
+//
+//	POST /update/  - single metric
+//	POST /updates/ - list of metrics, applied only if all of them are valid
+func (c *pushCollector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update/", func(w http.ResponseWriter, r *http.Request) {
+		metric := model.Metric{}
+		if !c.decode(w, r, &metric) {
+			return
+		}
+		c.apply(w, []model.Metric{metric})
+	})
+	mux.HandleFunc("/updates/", func(w http.ResponseWriter, r *http.Request) {
+		metrics := []model.Metric{}
+		if !c.decode(w, r, &metrics) {
+			return
+		}
+		c.apply(w, metrics)
+	})
+	return mux
+}
+
+func (c *pushCollector) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "invalid content type", http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		log.Debug().AnErr("Decode", err).Msg("push API")
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (c *pushCollector) apply(w http.ResponseWriter, metrics []model.Metric) {
+	for i := range metrics {
+		id, err := model.WithLabels(metrics[i].ID, c.labels)
+		if err == nil {
+			metrics[i].ID = id
+			err = metrics[i].Validate()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, m := range metrics {
+		if err := c.Add(m); err != nil {
+			log.Error().AnErr("Add", err).Msg("push API")
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
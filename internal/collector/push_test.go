@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushCollector(t *testing.T) {
+	c := NewPushCollector("", map[string]string{"host": "web1"})
+	handler := c.Handler()
+
+	tests := []struct {
+		name        string
+		method      string
+		uri         string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"gauge", http.MethodPost, "/update/", "application/json", `{"id":"queue","type":"gauge","value":1.5}`, http.StatusOK},
+		{"gauge overwrite", http.MethodPost, "/update/", "application/json", `{"id":"queue","type":"gauge","value":2.5}`, http.StatusOK},
+		{"counters", http.MethodPost, "/updates/", "application/json",
+			`[{"id":"jobs","type":"counter","delta":2},{"id":"jobs","type":"counter","delta":3}]`, http.StatusOK},
+		{"own label", http.MethodPost, "/update/", "application/json", `{"id":"jobs;host=batch","type":"counter","delta":1}`, http.StatusOK},
+		{"partially invalid", http.MethodPost, "/updates/", "application/json",
+			`[{"id":"jobs","type":"counter","delta":2},{"id":"bad","type":"histogram"}]`, http.StatusBadRequest},
+		{"missing value", http.MethodPost, "/update/", "application/json", `{"id":"queue","type":"gauge"}`, http.StatusBadRequest},
+		{"invalid json", http.MethodPost, "/update/", "application/json", `{"id":`, http.StatusBadRequest},
+		{"content type", http.MethodPost, "/update/", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"method", http.MethodGet, "/update/", "", ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.uri, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tt.code, rr.Code)
+		})
+	}
+
+	require.Equal(t, map[string]float64{"queue;host=web1": 2.5}, c.GetGauges())
+	require.Equal(t, map[string]int64{"jobs;host=web1": 5, "jobs;host=batch": 1}, c.GetCounter())
+}
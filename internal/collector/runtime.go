@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"runtime/metrics"
+	"strings"
+	"sync"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+type runtimeCollector struct {
+	samples    []metrics.Sample
+	mu         sync.RWMutex
+	gauges     map[string]float64
+	counters   cumulative
+	primed     bool
+	histograms map[string]model.Histogram
+}
+
+var _ Collector = &runtimeCollector{}
+
+// NewRuntimeCollector - creates collector reading every metric supported by runtime/metrics.
+// Unlike Collect of the default collector it does not stop the world and
+// does not rely on a hand-maintained list of fields.
+func NewRuntimeCollector() *runtimeCollector {
+	c := &runtimeCollector{
+		gauges:     make(map[string]float64),
+		counters:   newCumulative(),
+		histograms: make(map[string]model.Histogram),
+	}
+	for _, d := range metrics.All() {
+		if d.Kind == metrics.KindBad {
+			continue
+		}
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+	}
+	return c
+}
+
+// Collect - reads all supported runtime metrics.
+// Cumulative uint64 metrics are treated as counters, other scalars as gauges.
+func (c *runtimeCollector) Collect() {
+	metrics.Read(c.samples)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.samples {
+		name := RuntimeMetricName(s.Name)
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			if isCumulative(s.Name) {
+				c.counters.set(name, s.Value.Uint64())
+			} else {
+				c.gauges[name] = float64(s.Value.Uint64())
+			}
+		case metrics.KindFloat64:
+			c.gauges[name] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			c.histograms[name] = model.Histogram{
+				Bounds: append([]float64(nil), h.Buckets...),
+				Counts: append([]uint64(nil), h.Counts...),
+			}
+		}
+	}
+	// totals accumulated before the first poll are not reported,
+	// otherwise every restart adds process lifetime totals to server counters.
+	if !c.primed {
+		c.counters.baseline()
+		c.primed = true
+	}
+}
+
+// CollectExtra - runtime collector has no additional metrics.
+func (c *runtimeCollector) CollectExtra() {}
+
+// GetGauges - returns scalar gauges together with flattened histograms.
+func (c *runtimeCollector) GetGauges() map[string]float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	gauges := make(map[string]float64, len(c.gauges))
+	for k, v := range c.gauges {
+		gauges[k] = v
+	}
+	for k, h := range c.histograms {
+		for hk, hv := range h.Gauges(k) {
+			gauges[hk] = hv
+		}
+	}
+	return gauges
+}
+
+// GetCounter - returns increments of cumulative metrics since the previous call,
+// starting from the first poll.
+func (c *runtimeCollector) GetCounter() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counters.deltas()
+}
+
+// GetHistograms - returns copy of collected histograms.
+func (c *runtimeCollector) GetHistograms() map[string]model.Histogram {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	histograms := make(map[string]model.Histogram, len(c.histograms))
+	for k, v := range c.histograms {
+		histograms[k] = v
+	}
+	return histograms
+}
+
+// RuntimeMetricName - converts runtime/metrics key to metric name
+// e.g. "/sched/latencies:seconds" becomes "sched_latencies_seconds".
+func RuntimeMetricName(key string) string {
+	return sanitizeName(strings.TrimPrefix(key, "/"))
+}
+
+var descriptions = func() map[string]metrics.Description {
+	all := make(map[string]metrics.Description)
+	for _, d := range metrics.All() {
+		all[d.Name] = d
+	}
+	return all
+}()
+
+func isCumulative(key string) bool {
+	return descriptions[key].Cumulative
+}
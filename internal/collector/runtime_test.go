@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"/sched/latencies:seconds", "sched_latencies_seconds"},
+		{"/gc/pauses:seconds", "gc_pauses_seconds"},
+		{"/memory/classes/heap/objects:bytes", "memory_classes_heap_objects_bytes"},
+		{"/cpu/classes/gc/mark/assist:cpu-seconds", "cpu_classes_gc_mark_assist_cpu_seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			require.Equal(t, tt.want, RuntimeMetricName(tt.key))
+		})
+	}
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	c := NewRuntimeCollector()
+	c.Collect()
+
+	gauges := c.GetGauges()
+	require.Contains(t, gauges, "memory_classes_heap_objects_bytes")
+	require.Contains(t, gauges, "sched_latencies_seconds_count")
+	require.Contains(t, gauges, "sched_latencies_seconds_p99")
+	require.Contains(t, c.GetHistograms(), "gc_pauses_seconds")
+
+	counters := c.GetCounter()
+	require.Contains(t, counters, "gc_heap_allocs_objects")
+	// totals before the first poll are the baseline
+	require.Zero(t, counters["gc_heap_allocs_objects"])
+
+	runtime.GC()
+	c.Collect()
+	counters = c.GetCounter()
+	require.GreaterOrEqual(t, counters["gc_cycles_total_gc_cycles"], int64(1))
+}
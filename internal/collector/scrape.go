@@ -0,0 +1,309 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+const (
+	defaultScrapeInterval = 15 * time.Second
+	defaultScrapeTimeout  = 10 * time.Second
+)
+
+type scrapeCollector struct {
+	client  *http.Client
+	targets []config.ScrapeTarget
+
+	mu       sync.Mutex
+	gauges   map[string]map[string]float64 // gauges of the last scrape by target
+	counters cumulative
+}
+
+var (
+	_ Collector = &scrapeCollector{}
+	_ Runner    = &scrapeCollector{}
+)
+
+// NewScrapeCollector - creates collector scraping Prometheus text format endpoints.
+// Every sample is labelled with instance of the target. Counters are reported
+// as increments (fractional values rounded), histograms are flattened into
+// <name>_count, _sum and quantile gauges, summaries into _count, _sum and
+// their quantile gauges. For every target scrape_up and scrape_duration
+// gauges are reported.
+func NewScrapeCollector(targets []config.ScrapeTarget) *scrapeCollector {
+	c := &scrapeCollector{
+		client:   &http.Client{},
+		gauges:   make(map[string]map[string]float64),
+		counters: newCumulative(),
+	}
+	for _, t := range targets {
+		if t.Interval.Duration <= 0 {
+			t.Interval.Duration = defaultScrapeInterval
+		}
+		if t.Timeout.Duration <= 0 {
+			t.Timeout.Duration = defaultScrapeTimeout
+		}
+		c.targets = append(c.targets, t)
+	}
+	return c
+}
+
+// Run - scrapes every target on its own ticker until ctx is done.
+func (c *scrapeCollector) Run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+	for _, t := range c.targets {
+		wg.Add(1)
+		go func(t config.ScrapeTarget) {
+			defer wg.Done()
+			ticker := time.NewTicker(t.Interval.Duration)
+			defer ticker.Stop()
+			for {
+				c.Scrape(ctx, t)
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+// Scrape - scrapes single target and replaces its gauges.
+func (c *scrapeCollector) Scrape(ctx context.Context, t config.ScrapeTarget) {
+	instance := t.URL
+	if u, err := url.Parse(t.URL); err == nil && u.Host != "" {
+		instance = u.Host
+	}
+	status := map[string]string{"instance": instance}
+
+	start := time.Now()
+	families, err := c.fetch(ctx, t)
+	duration := time.Since(start).Seconds()
+
+	gauges := make(map[string]float64)
+	if err != nil {
+		log.Error().AnErr("fetch", err).Str("target", t.URL).Msg("ScrapeCollector")
+		gauges[model.SeriesID("scrape_up", status)] = 0
+	} else {
+		gauges[model.SeriesID("scrape_up", status)] = 1
+	}
+	gauges[model.SeriesID("scrape_duration", status)] = duration
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range families {
+		if !matchFilters(f.name, t.Include, t.Exclude) {
+			continue
+		}
+		c.convert(f, instance, gauges)
+	}
+	c.gauges[t.URL] = gauges
+}
+
+func (c *scrapeCollector) fetch(ctx context.Context, t config.ScrapeTarget) ([]*promFamily, error) {
+	lctx, cancel := context.WithTimeout(ctx, t.Timeout.Duration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(lctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return parsePrometheusText(resp.Body)
+}
+
+// convert maps samples of family to gauges and cumulative counters.
+func (c *scrapeCollector) convert(f *promFamily, instance string, gauges map[string]float64) {
+	withInstance := func(labels map[string]string) map[string]string {
+		l := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			l[k] = v
+		}
+		l["instance"] = instance
+		return l
+	}
+
+	switch f.typ {
+	case promCounter:
+		for _, s := range f.samples {
+			if s.value < 0 || math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+				continue
+			}
+			c.counters.set(model.SeriesID(sanitizeName(s.name), withInstance(s.labels)), uint64(math.Round(s.value)))
+		}
+	case promHistogram:
+		for _, h := range groupHistogram(f) {
+			for k, v := range h.hist.Gauges(sanitizeName(f.name)) {
+				gauges[model.SeriesID(k, withInstance(h.labels))] = v
+			}
+		}
+	case promSummary:
+		for _, s := range f.samples {
+			name := sanitizeName(s.name)
+			labels := withInstance(s.labels)
+			if q, ok := s.labels["quantile"]; ok {
+				delete(labels, "quantile")
+				qv, err := strconv.ParseFloat(q, 64)
+				if err != nil {
+					continue
+				}
+				name = fmt.Sprintf("%s_p%d", name, int(math.Round(qv*100)))
+			}
+			setFinite(gauges, model.SeriesID(name, labels), s.value)
+		}
+	default:
+		for _, s := range f.samples {
+			setFinite(gauges, model.SeriesID(sanitizeName(s.name), withInstance(s.labels)), s.value)
+		}
+	}
+}
+
+func setFinite(gauges map[string]float64, id string, v float64) {
+	if !math.IsNaN(v) && !math.IsInf(v, 0) {
+		gauges[id] = v
+	}
+}
+
+type labelledHistogram struct {
+	labels map[string]string
+	hist   model.Histogram
+}
+
+type promBucket struct {
+	le    float64
+	count float64
+}
+
+// groupHistogram builds histogram for every label set of the family,
+// cumulative "le" buckets are converted into per bucket counts.
+func groupHistogram(f *promFamily) []labelledHistogram {
+	type series struct {
+		labels  map[string]string
+		buckets []promBucket
+		sum     float64
+	}
+	bySeries := make(map[string]*series)
+	var order []string
+
+	get := func(labels map[string]string) *series {
+		l := make(map[string]string, len(labels))
+		for k, v := range labels {
+			if k != "le" {
+				l[k] = v
+			}
+		}
+		id := model.SeriesID("", l)
+		if s, ok := bySeries[id]; ok {
+			return s
+		}
+		s := &series{labels: l}
+		bySeries[id] = s
+		order = append(order, id)
+		return s
+	}
+
+	for _, s := range f.samples {
+		switch s.name {
+		case f.name + "_bucket":
+			le, err := parsePromValue(s.labels["le"])
+			if err != nil {
+				continue
+			}
+			sr := get(s.labels)
+			sr.buckets = append(sr.buckets, promBucket{le: le, count: s.value})
+		case f.name + "_sum":
+			get(s.labels).sum = s.value
+		}
+	}
+
+	result := make([]labelledHistogram, 0, len(order))
+	for _, id := range order {
+		s := bySeries[id]
+		sort.Slice(s.buckets, func(i, j int) bool { return s.buckets[i].le < s.buckets[j].le })
+
+		h := model.Histogram{Bounds: []float64{math.Inf(-1)}, Sum: s.sum}
+		var prev float64
+		for _, b := range s.buckets {
+			count := b.count - prev
+			if count < 0 {
+				count = 0
+			}
+			prev = b.count
+			h.Bounds = append(h.Bounds, b.le)
+			h.Counts = append(h.Counts, uint64(math.Round(count)))
+		}
+		result = append(result, labelledHistogram{labels: s.labels, hist: h})
+	}
+	return result
+}
+
+// matchFilters checks name against include and exclude glob patterns,
+// empty include list matches every name.
+func matchFilters(name string, include, exclude []string) bool {
+	matched := len(include) == 0
+	for _, p := range include {
+		if ok, _ := path.Match(p, name); ok {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, p := range exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Collect - targets are scraped by Run.
+func (c *scrapeCollector) Collect() {}
+
+// CollectExtra - targets are scraped by Run.
+func (c *scrapeCollector) CollectExtra() {}
+
+// GetGauges - returns gauges of the last scrape of every target.
+func (c *scrapeCollector) GetGauges() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	gauges := make(map[string]float64)
+	for _, tg := range c.gauges {
+		for k, v := range tg {
+			gauges[k] = v
+		}
+	}
+	return gauges
+}
+
+// GetCounter - returns counter increments since the previous call.
+func (c *scrapeCollector) GetCounter() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counters.deltas()
+}
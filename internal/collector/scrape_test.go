@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+const exposition = `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027
+http_requests_total{method="post",code="200"} 3 1395066363000
+# TYPE temperature gauge
+temperature 21.5
+untyped_metric{path="/a\"b"} 7
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} 50
+request_duration_seconds_bucket{le="0.5"} 90
+request_duration_seconds_bucket{le="+Inf"} 100
+request_duration_seconds_sum 23.5
+request_duration_seconds_count 100
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.2
+rpc_seconds{quantile="0.99"} 1.5
+rpc_seconds_sum 40
+rpc_seconds_count 120
+# TYPE go_goroutines gauge
+go_goroutines 12
+`
+
+func TestParsePrometheusText(t *testing.T) {
+	families, err := parsePrometheusText(strings.NewReader(exposition))
+	require.NoError(t, err)
+
+	types := map[string]string{}
+	for _, f := range families {
+		types[f.name] = f.typ
+	}
+	require.Equal(t, map[string]string{
+		"http_requests_total":      promCounter,
+		"temperature":              promGauge,
+		"untyped_metric":           promUntyped,
+		"request_duration_seconds": promHistogram,
+		"rpc_seconds":              promSummary,
+		"go_goroutines":            promGauge,
+	}, types)
+	require.Equal(t, `/a"b`, families[2].samples[0].labels["path"])
+
+	_, err = parsePrometheusText(strings.NewReader(`broken{label="x} 1`))
+	require.Error(t, err)
+}
+
+func TestScrapeCollector(t *testing.T) {
+	var body = exposition
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	target := config.ScrapeTarget{URL: srv.URL + "/metrics", Exclude: []string{"go_*"}}
+	instance := strings.TrimPrefix(srv.URL, "http://")
+	id := func(name string, labels ...string) string {
+		l := map[string]string{"instance": instance}
+		for _, kv := range labels {
+			k, v, _ := strings.Cut(kv, "=")
+			l[k] = v
+		}
+		return model.SeriesID(name, l)
+	}
+
+	c := NewScrapeCollector([]config.ScrapeTarget{target})
+	c.Scrape(context.Background(), c.targets[0])
+
+	gauges := c.GetGauges()
+	require.Equal(t, float64(1), gauges[id("scrape_up")])
+	require.Equal(t, 21.5, gauges[id("temperature")])
+	require.Equal(t, float64(7), gauges[id("untyped_metric", `path=/a"b`)])
+	require.Equal(t, float64(100), gauges[id("request_duration_seconds_count")])
+	require.Equal(t, 23.5, gauges[id("request_duration_seconds_sum")])
+	require.Equal(t, 0.1, gauges[id("request_duration_seconds_p50")])
+	require.Equal(t, 0.5, gauges[id("request_duration_seconds_p90")])
+	require.Equal(t, 1.5, gauges[id("rpc_seconds_p99")])
+	require.Equal(t, float64(120), gauges[id("rpc_seconds_count")])
+	require.NotContains(t, gauges, id("go_goroutines"))
+
+	counters := c.GetCounter()
+	require.Equal(t, int64(1027), counters[id("http_requests_total", "code=200", "method=get")])
+
+	body = strings.Replace(exposition, "1027", "1030", 1)
+	c.Scrape(context.Background(), c.targets[0])
+	counters = c.GetCounter()
+	require.Equal(t, int64(3), counters[id("http_requests_total", "code=200", "method=get")])
+
+	srv.Close()
+	c.Scrape(context.Background(), c.targets[0])
+	require.Equal(t, float64(0), c.GetGauges()[id("scrape_up")])
+}
+
+func TestMatchFilters(t *testing.T) {
+	require.True(t, matchFilters("go_goroutines", nil, nil))
+	require.True(t, matchFilters("go_goroutines", []string{"go_*"}, nil))
+	require.False(t, matchFilters("process_cpu", []string{"go_*"}, nil))
+	require.False(t, matchFilters("go_goroutines", nil, []string{"go_*"}))
+}
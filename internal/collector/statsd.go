@@ -0,0 +1,277 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+const statsdMaxPacket = 64 * 1024
+
+// StatsdSample - single parsed StatsD line "<name>:<value>|<type>[|@<rate>][|#<tags>]".
+type StatsdSample struct {
+	Name     string
+	Value    float64
+	Type     string // c, g, ms, h or s
+	Rate     float64
+	Relative bool   // gauge value prefixed with sign, applied as delta
+	Raw      string // raw value, used for sets
+}
+
+type statsdCollector struct {
+	*Aggregator
+	addr   string
+	socket string
+
+	mu     sync.Mutex
+	timers map[string][]float64
+	counts map[string]float64  // timer samples count adjusted by sample rate
+	sums   map[string]float64  // counter increments adjusted by sample rate
+	seen   map[string]struct{} // timers reported at least once
+	sets   map[string]map[string]struct{}
+	stats  map[string]float64
+}
+
+var (
+	_ Collector = &statsdCollector{}
+	_ Runner    = &statsdCollector{}
+)
+
+// NewStatsdCollector - creates StatsD listener on UDP address addr and/or
+// unixgram socket path, empty values disable corresponding listener.
+// Counters are summed and gauges are last-write-wins between reports,
+// timers are reported as <name>_count, _min, _max, _mean and quantiles.
+func NewStatsdCollector(addr, socket string) *statsdCollector {
+	return &statsdCollector{
+		Aggregator: NewAggregator(),
+		addr:       addr,
+		socket:     socket,
+		timers:     make(map[string][]float64),
+		counts:     make(map[string]float64),
+		sums:       make(map[string]float64),
+		seen:       make(map[string]struct{}),
+		sets:       make(map[string]map[string]struct{}),
+		stats:      make(map[string]float64),
+	}
+}
+
+// Run - listens for StatsD packets until ctx is done.
+func (c *statsdCollector) Run(ctx context.Context) {
+	var conns []net.PacketConn
+	if c.addr != "" {
+		conn, err := net.ListenPacket("udp", c.addr)
+		if err != nil {
+			log.Error().AnErr("ListenPacket", err).Msgf("StatsD: failed to listen on %s", c.addr)
+		} else {
+			log.Info().Msgf("StatsD listening on udp: %s", conn.LocalAddr())
+			conns = append(conns, conn)
+		}
+	}
+	if c.socket != "" {
+		if err := os.Remove(c.socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().AnErr("Remove", err).Msg("StatsD: stale socket")
+		}
+		conn, err := net.ListenPacket("unixgram", c.socket)
+		if err != nil {
+			log.Error().AnErr("ListenPacket", err).Msgf("StatsD: failed to listen on %s", c.socket)
+		} else {
+			log.Info().Msgf("StatsD listening on unixgram: %s", c.socket)
+			conns = append(conns, conn)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn net.PacketConn) {
+			defer wg.Done()
+			c.serve(conn)
+		}(conn)
+	}
+
+	<-ctx.Done()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	wg.Wait()
+	if c.socket != "" {
+		os.Remove(c.socket)
+	}
+}
+
+func (c *statsdCollector) serve(conn net.PacketConn) {
+	buf := make([]byte, statsdMaxPacket)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().AnErr("ReadFrom", err).Msg("StatsD")
+			}
+			return
+		}
+		c.Handle(buf[:n])
+	}
+}
+
+// Handle - applies all lines of single StatsD packet.
+func (c *statsdCollector) Handle(packet []byte) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		s, err := ParseStatsd(line)
+		if err != nil {
+			log.Debug().AnErr("ParseStatsd", err).Msg("StatsD")
+			continue
+		}
+		c.apply(s)
+	}
+}
+
+func (c *statsdCollector) apply(s StatsdSample) {
+	switch s.Type {
+	case "c":
+		c.mu.Lock()
+		c.sums[s.Name] += s.Value / s.Rate
+		c.mu.Unlock()
+	case "g":
+		if s.Relative {
+			c.AddGauge(s.Name, s.Value)
+			return
+		}
+		c.SetGauge(s.Name, s.Value)
+	case "ms", "h":
+		c.mu.Lock()
+		c.timers[s.Name] = append(c.timers[s.Name], s.Value)
+		c.counts[s.Name] += 1 / s.Rate
+		c.mu.Unlock()
+	case "s":
+		c.mu.Lock()
+		if c.sets[s.Name] == nil {
+			c.sets[s.Name] = make(map[string]struct{})
+		}
+		c.sets[s.Name][s.Raw] = struct{}{}
+		c.mu.Unlock()
+	}
+}
+
+// GetCounter - returns counter increments received since the previous call,
+// sampled increments are summed and rounded once.
+func (c *statsdCollector) GetCounter() map[string]int64 {
+	counters := c.Aggregator.GetCounter()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, sum := range c.sums {
+		counters[name] += int64(math.Round(sum))
+		delete(c.sums, name)
+	}
+	return counters
+}
+
+// GetGauges - returns gauges together with timer and set statistics
+// of the samples received since the previous call.
+func (c *statsdCollector) GetGauges() map[string]float64 {
+	gauges := c.Aggregator.GetGauges()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.seen {
+		if _, ok := c.timers[name]; !ok {
+			c.stats[name+"_count"] = 0
+		}
+	}
+	for name, values := range c.timers {
+		c.seen[name] = struct{}{}
+		for k, v := range timerStats(name, values) {
+			c.stats[k] = v
+		}
+		c.stats[name+"_count"] = c.counts[name]
+		delete(c.timers, name)
+		delete(c.counts, name)
+	}
+	for name, set := range c.sets {
+		c.stats[name] = float64(len(set))
+		delete(c.sets, name)
+	}
+	for k, v := range c.stats {
+		gauges[k] = v
+	}
+	return gauges
+}
+
+func timerStats(name string, values []float64) map[string]float64 {
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	stats := map[string]float64{
+		name + "_min":  values[0],
+		name + "_max":  values[len(values)-1],
+		name + "_mean": sum / float64(len(values)),
+	}
+	for _, q := range model.Quantiles {
+		idx := int(math.Ceil(q*float64(len(values)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		stats[fmt.Sprintf("%s_p%d", name, int(math.Round(q*100)))] = values[idx]
+	}
+	return stats
+}
+
+// ParseStatsd - parses single StatsD line.
+func ParseStatsd(line string) (StatsdSample, error) {
+	s := StatsdSample{Rate: 1}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return s, fmt.Errorf("invalid statsd line %q", line)
+	}
+	s.Name = sanitizeName(name)
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return s, fmt.Errorf("metric type is missing in %q", line)
+	}
+	s.Raw, s.Type = parts[0], parts[1]
+
+	for _, p := range parts[2:] {
+		if strings.HasPrefix(p, "@") {
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return s, fmt.Errorf("invalid sample rate in %q", line)
+			}
+			s.Rate = rate
+		}
+	}
+
+	switch s.Type {
+	case "s":
+		return s, nil
+	case "c", "g", "ms", "h":
+	default:
+		return s, fmt.Errorf("unsupported metric type %q", s.Type)
+	}
+
+	v, err := strconv.ParseFloat(s.Raw, 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value in %q: %w", line, err)
+	}
+	s.Value = v
+	s.Relative = s.Type == "g" && (strings.HasPrefix(s.Raw, "+") || strings.HasPrefix(s.Raw, "-"))
+	return s, nil
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsd(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    StatsdSample
+		wantErr bool
+	}{
+		{"hits:1|c", StatsdSample{Name: "hits", Value: 1, Type: "c", Rate: 1, Raw: "1"}, false},
+		{"hits:1|c|@0.1", StatsdSample{Name: "hits", Value: 1, Type: "c", Rate: 0.1, Raw: "1"}, false},
+		{"temp:12.5|g", StatsdSample{Name: "temp", Value: 12.5, Type: "g", Rate: 1, Raw: "12.5"}, false},
+		{"temp:-2|g", StatsdSample{Name: "temp", Value: -2, Type: "g", Rate: 1, Raw: "-2", Relative: true}, false},
+		{"app.latency:320|ms|#env:prod", StatsdSample{Name: "app_latency", Value: 320, Type: "ms", Rate: 1, Raw: "320"}, false},
+		{"users:bob|s", StatsdSample{Name: "users", Type: "s", Rate: 1, Raw: "bob"}, false},
+		{"hits", StatsdSample{}, true},
+		{"hits:1", StatsdSample{}, true},
+		{"hits:x|c", StatsdSample{}, true},
+		{"hits:1|c|@2", StatsdSample{}, true},
+		{"hits:1|d", StatsdSample{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseStatsd(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStatsdAggregation(t *testing.T) {
+	c := NewStatsdCollector("", "")
+	c.Handle([]byte("hits:1|c\nhits:2|c|@0.5\ntemp:10|g\ntemp:+5|g\nbad line\n"))
+	c.Handle([]byte("lat:100|ms\nlat:300|ms\nlat:200|ms\nusers:a|s\nusers:b|s\nusers:a|s"))
+
+	counters := c.GetCounter()
+	require.Equal(t, int64(5), counters["hits"])
+
+	// sampled increments are rounded once per report
+	c.Handle([]byte("sampled:1|c|@0.3\nsampled:1|c|@0.3\nsampled:1|c|@0.3"))
+	require.Equal(t, int64(10), c.GetCounter()["sampled"])
+	require.Empty(t, c.GetCounter())
+
+	gauges := c.GetGauges()
+	require.Equal(t, float64(15), gauges["temp"])
+	require.Equal(t, float64(3), gauges["lat_count"])
+	require.Equal(t, float64(100), gauges["lat_min"])
+	require.Equal(t, float64(300), gauges["lat_max"])
+	require.Equal(t, float64(200), gauges["lat_mean"])
+	require.Equal(t, float64(200), gauges["lat_p50"])
+	require.Equal(t, float64(2), gauges["users"])
+
+	gauges = c.GetGauges()
+	require.Equal(t, float64(0), gauges["lat_count"])
+}
+
+func TestStatsdListener(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "statsd.sock")
+	c := NewStatsdCollector("127.0.0.1:0", socket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("unixgram", socket)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("requests:3|c"))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return c.GetCounter()["requests"] == 3
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
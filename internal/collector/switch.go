@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// Switch - collector delegating to collector replaced at runtime,
+// e.g. collectors configured remotely by server.
+type Switch struct {
+	mu      sync.RWMutex
+	current Collector
+	changed chan struct{}
+}
+
+var (
+	_ Collector = &Switch{}
+	_ Runner    = &Switch{}
+)
+
+// NewSwitch - creates switch without collector.
+func NewSwitch() *Switch {
+	return &Switch{changed: make(chan struct{})}
+}
+
+// Set - replaces collector, nil disables collection. Runner of the previous
+// collector is stopped and runner of c is started by Run.
+func (s *Switch) Set(c Collector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = c
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Run - runs the current collector implementing Runner and restarts it
+// every time collector is replaced until ctx is done.
+func (s *Switch) Run(ctx context.Context) {
+	for {
+		s.mu.RLock()
+		c, changed := s.current, s.changed
+		s.mu.RUnlock()
+
+		lctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if r, ok := c.(Runner); ok {
+				r.Run(lctx)
+			}
+		}()
+
+		select {
+		case <-changed:
+			cancel()
+			<-done
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		}
+	}
+}
+
+func (s *Switch) get() Collector {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Collect - calls Collect of the current collector.
+func (s *Switch) Collect() {
+	if c := s.get(); c != nil {
+		c.Collect()
+	}
+}
+
+// CollectExtra - calls CollectExtra of the current collector.
+func (s *Switch) CollectExtra() {
+	if c := s.get(); c != nil {
+		c.CollectExtra()
+	}
+}
+
+// GetGauges - returns gauges of the current collector.
+func (s *Switch) GetGauges() map[string]float64 {
+	if c := s.get(); c != nil {
+		return c.GetGauges()
+	}
+	return map[string]float64{}
+}
+
+// GetCounter - returns counters of the current collector.
+func (s *Switch) GetCounter() map[string]int64 {
+	if c := s.get(); c != nil {
+		return c.GetCounter()
+	}
+	return map[string]int64{}
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type runCounter struct {
+	*Aggregator
+	mu      sync.Mutex
+	running bool
+	runs    int
+}
+
+func (c *runCounter) Run(ctx context.Context) {
+	c.mu.Lock()
+	c.running = true
+	c.runs++
+	c.mu.Unlock()
+	<-ctx.Done()
+	c.mu.Lock()
+	c.running = false
+	c.mu.Unlock()
+}
+
+func (c *runCounter) state() (bool, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running, c.runs
+}
+
+func TestSwitch(t *testing.T) {
+	s := NewSwitch()
+	require.Empty(t, s.GetGauges())
+	require.Empty(t, s.GetCounter())
+	s.Collect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	first := &runCounter{Aggregator: NewAggregator()}
+	first.SetGauge("first", 1)
+	s.Set(first)
+	require.Eventually(t, func() bool { running, _ := first.state(); return running }, time.Second, time.Millisecond)
+	require.Equal(t, map[string]float64{"first": 1}, s.GetGauges())
+
+	second := &runCounter{Aggregator: NewAggregator()}
+	s.Set(second)
+	require.Eventually(t, func() bool {
+		running, _ := first.state()
+		started, _ := second.state()
+		return !running && started
+	}, time.Second, time.Millisecond)
+	require.Empty(t, s.GetGauges())
+
+	cancel()
+	<-done
+	running, runs := second.state()
+	require.False(t, running)
+	require.Equal(t, 1, runs)
+}
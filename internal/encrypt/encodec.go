@@ -5,6 +5,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // Name is the name registered for the proto compressor.
@@ -61,3 +62,53 @@ func (e Encodec) Unmarshal(data []byte, v interface{}) (err error) {
 func (Encodec) Name() string {
 	return Name
 }
+
+// ServerCodec - gRPC server codec decrypting messages of Encodec clients, messages
+// which can not be decrypted are rejected. Only messages named in Plain, e.g. requests
+// of OTLP exporters, which do not encrypt them, are decoded as is in that case.
+// It is set per server with grpc.ForceServerCodec, so other servers and clients
+// of the process are not affected.
+type ServerCodec struct {
+	Dec   Decrypter
+	Plain []protoreflect.FullName
+}
+
+// Marshal encodes message without encryption.
+func (c ServerCodec) Marshal(v interface{}) ([]byte, error) {
+	return Encodec{}.Marshal(v)
+}
+
+// Unmarshal decrypts message and decodes result. If Dec is nil, decryption is omitted.
+func (c ServerCodec) Unmarshal(data []byte, v interface{}) error {
+	if c.Dec != nil {
+		plain, err := c.Dec.Decrypt(data)
+		switch {
+		case err == nil:
+			data = plain
+		case !c.plain(v):
+			return err
+		default:
+			log.Debug().AnErr("Decrypt", err).Msg("ServerCodec: message is decoded as is")
+		}
+	}
+	return Encodec{}.Unmarshal(data, v)
+}
+
+// plain reports whether message v is accepted without encryption.
+func (c ServerCodec) plain(v interface{}) bool {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return false
+	}
+	name := proto.MessageName(m)
+	for _, n := range c.Plain {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (ServerCodec) Name() string {
+	return Name
+}
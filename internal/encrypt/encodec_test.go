@@ -0,0 +1,62 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+// prefixCrypto - test encrypter marking payload with prefix.
+type prefixCrypto struct{}
+
+var prefix = []byte("enc:")
+
+func (prefixCrypto) Encrypt(b []byte) ([]byte, error) {
+	return append(append([]byte{}, prefix...), b...), nil
+}
+
+func (prefixCrypto) Decrypt(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, prefix) {
+		return nil, errors.New("decryption error")
+	}
+	return b[len(prefix):], nil
+}
+
+func TestServerCodec(t *testing.T) {
+	codec := ServerCodec{
+		Dec:   prefixCrypto{},
+		Plain: []protoreflect.FullName{proto.MessageName(&colpb.ExportMetricsServiceRequest{})},
+	}
+	msg := &pb.Metric{Id: "Alloc", Mtype: pb.Metric_GAUGE, Value: 1.5}
+
+	encrypted, err := Encodec{Enc: prefixCrypto{}}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got pb.Metric
+	if err := codec.Unmarshal(encrypted, &got); err != nil || got.Id != "Alloc" {
+		t.Errorf("Unmarshal() of encrypted message = %v, %v", got.Id, err)
+	}
+
+	plain, err := Encodec{}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Unmarshal(plain, &pb.Metric{}); err == nil {
+		t.Error("Unmarshal() of plain message, error expected")
+	}
+
+	export, err := Encodec{}.Marshal(&colpb.ExportMetricsServiceRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Unmarshal(export, &colpb.ExportMetricsServiceRequest{}); err != nil {
+		t.Errorf("Unmarshal() of plain OTLP request error = %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/sha512"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"os"
 
 	"github.com/rs/zerolog/log"
@@ -18,11 +19,13 @@ type encrypt struct {
 	key any
 }
 
-func New(path string) *encrypt {
-	key := readKeyFile(path)
-	return &encrypt{
-		key: key,
+// Load - creates encrypter or decrypter with public or private key read from PEM file at path.
+func Load(path string) (*encrypt, error) {
+	key, err := loadKeyFile(path)
+	if err != nil {
+		return nil, err
 	}
+	return &encrypt{key: key}, nil
 }
 
 func (e encrypt) Encrypt(b []byte) ([]byte, error) {
@@ -80,34 +83,23 @@ func (e encrypt) Decrypt(b []byte) ([]byte, error) {
 	return plainBytes, nil
 }
 
-func readKeyFile(path string) any {
-	var key any
+func loadKeyFile(path string) (any, error) {
 	pemBytes, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatal().Msg(err.Error())
+		return nil, err
 	}
 
 	block, _ := pem.Decode(pemBytes)
 	if block == nil {
-		log.Fatal().Msg("failed to decode PEM block")
+		return nil, errors.New("failed to decode PEM block")
 	}
 
-	if block != nil {
-		switch block.Type {
-		case "RSA PRIVATE KEY":
-			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
-			if err != nil {
-				log.Fatal().Msg(err.Error())
-			}
-		case "PUBLIC KEY":
-			key, err = x509.ParsePKIXPublicKey(block.Bytes)
-			if err != nil {
-				log.Fatal().Msg(err.Error())
-			}
-		default:
-			log.Fatal().Msg("not supported PEM block")
-		}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errors.New("not supported PEM block")
 	}
-
-	return key
 }
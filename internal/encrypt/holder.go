@@ -0,0 +1,35 @@
+package encrypt
+
+import "sync"
+
+// Holder - Decrypter delegating to decrypter replaced at runtime,
+// payload is passed unchanged while no decrypter is set.
+type Holder struct {
+	mu  sync.RWMutex
+	dec Decrypter
+}
+
+var _ Decrypter = &Holder{}
+
+// NewHolder - creates holder of decrypter d, nil disables decryption.
+func NewHolder(d Decrypter) *Holder {
+	return &Holder{dec: d}
+}
+
+// Set - replaces decrypter, nil disables decryption.
+func (h *Holder) Set(d Decrypter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dec = d
+}
+
+// Decrypt - decrypts b with the current decrypter.
+func (h *Holder) Decrypt(b []byte) ([]byte, error) {
+	h.mu.RLock()
+	d := h.dec
+	h.mu.RUnlock()
+	if d == nil {
+		return b, nil
+	}
+	return d.Decrypt(b)
+}
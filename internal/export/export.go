@@ -0,0 +1,96 @@
+// Package export implements forwarding of metric updates to downstream storages.
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Exporter types.
+const (
+	TypeRemoteWrite = "remote_write"
+	TypeInflux      = "influx"
+)
+
+// Sample - single successful update forwarded to exporters.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Type   string    // "gauge" or "counter"
+	Value  float64   // gauge value or counter total after update
+	Time   time.Time // time of update
+}
+
+// Exporter - sends batch of samples to downstream storage.
+// Errors wrapped by Permanent are not retried.
+type Exporter interface {
+	Export(ctx context.Context, samples []Sample) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent - marks error as not retryable.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent - reports whether err is marked as not retryable.
+func IsPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe)
+}
+
+// New - creates exporter of cfg.Type.
+func New(cfg config.ExporterConfig) (Exporter, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("exporter %s: empty url", cfg.Name)
+	}
+	switch cfg.Type {
+	case TypeRemoteWrite:
+		return NewRemoteWrite(cfg.URL, cfg.Headers), nil
+	case TypeInflux:
+		return NewInflux(cfg.URL, cfg.Headers), nil
+	}
+	return nil, fmt.Errorf("exporter %s: unknown type %q", cfg.Name, cfg.Type)
+}
+
+// post sends body to url, 429 and 5xx responses and transport errors are
+// retryable, other unsuccessful responses are permanent errors.
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5 {
+		return err
+	}
+	return Permanent(err)
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// fields splits protobuf message into fields by number.
+func fields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	res := make(map[protowire.Number][][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			n = 8
+			v = b[:8]
+		case protowire.VarintType:
+			_, n = protowire.ConsumeVarint(b)
+			v = b[:n]
+		}
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		res[num] = append(res[num], v)
+	}
+	return res
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var (
+		body    []byte
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ts := time.UnixMilli(1465839830100)
+	e := NewRemoteWrite(srv.URL, map[string]string{"Authorization": "Bearer token"})
+	err := e.Export(context.Background(), []Sample{
+		{Name: "http.requests", Labels: map[string]string{"route": "/pay", "host": "a"}, Type: "counter", Value: 42, Time: ts},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	require.Equal(t, "0.1.0", headers.Get("X-Prometheus-Remote-Write-Version"))
+	require.Equal(t, "Bearer token", headers.Get("Authorization"))
+
+	raw, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+	series := fields(t, raw)[1]
+	require.Len(t, series, 1)
+
+	ts1 := fields(t, series[0])
+	var labels [][2]string
+	for _, l := range ts1[1] {
+		lf := fields(t, l)
+		labels = append(labels, [2]string{string(lf[1][0]), string(lf[2][0])})
+	}
+	require.Equal(t, [][2]string{{"__name__", "http_requests"}, {"host", "a"}, {"route", "/pay"}}, labels)
+
+	sample := fields(t, ts1[2][0])
+	v, _ := protowire.ConsumeFixed64(sample[1][0])
+	require.Equal(t, float64(42), math.Float64frombits(v))
+	ms, _ := protowire.ConsumeVarint(sample[2][0])
+	require.Equal(t, uint64(1465839830100), ms)
+}
+
+func TestPostErrors(t *testing.T) {
+	code := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	e := NewInflux(srv.URL, nil)
+	err := e.Export(context.Background(), []Sample{{Name: "x", Value: 1}})
+	require.Error(t, err)
+	require.False(t, IsPermanent(err))
+
+	code = http.StatusBadRequest
+	err = e.Export(context.Background(), []Sample{{Name: "x", Value: 1}})
+	require.True(t, IsPermanent(err))
+}
+
+func TestEncodeLines(t *testing.T) {
+	ts := time.Unix(0, 1465839830100400200)
+	lines := EncodeLines([]Sample{
+		{Name: "cpu", Labels: map[string]string{"host": "a"}, Type: "gauge", Value: 0.5, Time: ts},
+		{Name: "requests", Type: "counter", Value: 10, Time: ts},
+	})
+	require.Equal(t, "cpu,host=a value=0.5 1465839830100400200\nrequests value=10i 1465839830100400200\n", string(lines))
+}
+
+type fakeExporter struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	batches  [][]Sample
+}
+
+func (e *fakeExporter) Export(ctx context.Context, samples []Sample) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failures > 0 {
+		e.failures--
+		return e.err
+	}
+	e.batches = append(e.batches, append([]Sample(nil), samples...))
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	cfg := config.ExporterConfig{
+		Name:          "fake",
+		QueueSize:     3,
+		BatchSize:     2,
+		FlushInterval: config.Duration{Duration: time.Hour},
+		RetryBackoff:  config.Duration{Duration: time.Millisecond},
+		MaxRetries:    2,
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		exp := &fakeExporter{failures: 2, err: errors.New("unavailable")}
+		m, err := NewManager(nil)
+		require.NoError(t, err)
+		m.Add(cfg, exp)
+		for i := 0; i < 4; i++ {
+			m.Enqueue(Sample{Name: "x", Value: float64(i)})
+		}
+		m.Run()
+		m.Shutdown(context.Background())
+
+		s := m.Stats()["fake"]
+		require.Equal(t, Stats{Sent: 3, Dropped: 1, Retries: 2, Up: true}, s)
+		require.Len(t, exp.batches, 2)
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		exp := &fakeExporter{failures: 1, err: Permanent(errors.New("bad request"))}
+		m, err := NewManager(nil)
+		require.NoError(t, err)
+		m.Add(cfg, exp)
+		m.Enqueue(Sample{Name: "x"})
+		m.Run()
+		m.Shutdown(context.Background())
+
+		require.Equal(t, Stats{Dropped: 1}, m.Stats()["fake"])
+		require.Equal(t, float64(0), m.Gauges()["server_exporter_up;exporter=fake"])
+		require.Equal(t, float64(1), m.Gauges()["server_exporter_dropped;exporter=fake"])
+	})
+
+	_, err := NewManager([]config.ExporterConfig{{Type: "kafka", URL: "http://x"}})
+	require.Error(t, err)
+	_, err = NewManager([]config.ExporterConfig{{Type: TypeInflux, URL: "http://a"}, {Type: TypeInflux, URL: "http://b"}})
+	require.Error(t, err)
+}
+
+func TestRepository(t *testing.T) {
+	exp := &fakeExporter{}
+	m, err := NewManager(nil)
+	require.NoError(t, err)
+	m.Add(config.ExporterConfig{Name: "fake"}, exp)
+	r := Repository(inmem.New(), m)
+
+	ctx := context.Background()
+	require.NoError(t, r.UpdateCounter(ctx, "jobs;host=a", 2))
+	require.NoError(t, r.UpdateCounter(ctx, "jobs;host=a", 3))
+	require.NoError(t, r.UpdateGauge(ctx, "temp", 21.5))
+	m.Run()
+	m.Shutdown(ctx)
+
+	require.Len(t, exp.batches, 1)
+	got := exp.batches[0]
+	require.Len(t, got, 3)
+	require.Equal(t, "jobs", got[1].Name)
+	require.Equal(t, map[string]string{"host": "a"}, got[1].Labels)
+	require.Equal(t, float64(5), got[1].Value)
+	require.Equal(t, "gauge", got[2].Type)
+}
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/andrei-cloud/go-devops/internal/influx"
+)
+
+type influxExporter struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+var _ Exporter = &influxExporter{}
+
+// NewInflux - creates exporter sending samples as InfluxDB line protocol,
+// url must contain database or bucket parameters of the write endpoint,
+// e.g. http://influx:8086/api/v2/write?org=ops&bucket=metrics.
+// Every sample is a point of measurement named after metric, labels are tags,
+// gauges are written as float "value" field and counter totals as integer.
+func NewInflux(url string, headers map[string]string) *influxExporter {
+	h := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	for k, v := range headers {
+		h[k] = v
+	}
+	return &influxExporter{client: &http.Client{}, url: url, headers: h}
+}
+
+// Export - sends samples in single request.
+func (e *influxExporter) Export(ctx context.Context, samples []Sample) error {
+	return post(ctx, e.client, e.url, e.headers, EncodeLines(samples))
+}
+
+// EncodeLines - encodes samples as line protocol with nanosecond timestamps.
+func EncodeLines(samples []Sample) []byte {
+	var b []byte
+	for _, s := range samples {
+		f := influx.Field{Kind: influx.Float, Float: s.Value}
+		if s.Type == "counter" {
+			f = influx.Field{Kind: influx.Integer, Int: int64(s.Value)}
+		}
+		b = influx.AppendLine(b, influx.Point{
+			Measurement: s.Name,
+			Tags:        s.Labels,
+			Fields:      map[string]influx.Field{"value": f},
+			Time:        s.Time,
+		})
+		b = append(b, '\n')
+	}
+	return b
+}
@@ -0,0 +1,257 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Defaults of exporter settings.
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+	DefaultTimeout       = 10 * time.Second
+	DefaultMaxRetries    = 3
+	DefaultRetryBackoff  = time.Second
+)
+
+// Stats - delivery accounting of single exporter.
+type Stats struct {
+	Queued  int   // samples waiting in queue
+	Sent    int64 // samples delivered
+	Dropped int64 // samples dropped due to full queue or failed delivery
+	Retries int64 // retried requests
+	Up      bool  // last request succeeded
+}
+
+// forwarder - bounded queue of single exporter with batching worker.
+type forwarder struct {
+	// accessed atomically, first in struct for 64-bit alignment
+	sent    int64
+	dropped int64
+	retries int64
+	up      int32
+
+	name  string
+	exp   Exporter
+	cfg   config.ExporterConfig
+	queue chan Sample
+}
+
+// Manager - fans out samples to all exporters.
+type Manager struct {
+	forwarders []*forwarder
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager - creates exporters and their queues, unset settings get defaults.
+func NewManager(cfgs []config.ExporterConfig) (*Manager, error) {
+	m := &Manager{stop: make(chan struct{})}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	names := make(map[string]struct{})
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+		}
+		if _, ok := names[cfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate exporter name %q", cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+
+		exp, err := New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		m.Add(cfg, exp)
+	}
+	return m, nil
+}
+
+// Add - registers exporter with settings cfg.
+func (m *Manager) Add(cfg config.ExporterConfig, exp Exporter) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval.Duration <= 0 {
+		cfg.FlushInterval.Duration = DefaultFlushInterval
+	}
+	if cfg.Timeout.Duration <= 0 {
+		cfg.Timeout.Duration = DefaultTimeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.RetryBackoff.Duration <= 0 {
+		cfg.RetryBackoff.Duration = DefaultRetryBackoff
+	}
+	m.forwarders = append(m.forwarders, &forwarder{
+		name:  cfg.Name,
+		exp:   exp,
+		cfg:   cfg,
+		queue: make(chan Sample, cfg.QueueSize),
+		up:    1,
+	})
+}
+
+// Enqueue - queues sample to every exporter without blocking,
+// sample is dropped for exporters with full queue.
+func (m *Manager) Enqueue(s Sample) {
+	for _, f := range m.forwarders {
+		select {
+		case f.queue <- s:
+		default:
+			atomic.AddInt64(&f.dropped, 1)
+		}
+	}
+}
+
+// Run - starts workers of all exporters, non blocking.
+func (m *Manager) Run() {
+	for _, f := range m.forwarders {
+		m.wg.Add(1)
+		go func(f *forwarder) {
+			defer m.wg.Done()
+			f.run(m.ctx, m.stop)
+		}(f)
+	}
+}
+
+// Shutdown - flushes queued samples, delivery in progress is aborted when ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) {
+	close(m.stop)
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		m.cancel()
+		<-done
+	}
+	m.cancel()
+}
+
+// Stats - returns accounting of every exporter by name.
+func (m *Manager) Stats() map[string]Stats {
+	stats := make(map[string]Stats, len(m.forwarders))
+	for _, f := range m.forwarders {
+		stats[f.name] = Stats{
+			Queued:  len(f.queue),
+			Sent:    atomic.LoadInt64(&f.sent),
+			Dropped: atomic.LoadInt64(&f.dropped),
+			Retries: atomic.LoadInt64(&f.retries),
+			Up:      atomic.LoadInt32(&f.up) == 1,
+		}
+	}
+	return stats
+}
+
+// Gauges - returns health of exporters as server self-metrics labelled with exporter name.
+func (m *Manager) Gauges() map[string]float64 {
+	gauges := make(map[string]float64)
+	for name, s := range m.Stats() {
+		labels := map[string]string{"exporter": name}
+		up := 0.0
+		if s.Up {
+			up = 1
+		}
+		gauges[model.SeriesID("server_exporter_queue", labels)] = float64(s.Queued)
+		gauges[model.SeriesID("server_exporter_sent", labels)] = float64(s.Sent)
+		gauges[model.SeriesID("server_exporter_dropped", labels)] = float64(s.Dropped)
+		gauges[model.SeriesID("server_exporter_retries", labels)] = float64(s.Retries)
+		gauges[model.SeriesID("server_exporter_up", labels)] = up
+	}
+	return gauges
+}
+
+// run collects batches until stop is closed, then flushes the queue.
+func (f *forwarder) run(ctx context.Context, stop <-chan struct{}) {
+	batch := make([]Sample, 0, f.cfg.BatchSize)
+	ticker := time.NewTicker(f.cfg.FlushInterval.Duration)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			f.send(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case s := <-f.queue:
+			batch = append(batch, s)
+			if len(batch) >= f.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for {
+				select {
+				case s := <-f.queue:
+					batch = append(batch, s)
+					if len(batch) >= f.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send delivers batch retrying with exponential backoff, batch is dropped
+// after MaxRetries or on permanent error.
+func (f *forwarder) send(ctx context.Context, batch []Sample) {
+	backoff := f.cfg.RetryBackoff.Duration
+	for attempt := 0; ; attempt++ {
+		lctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout.Duration)
+		err := f.exp.Export(lctx, batch)
+		cancel()
+		if err == nil {
+			atomic.AddInt64(&f.sent, int64(len(batch)))
+			atomic.StoreInt32(&f.up, 1)
+			return
+		}
+		atomic.StoreInt32(&f.up, 0)
+		log.Error().AnErr("Export", err).Str("exporter", f.name).Int("attempt", attempt+1).Msg("Exporter")
+
+		if IsPermanent(err) || attempt >= f.cfg.MaxRetries || ctx.Err() != nil {
+			atomic.AddInt64(&f.dropped, int64(len(batch)))
+			return
+		}
+		atomic.AddInt64(&f.retries, 1)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			atomic.AddInt64(&f.dropped, int64(len(batch)))
+			return
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	invalidLabelChars  = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+type remoteWrite struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+var _ Exporter = &remoteWrite{}
+
+// NewRemoteWrite - creates exporter sending samples with Prometheus
+// remote-write protocol 0.1.0 (snappy compressed protobuf WriteRequest).
+func NewRemoteWrite(url string, headers map[string]string) *remoteWrite {
+	h := map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
+	for k, v := range headers {
+		h[k] = v
+	}
+	return &remoteWrite{client: &http.Client{}, url: url, headers: h}
+}
+
+// Export - sends samples as single WriteRequest.
+func (e *remoteWrite) Export(ctx context.Context, samples []Sample) error {
+	return post(ctx, e.client, e.url, e.headers, snappy.Encode(nil, EncodeWriteRequest(samples)))
+}
+
+// EncodeWriteRequest - encodes samples as prometheus.WriteRequest protobuf:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+//
+// Every sample is sent as separate time series with labels sorted by name.
+func EncodeWriteRequest(samples []Sample) []byte {
+	var b, ts, buf []byte
+	for _, s := range samples {
+		ts = ts[:0]
+		for _, l := range promLabels(s) {
+			buf = buf[:0]
+			buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+			buf = protowire.AppendString(buf, l[0])
+			buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+			buf = protowire.AppendString(buf, l[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, buf)
+		}
+
+		buf = buf[:0]
+		buf = protowire.AppendTag(buf, 1, protowire.Fixed64Type)
+		buf = protowire.AppendFixed64(buf, math.Float64bits(s.Value))
+		buf = protowire.AppendTag(buf, 2, protowire.VarintType)
+		buf = protowire.AppendVarint(buf, uint64(s.Time.UnixNano()/1e6))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, buf)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	return b
+}
+
+// promLabels returns sorted name-value pairs including __name__.
+func promLabels(s Sample) [][2]string {
+	labels := make([][2]string, 0, len(s.Labels)+1)
+	labels = append(labels, [2]string{"__name__", invalidMetricChars.ReplaceAllString(s.Name, "_")})
+	for k, v := range s.Labels {
+		if k == "" || v == "" {
+			continue
+		}
+		labels = append(labels, [2]string{invalidLabelChars.ReplaceAllString(k, "_"), v})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+	return labels
+}
@@ -0,0 +1,76 @@
+package export
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+type repository struct {
+	repo.Repository
+	m *Manager
+}
+
+var _ repo.Repository = &repository{}
+
+// Repository - wraps repository r so every successful update is queued to
+// exporters of m. Counters are forwarded with their total after update.
+func Repository(r repo.Repository, m *Manager) repo.Repository {
+	return &repository{Repository: r, m: m}
+}
+
+// UpdateGauge - updates gauge and forwards its value.
+func (r *repository) UpdateGauge(ctx context.Context, g string, v float64) error {
+	if err := r.Repository.UpdateGauge(ctx, g, v); err != nil {
+		return err
+	}
+	r.m.Enqueue(newSample(g, "gauge", v))
+	return nil
+}
+
+// UpdateCounter - updates counter and forwards its total.
+func (r *repository) UpdateCounter(ctx context.Context, c string, v int64) error {
+	if err := r.Repository.UpdateCounter(ctx, c, v); err != nil {
+		return err
+	}
+	total, err := r.Repository.GetCounter(ctx, c)
+	if err != nil {
+		log.Error().AnErr("GetCounter", err).Str("metric", c).Msg("Export")
+		return nil
+	}
+	r.m.Enqueue(newSample(c, "counter", float64(total)))
+	return nil
+}
+
+// UpdateMetrics - updates metrics atomically and forwards gauge values
+// and counter totals.
+func (r *repository) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	if err := r.Repository.UpdateMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		if m.MType == "gauge" {
+			r.m.Enqueue(newSample(m.ID, "gauge", *m.Value))
+			continue
+		}
+		total, err := r.Repository.GetCounter(ctx, m.ID)
+		if err != nil {
+			log.Error().AnErr("GetCounter", err).Str("metric", m.ID).Msg("Export")
+			continue
+		}
+		r.m.Enqueue(newSample(m.ID, "counter", float64(total)))
+	}
+	return nil
+}
+
+func newSample(id, typ string, v float64) Sample {
+	name, labels, err := model.ParseSeriesID(id)
+	if err != nil {
+		name, labels = id, nil
+	}
+	return Sample{Name: name, Labels: labels, Type: typ, Value: v, Time: time.Now()}
+}
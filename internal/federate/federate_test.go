@@ -0,0 +1,212 @@
+package federate_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/federate"
+	"github.com/andrei-cloud/go-devops/internal/groups"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func regional(t *testing.T, key []byte) (repo.Repository, *federate.Journal, *httptest.Server) {
+	j := federate.NewJournal()
+	r := federate.Repository(inmem.New(), j)
+	srv := httptest.NewServer(router.WithFederation(chi.NewRouter(), r, j, key))
+	t.Cleanup(srv.Close)
+	return r, j, srv
+}
+
+func get(t *testing.T, url string, q federate.Query, key []byte) (int, federate.Response) {
+	raw := q.Values().Encode()
+	req, err := http.NewRequest(http.MethodGet, url+"/federate?"+raw, nil)
+	require.NoError(t, err)
+	if key != nil {
+		req.Header.Set("X-Hash", federate.SignQuery(raw, key))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body federate.Response
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	}
+	return resp.StatusCode, body
+}
+
+func ids(resp federate.Response) []string {
+	var res []string
+	for _, m := range resp.Metrics {
+		res = append(res, m.MType+":"+m.ID)
+	}
+	return res
+}
+
+func TestFederateEndpoint(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("regional")
+	r, j, srv := regional(t, key)
+
+	require.NoError(t, r.UpdateGauge(ctx, "cpu_usage;host=a", 0.5))
+	require.NoError(t, r.UpdateGauge(ctx, "cpu_usage;host=b", 0.7))
+	require.NoError(t, r.UpdateCounter(ctx, "requests;host=a", 10))
+	require.NoError(t, r.UpdateGauge(ctx, "mem_free;host=a", 100))
+
+	code, _ := get(t, srv.URL, federate.Query{}, nil)
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = get(t, srv.URL, federate.Query{}, []byte("wrong"))
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, full := get(t, srv.URL, federate.Query{}, key)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, full.Full)
+	require.Equal(t, j.Epoch(), full.Epoch)
+	require.Equal(t, uint64(4), full.Version)
+	require.Len(t, full.Metrics, 4)
+	for _, m := range full.Metrics {
+		require.NotEmpty(t, m.Hash)
+	}
+
+	_, filtered := get(t, srv.URL, federate.Query{
+		Match:  []string{"cpu_", "req"},
+		Labels: map[string]string{"host": "a"},
+	}, key)
+	require.Equal(t, []string{"gauge:cpu_usage;host=a", "counter:requests;host=a"}, ids(filtered))
+
+	require.NoError(t, r.UpdateCounter(ctx, "requests;host=a", 5))
+	require.NoError(t, r.UpdateGauge(ctx, "cpu_usage;host=b", 0.9))
+
+	cursor := federate.Query{Epoch: full.Epoch, SinceVersion: full.Version}
+	_, inc := get(t, srv.URL, cursor, key)
+	require.False(t, inc.Full)
+	require.Equal(t, uint64(6), inc.Version)
+	require.Equal(t, []string{"gauge:cpu_usage;host=b", "counter:requests;host=a"}, ids(inc))
+	require.Equal(t, int64(15), *inc.Metrics[1].Delta)
+
+	// cursor of another epoch, e.g. before restart of regional server
+	_, reset := get(t, srv.URL, federate.Query{Epoch: 1, SinceVersion: 6}, key)
+	require.True(t, reset.Full)
+	require.Len(t, reset.Metrics, 4)
+
+	since := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, r.UpdateGauge(ctx, "mem_free;host=a", 50))
+	_, byTime := get(t, srv.URL, federate.Query{Since: since}, key)
+	require.False(t, byTime.Full)
+	require.Equal(t, []string{"gauge:mem_free;host=a"}, ids(byTime))
+
+	// time before start of journal
+	_, old := get(t, srv.URL, federate.Query{Since: j.Started().Add(-time.Hour)}, key)
+	require.True(t, old.Full)
+}
+
+func TestFederateQueryValidation(t *testing.T) {
+	_, _, srv := regional(t, nil)
+	for _, q := range []string{"label=host", "since_version=x", "since=yesterday", "epoch=-"} {
+		resp, err := http.Get(srv.URL + "/federate?" + q)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, q)
+	}
+}
+
+func TestPuller(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("regional")
+	r, _, srv := regional(t, key)
+	require.NoError(t, r.UpdateGauge(ctx, "cpu_usage;host=a", 0.5))
+	require.NoError(t, r.UpdateCounter(ctx, "requests;host=a", 10))
+	require.NoError(t, r.UpdateGauge(ctx, "disk_free", 1))
+
+	global := inmem.New()
+	p := federate.NewPuller(config.FederateSource{
+		Name: "eu", URL: srv.URL, Key: string(key), Match: []string{"cpu_", "requests"},
+	}, global)
+	require.NoError(t, p.Pull(ctx))
+
+	gauges, _ := global.GetGaugeAll(ctx)
+	require.Equal(t, map[string]float64{"cpu_usage;host=a;source=eu": 0.5}, gauges)
+	c, err := global.GetCounter(ctx, "requests;host=a;source=eu")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), c)
+
+	// unchanged totals are not added again
+	require.NoError(t, p.Pull(ctx))
+	c, _ = global.GetCounter(ctx, "requests;host=a;source=eu")
+	require.Equal(t, int64(10), c)
+
+	require.NoError(t, r.UpdateCounter(ctx, "requests;host=a", 7))
+	require.NoError(t, p.Pull(ctx))
+	c, _ = global.GetCounter(ctx, "requests;host=a;source=eu")
+	require.Equal(t, int64(17), c)
+
+	// new puller after restart of global server continues from stored total
+	p = federate.NewPuller(config.FederateSource{Name: "eu", URL: srv.URL, Key: string(key)}, global)
+	require.NoError(t, p.Pull(ctx))
+	c, _ = global.GetCounter(ctx, "requests;host=a;source=eu")
+	require.Equal(t, int64(17), c)
+
+	prefixed := inmem.New()
+	p = federate.NewPuller(config.FederateSource{Name: "eu", URL: srv.URL, Key: string(key), Prefix: "eu_"}, prefixed)
+	require.NoError(t, p.Pull(ctx))
+	gauges, _ = prefixed.GetGaugeAll(ctx)
+	require.Equal(t, map[string]float64{"eu_cpu_usage;host=a": 0.5, "eu_disk_free": 1}, gauges)
+
+	p = federate.NewPuller(config.FederateSource{Name: "eu", URL: srv.URL, Key: "wrong"}, inmem.New())
+	require.Error(t, p.Pull(ctx))
+}
+
+func TestPullerRemovals(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("regional")
+	r, _, srv := regional(t, key)
+	require.NoError(t, r.UpdateGauge(ctx, "cpu_usage", 0.5))
+	require.NoError(t, r.UpdateCounter(ctx, "requests", 10))
+	require.NoError(t, r.UpdateGauge(ctx, "temp", 21))
+	now := time.Now()
+	require.NoError(t, groups.Push(ctx, r, groups.Group{Job: "backup"},
+		[]model.Metric{{ID: "last_success", MType: "gauge", Value: new(float64)}}, time.Minute, now))
+
+	global := inmem.New()
+	p := federate.NewPuller(config.FederateSource{Name: "eu", URL: srv.URL, Key: string(key), Prefix: "eu_"}, global)
+	require.NoError(t, p.Pull(ctx))
+	_, err := global.GetGauge(ctx, "eu_last_success;job=backup")
+	require.NoError(t, err)
+
+	// deleted metric
+	require.NoError(t, r.DeleteGauge(ctx, "cpu_usage"))
+	require.NoError(t, p.Pull(ctx))
+	_, err = global.GetGauge(ctx, "eu_cpu_usage")
+	require.Error(t, err)
+
+	// renamed metric
+	require.NoError(t, r.Rename(ctx, "counter", "requests", "http_requests", false))
+	require.NoError(t, p.Pull(ctx))
+	_, err = global.GetCounter(ctx, "eu_requests")
+	require.Error(t, err)
+	c, err := global.GetCounter(ctx, "eu_http_requests")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), c)
+
+	// expired group
+	n, err := groups.NewJanitor(r, 0).Sweep(ctx, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.NotZero(t, n)
+	require.NoError(t, p.Pull(ctx))
+	_, err = global.GetGauge(ctx, "eu_last_success;job=backup")
+	require.Error(t, err)
+
+	gauges, _ := global.GetGaugeAll(ctx)
+	require.Equal(t, map[string]float64{"eu_temp": 21}, gauges)
+}
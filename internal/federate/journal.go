@@ -0,0 +1,181 @@
+// Package federate implements federation of servers: regional server journals
+// updates and serves filtered snapshots on "/federate", global server pulls
+// them incrementally with Puller.
+package federate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Change - last update of single metric.
+type Change struct {
+	Type    string    // "gauge" or "counter"
+	ID      string    // metric ID
+	Version uint64    // journal version of update
+	Updated time.Time // time of update
+	Removed bool      // metric was deleted or renamed
+}
+
+type journalKey struct {
+	mtype string
+	id    string
+}
+
+// Journal - records version and time of last update of every metric.
+// Version grows by one with every update and starts from zero with every
+// journal, so cursors are only valid together with the journal epoch.
+type Journal struct {
+	mu      sync.RWMutex
+	epoch   int64
+	started time.Time
+	version uint64
+	changes map[journalKey]Change
+}
+
+// NewJournal - creates empty journal with epoch of current time.
+func NewJournal() *Journal {
+	now := time.Now()
+	return &Journal{
+		epoch:   now.UnixNano(),
+		started: now,
+		changes: make(map[journalKey]Change),
+	}
+}
+
+// Epoch - returns identifier of journal, changed when server restarts.
+func (j *Journal) Epoch() int64 {
+	return j.epoch
+}
+
+// Started - returns time of journal creation, updates before it are not journaled.
+func (j *Journal) Started() time.Time {
+	return j.started
+}
+
+// Record - journals update of metric id of type mtype.
+func (j *Journal) Record(mtype, id string) {
+	j.record(mtype, id, false)
+}
+
+// Remove - journals removal of metric id of type mtype, so incremental
+// snapshots report it as removed.
+func (j *Journal) Remove(mtype, id string) {
+	j.record(mtype, id, true)
+}
+
+func (j *Journal) record(mtype, id string, removed bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.version++
+	j.changes[journalKey{mtype: mtype, id: id}] = Change{
+		Type:    mtype,
+		ID:      id,
+		Version: j.version,
+		Updated: time.Now(),
+		Removed: removed,
+	}
+}
+
+// Since - returns current version and metrics updated after version and
+// after time t, zero t is not checked.
+func (j *Journal) Since(version uint64, t time.Time) (uint64, []Change) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	var changes []Change
+	for _, c := range j.changes {
+		if c.Version > version && c.Updated.After(t) {
+			changes = append(changes, c)
+		}
+	}
+	return j.version, changes
+}
+
+// Version - returns current version of journal.
+func (j *Journal) Version() uint64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.version
+}
+
+type repository struct {
+	repo.Repository
+	j *Journal
+}
+
+var _ repo.Repository = &repository{}
+
+// Repository - wraps repository r so every successful update and removal is recorded in j.
+func Repository(r repo.Repository, j *Journal) repo.Repository {
+	return &repository{Repository: r, j: j}
+}
+
+// UpdateGauge - updates gauge and journals the update.
+func (r *repository) UpdateGauge(ctx context.Context, g string, v float64) error {
+	if err := r.Repository.UpdateGauge(ctx, g, v); err != nil {
+		return err
+	}
+	r.j.Record("gauge", g)
+	return nil
+}
+
+// UpdateCounter - updates counter and journals the update.
+func (r *repository) UpdateCounter(ctx context.Context, c string, v int64) error {
+	if err := r.Repository.UpdateCounter(ctx, c, v); err != nil {
+		return err
+	}
+	r.j.Record("counter", c)
+	return nil
+}
+
+// UpdateMetrics - updates metrics atomically and journals every update.
+func (r *repository) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	if err := r.Repository.UpdateMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		r.j.Record(m.MType, m.ID)
+	}
+	return nil
+}
+
+// ResetCounter - resets counter and journals the reset.
+func (r *repository) ResetCounter(ctx context.Context, c string) error {
+	if err := r.Repository.ResetCounter(ctx, c); err != nil {
+		return err
+	}
+	r.j.Record("counter", c)
+	return nil
+}
+
+// DeleteGauge - deletes gauge and journals its removal.
+func (r *repository) DeleteGauge(ctx context.Context, g string) error {
+	if err := r.Repository.DeleteGauge(ctx, g); err != nil {
+		return err
+	}
+	r.j.Remove("gauge", g)
+	return nil
+}
+
+// DeleteCounter - deletes counter and journals its removal.
+func (r *repository) DeleteCounter(ctx context.Context, c string) error {
+	if err := r.Repository.DeleteCounter(ctx, c); err != nil {
+		return err
+	}
+	r.j.Remove("counter", c)
+	return nil
+}
+
+// Rename - renames metric and journals removal of the old name and the renamed metric.
+func (r *repository) Rename(ctx context.Context, mtype, from, to string, merge bool) error {
+	if err := r.Repository.Rename(ctx, mtype, from, to, merge); err != nil {
+		return err
+	}
+	r.j.Remove(mtype, from)
+	r.j.Record(mtype, to)
+	return nil
+}
@@ -0,0 +1,200 @@
+package federate
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Defaults of federation source settings.
+const (
+	DefaultInterval    = 30 * time.Second
+	DefaultTimeout     = 10 * time.Second
+	DefaultSourceLabel = "source"
+)
+
+// Puller - pulls metrics of single regional server into repository.
+type Puller struct {
+	src    config.FederateSource
+	repo   repo.Repository
+	client *http.Client
+	key    []byte
+
+	epoch   int64
+	version uint64
+	totals  map[string]int64 // last pulled counter totals by local ID
+}
+
+// NewPuller - creates puller of src storing metrics into r, unset settings get defaults.
+func NewPuller(src config.FederateSource, r repo.Repository) *Puller {
+	if src.Interval.Duration <= 0 {
+		src.Interval.Duration = DefaultInterval
+	}
+	if src.Timeout.Duration <= 0 {
+		src.Timeout.Duration = DefaultTimeout
+	}
+	if src.Prefix == "" && src.Label == "" {
+		src.Label = DefaultSourceLabel
+	}
+	p := &Puller{
+		src:    src,
+		repo:   r,
+		client: &http.Client{Timeout: src.Timeout.Duration},
+		totals: make(map[string]int64),
+	}
+	if src.Key != "" {
+		p.key = []byte(src.Key)
+	}
+	return p
+}
+
+// Run - pulls source every interval until ctx is done.
+func (p *Puller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.src.Interval.Duration)
+	defer ticker.Stop()
+	for {
+		if err := p.Pull(ctx); err != nil {
+			log.Error().AnErr("Pull", err).Str("source", p.src.Name).Msg("Federate")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Pull - requests metrics changed since previous pull and stores them,
+// metrics removed from source are deleted.
+// Gauges are set, counters are increased by difference with previously
+// pulled total, reset of remote counter adds its whole total.
+func (p *Puller) Pull(ctx context.Context) error {
+	q := Query{
+		Match:        p.src.Match,
+		Labels:       p.src.Labels,
+		Epoch:        p.epoch,
+		SinceVersion: p.version,
+	}
+	rawQuery := q.Values().Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimRight(p.src.URL, "/")+"/federate?"+rawQuery, nil)
+	if err != nil {
+		return err
+	}
+	if len(p.key) != 0 {
+		req.Header.Set("X-Hash", SignQuery(rawQuery, p.key))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code: %d %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var body Response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+
+	for _, m := range body.Metrics {
+		if valid, err := hash.Validate(m, p.key); !valid || err != nil {
+			log.Error().AnErr("Validate", err).Str("source", p.src.Name).Str("metric", m.ID).Msg("Federate: invalid hash")
+			continue
+		}
+		id, err := p.localID(m.ID)
+		if err != nil {
+			log.Error().AnErr("ParseSeriesID", err).Str("source", p.src.Name).Msg("Federate")
+			continue
+		}
+		switch {
+		case m.MType == "gauge" && m.Value != nil:
+			err = p.repo.UpdateGauge(ctx, id, *m.Value)
+		case m.MType == "counter" && m.Delta != nil:
+			err = p.addCounter(ctx, id, *m.Delta)
+		default:
+			continue
+		}
+		if err != nil {
+			// cursor is kept so the metric is pulled again
+			return err
+		}
+	}
+
+	for _, m := range body.Removed {
+		if len(p.key) != 0 && !hmac.Equal([]byte(m.Hash), []byte(SignRemoved(m, p.key))) {
+			log.Error().Str("source", p.src.Name).Str("metric", m.ID).Msg("Federate: invalid hash")
+			continue
+		}
+		id, err := p.localID(m.ID)
+		if err != nil {
+			log.Error().AnErr("ParseSeriesID", err).Str("source", p.src.Name).Msg("Federate")
+			continue
+		}
+		switch m.MType {
+		case "gauge":
+			err = p.repo.DeleteGauge(ctx, id)
+		case "counter":
+			err = p.repo.DeleteCounter(ctx, id)
+			delete(p.totals, id)
+		default:
+			continue
+		}
+		if err != nil && !errors.Is(err, repo.ErrNotFound) {
+			return err
+		}
+	}
+
+	p.epoch, p.version = body.Epoch, body.Version
+	return nil
+}
+
+// addCounter increases local counter id up to remote total.
+func (p *Puller) addCounter(ctx context.Context, id string, total int64) error {
+	last, ok := p.totals[id]
+	if !ok {
+		// first pull since start, local counter holds previously pulled total
+		if local, err := p.repo.GetCounter(ctx, id); err == nil {
+			last, ok = local, true
+		}
+	}
+	delta := total
+	if ok && total >= last {
+		delta = total - last
+	}
+	if delta != 0 {
+		if err := p.repo.UpdateCounter(ctx, id, delta); err != nil {
+			return err
+		}
+	}
+	p.totals[id] = total
+	return nil
+}
+
+// localID renames remote metric with prefix and source label.
+func (p *Puller) localID(id string) (string, error) {
+	name, labels, err := model.ParseSeriesID(id)
+	if err != nil {
+		return "", err
+	}
+	if p.src.Label != "" {
+		labels[p.src.Label] = p.src.Name
+	}
+	return model.SeriesID(p.src.Prefix+name, labels), nil
+}
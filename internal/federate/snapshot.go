@@ -0,0 +1,220 @@
+package federate
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Query parameters of "/federate".
+const (
+	ParamMatch        = "match"         // metric name prefix, repeatable, any must match
+	ParamLabel        = "label"         // label filter "key=value", repeatable, all must match
+	ParamEpoch        = "epoch"         // journal epoch of since_version cursor
+	ParamSinceVersion = "since_version" // return metrics updated after journal version
+	ParamSince        = "since"         // return metrics updated after unix time in milliseconds
+)
+
+// Query - filter and cursor of federation request.
+type Query struct {
+	Match        []string
+	Labels       map[string]string
+	Epoch        int64
+	SinceVersion uint64
+	Since        time.Time
+}
+
+// ParseQuery - parses query parameters of "/federate" request.
+func ParseQuery(v url.Values) (Query, error) {
+	var (
+		q   Query
+		err error
+	)
+	q.Match = v[ParamMatch]
+	for _, l := range v[ParamLabel] {
+		k, val, ok := strings.Cut(l, "=")
+		if !ok || k == "" || val == "" {
+			return q, fmt.Errorf("invalid label filter %q", l)
+		}
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[k] = val
+	}
+	if s := v.Get(ParamEpoch); s != "" {
+		if q.Epoch, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return q, fmt.Errorf("invalid %s: %w", ParamEpoch, err)
+		}
+	}
+	if s := v.Get(ParamSinceVersion); s != "" {
+		if q.SinceVersion, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return q, fmt.Errorf("invalid %s: %w", ParamSinceVersion, err)
+		}
+	}
+	if s := v.Get(ParamSince); s != "" {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s: %w", ParamSince, err)
+		}
+		q.Since = time.UnixMilli(ms)
+	}
+	return q, nil
+}
+
+// Values - encodes query as query parameters.
+func (q Query) Values() url.Values {
+	v := url.Values{}
+	for _, m := range q.Match {
+		v.Add(ParamMatch, m)
+	}
+	for k, val := range q.Labels {
+		v.Add(ParamLabel, k+"="+val)
+	}
+	if q.SinceVersion > 0 {
+		v.Set(ParamEpoch, strconv.FormatInt(q.Epoch, 10))
+		v.Set(ParamSinceVersion, strconv.FormatUint(q.SinceVersion, 10))
+	}
+	if !q.Since.IsZero() {
+		v.Set(ParamSince, strconv.FormatInt(q.Since.UnixMilli(), 10))
+	}
+	return v
+}
+
+// matches reports whether metric id passes filters of query.
+func (q Query) matches(id string) bool {
+	name, labels, err := model.ParseSeriesID(id)
+	if err != nil {
+		return false
+	}
+	if len(q.Match) > 0 {
+		matched := false
+		for _, m := range q.Match {
+			if strings.HasPrefix(name, m) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for k, v := range q.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Response - body of "/federate" response. Counters are sent with their totals.
+// Epoch and Version form cursor of the next incremental request.
+type Response struct {
+	Epoch   int64          `json:"epoch"`
+	Version uint64         `json:"version"`
+	Full    bool           `json:"full"` // all metrics matching filters are included
+	Metrics []model.Metric `json:"metrics"`
+	Removed []model.Metric `json:"removed,omitempty"` // metrics removed after cursor, signed with SignRemoved
+}
+
+// Snapshot - builds response with metrics of r matching q. Only metrics
+// journaled after cursor of q are included if cursor is still valid:
+// since_version requires epoch of j, since must not precede start of j.
+// Otherwise full snapshot is returned. Metrics are signed with key if set.
+func Snapshot(ctx context.Context, r repo.Repository, j *Journal, q Query, key []byte) (Response, error) {
+	resp := Response{Epoch: j.Epoch()}
+
+	incremental := (q.SinceVersion > 0 && q.Epoch == j.Epoch()) ||
+		(q.SinceVersion == 0 && !q.Since.IsZero() && !q.Since.Before(j.Started()))
+
+	if incremental {
+		var changes []Change
+		resp.Version, changes = j.Since(q.SinceVersion, q.Since)
+		for _, c := range changes {
+			if !q.matches(c.ID) {
+				continue
+			}
+			m := model.Metric{ID: c.ID, MType: c.Type}
+			if c.Removed {
+				m.Hash = SignRemoved(m, key)
+				resp.Removed = append(resp.Removed, m)
+				continue
+			}
+			switch c.Type {
+			case "gauge":
+				v, err := r.GetGauge(ctx, c.ID)
+				if err != nil {
+					continue
+				}
+				m.Value = &v
+			case "counter":
+				v, err := r.GetCounter(ctx, c.ID)
+				if err != nil {
+					continue
+				}
+				m.Delta = &v
+			}
+			resp.Metrics = append(resp.Metrics, hash.Sign(m, key))
+		}
+	} else {
+		// version is taken before reading values, so updates racing
+		// with snapshot are returned again by the next request
+		resp.Version = j.Version()
+		resp.Full = true
+		gauges, err := r.GetGaugeAll(ctx)
+		if err != nil {
+			return resp, err
+		}
+		counters, err := r.GetCounterAll(ctx)
+		if err != nil {
+			return resp, err
+		}
+		for id, v := range gauges {
+			if q.matches(id) {
+				v := v
+				resp.Metrics = append(resp.Metrics, hash.Sign(model.Metric{ID: id, MType: "gauge", Value: &v}, key))
+			}
+		}
+		for id, d := range counters {
+			if q.matches(id) {
+				d := d
+				resp.Metrics = append(resp.Metrics, hash.Sign(model.Metric{ID: id, MType: "counter", Delta: &d}, key))
+			}
+		}
+	}
+
+	sortMetrics(resp.Metrics)
+	sortMetrics(resp.Removed)
+	return resp, nil
+}
+
+// sortMetrics sorts metrics by ID and type.
+func sortMetrics(metrics []model.Metric) {
+	sort.Slice(metrics, func(i, k int) bool {
+		if metrics[i].ID != metrics[k].ID {
+			return metrics[i].ID < metrics[k].ID
+		}
+		return metrics[i].MType < metrics[k].MType
+	})
+}
+
+// SignRemoved - returns hash of removed metric m sent in Removed of response,
+// empty without key.
+func SignRemoved(m model.Metric, key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	return hash.Create(fmt.Sprintf("federate:removed:%s:%s", m.MType, m.ID), key)
+}
+
+// SignQuery - returns hash of encoded query sent in X-Hash header of request.
+func SignQuery(rawQuery string, key []byte) string {
+	return hash.Create("federate:"+rawQuery, key)
+}
@@ -0,0 +1,137 @@
+// Package graphite implements Graphite plaintext protocol listener.
+package graphite
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Metric types produced by rules.
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// Sample - single parsed line "path value [timestamp]".
+// Graphite tags "path;tag=value" are returned as labels.
+type Sample struct {
+	Path   string
+	Labels map[string]string
+	Value  float64
+}
+
+// ParseLine - parses single plaintext protocol line.
+// Timestamp is validated but ignored, repository keeps the latest value only.
+func ParseLine(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Sample{}, fmt.Errorf("invalid line %q", line)
+	}
+
+	p, labels, err := model.ParseSeriesID(fields[0])
+	if err != nil {
+		return Sample{}, err
+	}
+	if p == "" {
+		return Sample{}, fmt.Errorf("empty path")
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return Sample{}, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+	}
+	return Sample{Path: p, Labels: labels, Value: v}, nil
+}
+
+// Mapper - maps Graphite paths to metrics by rules, first matching rule wins.
+type Mapper struct {
+	rules []config.GraphiteRule
+}
+
+// NewMapper - validates rules and creates mapper.
+func NewMapper(rules []config.GraphiteRule) (*Mapper, error) {
+	for i, r := range rules {
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("rule %d: empty pattern", i)
+		}
+		for _, seg := range strings.Split(r.Pattern, ".") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern %q", i, r.Pattern)
+			}
+		}
+		if r.Type != "" && r.Type != Gauge && r.Type != Counter {
+			return nil, fmt.Errorf("rule %d: invalid type %q", i, r.Type)
+		}
+	}
+	return &Mapper{rules: rules}, nil
+}
+
+// Map - returns metric ID and type for sample. Paths without matching rule
+// are named after the path with dots replaced by underscores and are gauges.
+func (m *Mapper) Map(s Sample) (string, string) {
+	segments := strings.Split(s.Path, ".")
+	for _, r := range m.rules {
+		if !matchSegments(strings.Split(r.Pattern, "."), segments) {
+			continue
+		}
+		labels := make(map[string]string, len(r.Labels)+len(s.Labels))
+		for k, v := range r.Labels {
+			labels[k] = expand(v, segments)
+		}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		name := s.Path
+		if r.Name != "" {
+			name = expand(r.Name, segments)
+		}
+		typ := r.Type
+		if typ == "" {
+			typ = Gauge
+		}
+		return model.SeriesID(sanitize(name), labels), typ
+	}
+	return model.SeriesID(sanitize(s.Path), s.Labels), Gauge
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if ok, _ := path.Match(p, segments[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// expand replaces $N with N-th segment of the path, 1-based.
+func expand(tmpl string, segments []string) string {
+	return placeholder.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		n, _ := strconv.Atoi(ph[1:])
+		if n < 1 || n > len(segments) {
+			return ""
+		}
+		return segments[n-1]
+	})
+}
+
+func sanitize(name string) string {
+	return strings.ReplaceAll(name, ".", "_")
+}
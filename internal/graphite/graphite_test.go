@@ -0,0 +1,156 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{"servers.web1.cpu 0.5 1465839830", Sample{Path: "servers.web1.cpu", Labels: map[string]string{}, Value: 0.5}, false},
+		{"jobs.done 3", Sample{Path: "jobs.done", Labels: map[string]string{}, Value: 3}, false},
+		{"disk.used;dc=eu;host=a 10 -1", Sample{Path: "disk.used", Labels: map[string]string{"dc": "eu", "host": "a"}, Value: 10}, false},
+		{"jobs.done", Sample{}, true},
+		{"jobs.done x", Sample{}, true},
+		{"jobs.done NaN", Sample{}, true},
+		{"jobs.done 1 now", Sample{}, true},
+		{"jobs.done;bad 1", Sample{}, true},
+		{"jobs.done 1 2 3", Sample{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMapper(t *testing.T) {
+	m, err := NewMapper([]config.GraphiteRule{
+		{Pattern: "servers.*.cpu.*", Name: "cpu_$4", Labels: map[string]string{"host": "$2"}},
+		{Pattern: "jobs.*.runs", Name: "job_runs", Labels: map[string]string{"job": "$2"}, Type: Counter},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		sample Sample
+		id     string
+		typ    string
+	}{
+		{Sample{Path: "servers.web1.cpu.user"}, "cpu_user;host=web1", Gauge},
+		{Sample{Path: "servers.web1.cpu.user", Labels: map[string]string{"host": "own", "dc": "eu"}}, "cpu_user;dc=eu;host=own", Gauge},
+		{Sample{Path: "jobs.backup.runs"}, "job_runs;job=backup", Counter},
+		{Sample{Path: "servers.web1.mem"}, "servers_web1_mem", Gauge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sample.Path, func(t *testing.T) {
+			id, typ := m.Map(tt.sample)
+			require.Equal(t, tt.id, id)
+			require.Equal(t, tt.typ, typ)
+		})
+	}
+
+	_, err = NewMapper([]config.GraphiteRule{{Pattern: "a.[.b"}})
+	require.Error(t, err)
+	_, err = NewMapper([]config.GraphiteRule{{Pattern: "a.*", Type: "histogram"}})
+	require.Error(t, err)
+	_, err = NewMapper([]config.GraphiteRule{{Name: "x"}})
+	require.Error(t, err)
+}
+
+func TestListener(t *testing.T) {
+	m, err := NewMapper([]config.GraphiteRule{{Pattern: "jobs.*.runs", Name: "job_runs", Labels: map[string]string{"job": "$2"}, Type: Counter}})
+	require.NoError(t, err)
+	store := &syncRepo{Repository: inmem.New()}
+	l := NewListener(store, m, 0)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error)
+	go func() { served <- l.Serve(ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, "jobs.backup.runs 2 1465839830\nbroken\njobs.backup.runs 3\njobs.backup.runs 0.5\nload.avg 1.5\n")
+
+	conn.Close()
+
+	ctx := context.Background()
+	require.Eventually(t, func() bool {
+		g, err := store.GetGauge(ctx, "load_avg")
+		return err == nil && g == 1.5
+	}, time.Second, 10*time.Millisecond)
+
+	sctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, l.Shutdown(sctx))
+	require.NoError(t, <-served)
+
+	c, err := store.GetCounter(ctx, "job_runs;job=backup")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), c)
+}
+
+// syncRepo serializes access to inmem storage shared with listener goroutines.
+type syncRepo struct {
+	repo.Repository
+	mu sync.Mutex
+}
+
+func (r *syncRepo) UpdateGauge(ctx context.Context, g string, v float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Repository.UpdateGauge(ctx, g, v)
+}
+
+func (r *syncRepo) UpdateCounter(ctx context.Context, c string, v int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Repository.UpdateCounter(ctx, c, v)
+}
+
+func (r *syncRepo) GetGauge(ctx context.Context, g string) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Repository.GetGauge(ctx, g)
+}
+
+func (r *syncRepo) GetCounter(ctx context.Context, c string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Repository.GetCounter(ctx, c)
+}
+
+func TestLimiter(t *testing.T) {
+	done := make(chan struct{})
+	lim := newLimiter(20)
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		require.True(t, lim.wait(done))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	close(done)
+	lim = newLimiter(0.1)
+	require.True(t, lim.wait(done))
+	require.False(t, lim.wait(done))
+}
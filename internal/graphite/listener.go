@@ -0,0 +1,244 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+const (
+	maxLineSize = 64 * 1024
+	idleTimeout = 5 * time.Minute
+)
+
+// Listener - Graphite plaintext TCP listener feeding repository.
+type Listener struct {
+	repo   repo.Repository
+	mapper *Mapper
+	rate   float64
+
+	mu    sync.Mutex
+	ln    net.Listener
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+	done  chan struct{}
+}
+
+// NewListener - creates listener applying samples mapped by mapper to repository.
+// rate limits lines per second of every connection, 0 is unlimited,
+// connections exceeding the limit are throttled.
+func NewListener(repo repo.Repository, mapper *Mapper, rate float64) *Listener {
+	return &Listener{
+		repo:   repo,
+		mapper: mapper,
+		rate:   rate,
+		conns:  make(map[net.Conn]struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// ListenAndServe - listens on TCP address and serves connections,
+// blocks until listener is shut down.
+func (l *Listener) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ln)
+}
+
+// Serve - accepts connections on ln until listener is shut down.
+func (l *Listener) Serve(ln net.Listener) error {
+	l.mu.Lock()
+	select {
+	case <-l.done:
+		l.mu.Unlock()
+		return ln.Close()
+	default:
+	}
+	l.ln = ln
+	l.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-l.done:
+				return nil
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		l.mu.Lock()
+		select {
+		case <-l.done:
+			l.mu.Unlock()
+			conn.Close()
+			return nil
+		default:
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+
+		go l.serve(conn)
+	}
+}
+
+// Addr - returns address listener is bound to, nil if not serving.
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Addr()
+}
+
+// Shutdown - stops accepting connections, interrupts reading of active
+// connections and waits for already received lines to be applied,
+// remaining connections are closed when ctx is done.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	var err error
+	if l.ln != nil {
+		err = l.ln.Close()
+	}
+	for conn := range l.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	l.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+		<-finished
+	}
+	return err
+}
+
+func (l *Listener) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		l.wg.Done()
+	}()
+
+	lim := newLimiter(l.rate)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	for {
+		l.mu.Lock()
+		select {
+		case <-l.done:
+		default:
+			conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+		l.mu.Unlock()
+		if !scanner.Scan() {
+			break
+		}
+		if !lim.wait(l.done) {
+			return
+		}
+		l.Handle(context.Background(), scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, os.ErrDeadlineExceeded) {
+		log.Debug().AnErr("Scan", err).Str("remote", conn.RemoteAddr().String()).Msg("Graphite")
+	}
+}
+
+// Handle - parses single line and applies it to repository.
+func (l *Listener) Handle(ctx context.Context, line string) {
+	if line == "" {
+		return
+	}
+	s, err := ParseLine(line)
+	if err != nil {
+		log.Debug().AnErr("ParseLine", err).Msg("Graphite")
+		return
+	}
+
+	id, typ := l.mapper.Map(s)
+	if typ == Counter {
+		if s.Value != math.Trunc(s.Value) {
+			log.Debug().Str("metric", id).Float64("value", s.Value).Msg("Graphite: non integer counter")
+			return
+		}
+		err = l.repo.UpdateCounter(ctx, id, int64(s.Value))
+	} else {
+		err = l.repo.UpdateGauge(ctx, id, s.Value)
+	}
+	if err != nil {
+		log.Error().AnErr("Update", err).Str("metric", id).Msg("Graphite")
+	}
+}
+
+// limiter - token bucket allowing rate lines per second with burst of one second.
+type limiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64) *limiter {
+	return &limiter{rate: rate, tokens: math.Max(rate, 1), last: time.Now()}
+}
+
+// wait blocks until token is available, returns false if done is closed while waiting.
+func (l *limiter) wait(done <-chan struct{}) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.rate, math.Max(l.rate, 1))
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		l.last = time.Now()
+		l.tokens = 0
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,172 @@
+// Package groups implements push-gateway style grouping of pushed metrics.
+// Metrics pushed into group are labelled with job and instance of the group.
+// Time of the last push and TTL of the group are stored as gauges labelled
+// the same way, so groups survive restarts with any repository backend.
+package groups
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Labels and bookkeeping gauges of groups.
+const (
+	LabelJob       = "job"
+	LabelInstance  = "instance"
+	PushTimeMetric = "push_time_seconds" // unix time of the last push into group
+	PushTTLMetric  = "push_ttl_seconds"  // TTL of group, absent if group never expires
+)
+
+// mu serializes pushes and deletions of groups, so expiry check and
+// deletion of a group are not interleaved with a push into it.
+var mu sync.Mutex
+
+// Group - job and optional instance metrics are pushed for.
+type Group struct {
+	Job      string
+	Instance string
+}
+
+// Path - returns path of group g in server API, "/groups/{job}[/{instance}]",
+// signed by requests deleting the group.
+func (g Group) Path() string {
+	if g.Instance == "" {
+		return "/groups/" + g.Job
+	}
+	return "/groups/" + g.Job + "/" + g.Instance
+}
+
+// FromLabels - returns group of labels, ok is false without job label.
+func FromLabels(labels map[string]string) (Group, bool) {
+	g := Group{Job: labels[LabelJob], Instance: labels[LabelInstance]}
+	return g, g.Job != ""
+}
+
+// Contains - reports whether metric id belongs to group: its job and instance
+// labels equal the group, job-only group has no instance label.
+func (g Group) Contains(id string) bool {
+	_, labels, err := model.ParseSeriesID(id)
+	if err != nil {
+		return false
+	}
+	return labels[LabelJob] == g.Job && labels[LabelInstance] == g.Instance
+}
+
+// ID - returns metric id labelled with group, group labels replace labels of id.
+func (g Group) ID(id string) (string, error) {
+	name, labels, err := model.ParseSeriesID(id)
+	if err != nil {
+		return "", err
+	}
+	labels[LabelJob] = g.Job
+	delete(labels, LabelInstance)
+	if g.Instance != "" {
+		labels[LabelInstance] = g.Instance
+	}
+	return model.SeriesID(name, labels), nil
+}
+
+// Push - stores metrics into group g and records push time and ttl,
+// zero ttl makes the group never expire. Metrics are written at once
+// with push time and ttl, or none of them if any is invalid.
+// Metrics are expected to be validated.
+func Push(ctx context.Context, r repo.Repository, g Group, metrics []model.Metric, ttl time.Duration, now time.Time) error {
+	batch := make([]model.Metric, 0, len(metrics)+2)
+	for _, m := range metrics {
+		id, err := g.ID(m.ID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.MType == "gauge" && m.Value != nil:
+			batch = append(batch, model.Metric{ID: id, MType: m.MType, Value: m.Value})
+		case m.MType == "counter" && m.Delta != nil:
+			batch = append(batch, model.Metric{ID: id, MType: m.MType, Delta: m.Delta})
+		default:
+			return fmt.Errorf("invalid metric %q", m.ID)
+		}
+	}
+
+	timeID, _ := g.ID(PushTimeMetric)
+	pushed := float64(now.UnixNano()) / 1e9
+	batch = append(batch, model.Metric{ID: timeID, MType: "gauge", Value: &pushed})
+	ttlID, _ := g.ID(PushTTLMetric)
+	if ttl > 0 {
+		seconds := ttl.Seconds()
+		batch = append(batch, model.Metric{ID: ttlID, MType: "gauge", Value: &seconds})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := r.UpdateMetrics(ctx, batch); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return nil
+	}
+	if _, err := r.GetGauge(ctx, ttlID); err == nil {
+		return r.DeleteGauge(ctx, ttlID)
+	}
+	return nil
+}
+
+// Delete - deletes all series of group g including bookkeeping gauges,
+// with allInstances series of every instance of g.Job are deleted too.
+// returns number of deleted series.
+func Delete(ctx context.Context, r repo.Repository, g Group, allInstances bool) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return deleteGroup(ctx, r, g, allInstances)
+}
+
+// deleteGroup deletes series of group g like Delete, mu must be held.
+func deleteGroup(ctx context.Context, r repo.Repository, g Group, allInstances bool) (int, error) {
+	contains := g.Contains
+	if allInstances {
+		contains = func(id string) bool {
+			_, labels, err := model.ParseSeriesID(id)
+			return err == nil && labels[LabelJob] == g.Job
+		}
+	}
+
+	gauges, err := r.GetGaugeAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var gaugeIDs []string
+	for id := range gauges {
+		if contains(id) {
+			gaugeIDs = append(gaugeIDs, id)
+		}
+	}
+	counters, err := r.GetCounterAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var counterIDs []string
+	for id := range counters {
+		if contains(id) {
+			counterIDs = append(counterIDs, id)
+		}
+	}
+
+	deleted := 0
+	for _, id := range gaugeIDs {
+		if err := r.DeleteGauge(ctx, id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	for _, id := range counterIDs {
+		if err := r.DeleteCounter(ctx, id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
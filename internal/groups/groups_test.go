@@ -0,0 +1,125 @@
+package groups
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func gauge(id string, v float64) model.Metric {
+	return model.Metric{ID: id, MType: "gauge", Value: &v}
+}
+
+func counter(id string, d int64) model.Metric {
+	return model.Metric{ID: id, MType: "counter", Delta: &d}
+}
+
+func TestGroupID(t *testing.T) {
+	g := Group{Job: "backup", Instance: "db1"}
+	id, err := g.ID("duration;instance=x;tier=1")
+	require.NoError(t, err)
+	require.Equal(t, "duration;instance=db1;job=backup;tier=1", id)
+	require.True(t, g.Contains(id))
+
+	job := Group{Job: "backup"}
+	id, err = job.ID("duration;instance=x")
+	require.NoError(t, err)
+	require.Equal(t, "duration;job=backup", id)
+	require.True(t, job.Contains(id))
+	require.False(t, g.Contains(id))
+}
+
+func TestPushDeleteSweep(t *testing.T) {
+	ctx := context.Background()
+	r := inmem.New()
+	now := time.Unix(1000, 0)
+
+	require.NoError(t, r.UpdateGauge(ctx, "cpu", 1))
+	require.NoError(t, Push(ctx, r, Group{Job: "backup", Instance: "db1"},
+		[]model.Metric{gauge("last_success", 1), counter("files", 10)}, time.Minute, now))
+	require.NoError(t, Push(ctx, r, Group{Job: "backup", Instance: "db2"},
+		[]model.Metric{gauge("last_success", 0)}, 0, now))
+	require.NoError(t, Push(ctx, r, Group{Job: "report"},
+		[]model.Metric{gauge("pages", 3)}, 10*time.Minute, now))
+
+	ttl, err := r.GetGauge(ctx, "push_ttl_seconds;instance=db1;job=backup")
+	require.NoError(t, err)
+	require.Equal(t, 60.0, ttl)
+	pushed, err := r.GetGauge(ctx, "push_time_seconds;job=report")
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, pushed)
+
+	j := NewJanitor(r, 0)
+	n, err := j.Sweep(ctx, now.Add(30*time.Second))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// db1 expired, db2 never expires, report is still fresh
+	n, err = j.Sweep(ctx, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	_, err = r.GetGauge(ctx, "last_success;instance=db1;job=backup")
+	require.Error(t, err)
+	_, err = r.GetCounter(ctx, "files;instance=db1;job=backup")
+	require.Error(t, err)
+	_, err = r.GetGauge(ctx, "last_success;instance=db2;job=backup")
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		"server_groups_expired":        1,
+		"server_groups_expired_series": 4,
+	}, j.Gauges())
+
+	// repeated push without ttl removes expiry
+	require.NoError(t, Push(ctx, r, Group{Job: "report"}, nil, 0, now))
+	n, err = j.Sweep(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	n, err = Delete(ctx, r, Group{Job: "backup"}, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	n, err = Delete(ctx, r, Group{Job: "report"}, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	gauges, _ := r.GetGaugeAll(ctx)
+	require.Equal(t, map[string]float64{"cpu": 1}, gauges)
+}
+
+func TestPushInvalid(t *testing.T) {
+	ctx := context.Background()
+	r := inmem.New()
+	err := Push(ctx, r, Group{Job: "backup"},
+		[]model.Metric{gauge("last_success", 1), gauge("files;=x", 2)}, time.Minute, time.Unix(1000, 0))
+	require.Error(t, err)
+
+	// nothing of the group is written
+	gauges, _ := r.GetGaugeAll(ctx)
+	require.Empty(t, gauges)
+}
+
+func TestExpirePushedAgain(t *testing.T) {
+	ctx := context.Background()
+	r := inmem.New()
+	now := time.Unix(1000, 0)
+	g := Group{Job: "backup"}
+	require.NoError(t, Push(ctx, r, g, []model.Metric{gauge("last_success", 1)}, time.Minute, now))
+
+	// group pushed again after sweep found it expired is kept
+	require.NoError(t, Push(ctx, r, g, nil, time.Minute, now.Add(90*time.Second)))
+	j := NewJanitor(r, 0)
+	n, err := j.expire(ctx, g, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, n)
+	_, err = r.GetGauge(ctx, "last_success;job=backup")
+	require.NoError(t, err)
+
+	n, err = j.expire(ctx, g, now.Add(3*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+}
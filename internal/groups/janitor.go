@@ -0,0 +1,122 @@
+package groups
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// DefaultJanitorInterval - default interval between janitor sweeps.
+const DefaultJanitorInterval = time.Minute
+
+// Janitor - periodically deletes groups not pushed within their TTL.
+type Janitor struct {
+	// accessed atomically, first in struct for 64-bit alignment
+	expiredGroups int64
+	expiredSeries int64
+
+	repo     repo.Repository
+	interval time.Duration
+}
+
+// NewJanitor - creates janitor of repository r sweeping every interval.
+func NewJanitor(r repo.Repository, interval time.Duration) *Janitor {
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+	return &Janitor{repo: r, interval: interval}
+}
+
+// Run - sweeps repository every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if _, err := j.Sweep(ctx, now); err != nil {
+				log.Error().AnErr("Sweep", err).Msg("Janitor")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep - deletes groups which last push is older than their TTL at now.
+// returns number of deleted series.
+func (j *Janitor) Sweep(ctx context.Context, now time.Time) (int, error) {
+	gauges, err := j.repo.GetGaugeAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []Group
+	for id, ttl := range gauges {
+		name, labels, err := model.ParseSeriesID(id)
+		if err != nil || name != PushTTLMetric || ttl <= 0 {
+			continue
+		}
+		g, ok := FromLabels(labels)
+		if !ok {
+			continue
+		}
+		timeID, _ := g.ID(PushTimeMetric)
+		pushed, ok := gauges[timeID]
+		if !ok {
+			continue
+		}
+		if float64(now.UnixNano())/1e9 > pushed+ttl {
+			expired = append(expired, g)
+		}
+	}
+
+	total := 0
+	for _, g := range expired {
+		n, err := j.expire(ctx, g, now)
+		total += n
+		atomic.AddInt64(&j.expiredSeries, int64(n))
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			// pushed again since the check
+			continue
+		}
+		atomic.AddInt64(&j.expiredGroups, 1)
+		log.Debug().Str("job", g.Job).Str("instance", g.Instance).Int("series", n).Msg("Janitor: group expired")
+	}
+	return total, nil
+}
+
+// expire deletes group g if it is still expired at now, the check and deletion
+// hold the group lock, so a push in between keeps the group.
+// returns number of deleted series, zero if the group is not expired.
+func (j *Janitor) expire(ctx context.Context, g Group, now time.Time) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	timeID, _ := g.ID(PushTimeMetric)
+	ttlID, _ := g.ID(PushTTLMetric)
+	pushed, err := j.repo.GetGauge(ctx, timeID)
+	if err != nil {
+		return 0, nil
+	}
+	ttl, err := j.repo.GetGauge(ctx, ttlID)
+	if err != nil || ttl <= 0 || float64(now.UnixNano())/1e9 <= pushed+ttl {
+		return 0, nil
+	}
+	return deleteGroup(ctx, j.repo, g, false)
+}
+
+// Gauges - returns number of expired groups and series as server self-metrics.
+func (j *Janitor) Gauges() map[string]float64 {
+	return map[string]float64{
+		"server_groups_expired":        float64(atomic.LoadInt64(&j.expiredGroups)),
+		"server_groups_expired_series": float64(atomic.LoadInt64(&j.expiredSeries)),
+	}
+}
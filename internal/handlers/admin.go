@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Admin - implements handler for "/admin/{action}" accepting admin.Request
+// signed with admin key. Responds with admin.Result, with recent audit
+// records for action "audit" or with agents of reg for action "agents".
+func Admin(svc *admin.Service, reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action := chi.URLParam(r, "action")
+
+		req := admin.Request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Debug().AnErr("Decode", err).Msg("Admin")
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+
+		var (
+			resp interface{}
+			err  error
+		)
+		switch action {
+		case admin.ActionAudit:
+			resp, err = svc.Audit(req)
+		case admin.ActionAgents:
+			if err = svc.Authorize(action, req); err == nil {
+				resp = reg.List(time.Now())
+			}
+		default:
+			resp, err = svc.Do(r.Context(), action, req)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), adminStatus(err))
+			return
+		}
+
+		b, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, "failed to build response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}
+}
+
+// adminStatus returns HTTP status of admin error err.
+func adminStatus(err error) int {
+	switch {
+	case errors.Is(err, admin.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, admin.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, repo.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repo.ErrExists):
+		return http.StatusConflict
+	}
+	log.Error().AnErr("Do", err).Msg("Admin")
+	return http.StatusInternalServerError
+}
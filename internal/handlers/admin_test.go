@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestAdmin(t *testing.T) {
+	key := []byte("admin")
+	repo := inmem.New()
+	require.NoError(t, repo.UpdateGauge(context.Background(), "old", 1))
+	require.NoError(t, repo.UpdateGauge(context.Background(), "new", 2))
+	audit, err := admin.OpenAuditLog("", admin.DefaultAuditSize)
+	require.NoError(t, err)
+	handler := chi.NewRouter()
+	handler.Post("/admin/{action}", Admin(admin.NewService(repo, key, audit), registry.New(0)))
+
+	body := func(action string, req admin.Request) string {
+		req = req.Signed(action, key, time.Now())
+		b, err := json.Marshal(req)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	tests := []struct {
+		name   string
+		action string
+		body   string
+		code   int
+		resp   string
+	}{
+		{"invalid body", "delete", "{", http.StatusBadRequest, ""},
+		{"unsigned", "delete", `{"type":"gauge","id":"old"}`, http.StatusUnauthorized, ""},
+		{"unknown action", "drop", body("drop", admin.Request{}), http.StatusBadRequest, ""},
+		{"exists", "rename", body("rename", admin.Request{Type: "gauge", ID: "old", To: "new"}), http.StatusConflict, ""},
+		{"merge", "rename", body("rename", admin.Request{Type: "gauge", ID: "old", To: "new", Merge: true}), http.StatusOK,
+			`{"metrics":[{"type":"gauge","id":"new"}]}`},
+		{"not found", "reset", body("reset", admin.Request{ID: "missing"}), http.StatusNotFound, ""},
+		{"agents unsigned", "agents", `{}`, http.StatusUnauthorized, ""},
+		{"agents signed for audit", "agents", body("audit", admin.Request{}), http.StatusUnauthorized, ""},
+		{"agents", "agents", body("agents", admin.Request{}), http.StatusOK, `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/"+tt.action, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.resp != "" {
+				require.JSONEq(t, tt.resp, rr.Body.String())
+			}
+		})
+	}
+
+	v, err := repo.GetGauge(context.Background(), "new")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, v)
+}
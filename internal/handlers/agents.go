@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+)
+
+// Agents - implements handler for "/agents" returning list of agents known
+// to the server with their last report time, transport, version and status.
+// With key configured the request must be signed like DELETE of "/groups/{job}".
+func Agents(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+		if err := validTimedHash(r, key); err != nil {
+			log.Debug().AnErr("ValidateTimed", err).Msg("Agents")
+			http.Error(w, "invalid hash", http.StatusUnauthorized)
+			return
+		}
+
+		writeJSON(w, reg.List(time.Now()))
+	}
+}
+
+// RegisterAgent - implements handler for "/agents/register" accepting
+// registry.Registration and responding with registry.RegistrationResponse.
+// With key configured the registration must be signed with registry.Sign and
+// binds agent ID to the remote address of the request.
+func RegisterAgent(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req registry.Registration
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+		if !validAgentHash(r, req.ID, registry.ActionRegister, req.Hash) {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := reg.Register(req, model.TransportHTTP, time.Now())
+		if err != nil {
+			agentError(w, err, "RegisterAgent")
+			return
+		}
+		if key, _ := r.Context().Value(mw.CtxKey{}).([]byte); len(key) > 0 {
+			if src, ok := model.SourceFromContext(r.Context()); ok {
+				reg.Bind(req.ID, src.Addr)
+			}
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// AgentHeartbeat - implements handler for "/agents/heartbeat" accepting
+// registry.Heartbeat and responding with registry.HeartbeatResponse.
+// With key configured the heartbeat must be signed with registry.Sign.
+func AgentHeartbeat(reg *registry.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req registry.Heartbeat
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+		if !validAgentHash(r, req.ID, registry.ActionHeartbeat, req.Hash) {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := reg.Heartbeat(req, model.TransportHTTP, time.Now())
+		if err != nil {
+			agentError(w, err, "AgentHeartbeat")
+			return
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// AgentConfig - implements handler for "/agents/config" accepting profiles.Request
+// and responding with profiles.Response selected for the agent, or with
+// 204 No Content if no profile applies. Version applied by agent is recorded in reg.
+// With key configured the request must be signed with registry.Sign.
+func AgentConfig(reg *registry.Registry, store *profiles.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req profiles.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+		if !validAgentHash(r, req.ID, registry.ActionConfig, req.Hash) {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+
+		reg.Applied(req.ID, req.Applied)
+		resp, ok := store.Match(req.Hostname, req.Labels)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, resp)
+	}
+}
+
+// validAgentHash reports whether h is signature of agent id for action, any hash is valid without key.
+func validAgentHash(r *http.Request, id, action, h string) bool {
+	var key []byte
+	ctxKey := r.Context().Value(mw.CtxKey{})
+	if ctxKey != nil {
+		key = ctxKey.([]byte)
+	}
+	return len(key) == 0 || hmac.Equal([]byte(h), []byte(registry.Sign(id, action, key)))
+}
+
+func agentError(w http.ResponseWriter, err error, caller string) {
+	if errors.Is(err, registry.ErrUnknownAgent) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	log.Error().AnErr("Registry", err).Msg(caller)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "failed to build response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+)
+
+func TestAgents(t *testing.T) {
+	key := []byte("secret")
+	reg := registry.New(0)
+	reg.Seen(model.Source{Agent: "host1", Transport: model.TransportHTTP}, time.Now())
+	handler := chi.NewRouter()
+	handler.Use(mw.KeyInject(key))
+	handler.Get("/agents", Agents(reg))
+
+	now := time.Now().Unix()
+	tests := []struct {
+		name string
+		hash string
+		ts   int64
+		want int
+	}{
+		{"unsigned", "", 0, http.StatusUnauthorized},
+		{"signed for other path", hash.CreateTimed("/groups/job", now, key), now, http.StatusUnauthorized},
+		{"stale", hash.CreateTimed("/agents", now-3600, key), now - 3600, http.StatusUnauthorized},
+		{"signed", hash.CreateTimed("/agents", now, key), now, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/agents", nil)
+			if tt.hash != "" {
+				req.Header.Set("X-Hash", tt.hash)
+				req.Header.Set(HeaderTimestamp, strconv.FormatInt(tt.ts, 10))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tt.want, w.Code)
+			if tt.want != http.StatusOK {
+				return
+			}
+			var list []registry.Agent
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+			require.Len(t, list, 1)
+			assert.Equal(t, "host1", list[0].ID)
+		})
+	}
+}
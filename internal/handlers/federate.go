@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/federate"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Federate - implements handler for "/federate" returning federate.Response
+// with metrics filtered by "match" name prefixes and "label" values.
+// Metrics updated after "since_version" of "epoch" or after "since" are
+// returned if the cursor is still valid, otherwise full snapshot is returned.
+// With key configured the request must be signed: header X-Hash holds
+// federate.SignQuery of the raw query, returned metrics are signed as in "/value/".
+func Federate(repo repo.Repository, j *federate.Journal) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+
+		if len(key) != 0 && !hmac.Equal([]byte(r.Header.Get("X-Hash")), []byte(federate.SignQuery(r.URL.RawQuery, key))) {
+			http.Error(w, "invalid hash", http.StatusUnauthorized)
+			return
+		}
+
+		q, err := federate.ParseQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := federate.Snapshot(r.Context(), repo, j, q, key)
+		if err != nil {
+			log.Error().AnErr("Snapshot", err).Msg("Federate")
+			http.Error(w, "failed to get metrics", http.StatusInternalServerError)
+			return
+		}
+
+		out, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, "failed to build response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/rs/zerolog/log"
 
+	"github.com/andrei-cloud/go-devops/internal/bulk"
 	"github.com/andrei-cloud/go-devops/internal/hash"
 	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
 	"github.com/andrei-cloud/go-devops/internal/model"
@@ -46,7 +47,8 @@ func GetMetrics(repo repo.Repository) http.HandlerFunc {
 }
 
 // GetMetricsPost - implements handler function for "/value/" handler.
-// Handler return the value of metric requested in the body of th POST request.
+// Handler return the value of metric requested in the body of th POST request
+// together with time and source agent of its last update.
 func GetMetricsPost(repo repo.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var key []byte
@@ -93,6 +95,14 @@ func GetMetricsPost(repo repo.Repository) http.HandlerFunc {
 			return
 		}
 
+		metric.Updated, metric.Source = nil, ""
+		if md, err := repo.GetMetadata(r.Context(), metric.MType, metric.ID); err == nil {
+			metric.Updated = &md.Updated
+			metric.Source = md.Source
+		} else {
+			log.Debug().AnErr("GetMetadata", err).Msg("GetMetricsPost")
+		}
+
 		if resp, err := json.Marshal(metric); err != nil {
 			http.Error(w, "failed to build response", http.StatusInternalServerError)
 		} else {
@@ -101,3 +111,32 @@ func GetMetricsPost(repo repo.Repository) http.HandlerFunc {
 		}
 	}
 }
+
+// GetMetricsBulkPost - implements handler function for "/values/" handler.
+// Handler accepts array of metrics identified by id and type in the body of
+// the POST request and returns array of bulk.Result in the same order with
+// values, hashes and metadata of found metrics and errors of missing ones.
+func GetMetricsBulkPost(repo repo.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+
+		metrics := []model.Metric{}
+		if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+			log.Debug().AnErr("Decode", err).Msg("GetMetricsBulkPost")
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := json.Marshal(bulk.Get(r.Context(), repo, metrics, key))
+		if err != nil {
+			http.Error(w, "failed to build response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/andrei-cloud/go-devops/internal/bulk"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
 	"github.com/andrei-cloud/go-devops/internal/mocks"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
 	"github.com/go-chi/chi"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -146,6 +153,7 @@ func TestGetMetricsPost(t *testing.T) {
 	mockDB.EXPECT().GetGauge(gomock.Any(), "testfail").Return(float64(.0), err).AnyTimes()
 	mockDB.EXPECT().GetCounter(gomock.Any(), "testcounter").Return(int64(1234), nil).AnyTimes()
 	mockDB.EXPECT().GetCounter(gomock.Any(), "testfail").Return(int64(0), err).AnyTimes()
+	mockDB.EXPECT().GetMetadata(gomock.Any(), gomock.Any(), gomock.Any()).Return(model.Metadata{}, err).AnyTimes()
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -164,3 +172,33 @@ func TestGetMetricsPost(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMetricsBulkPost(t *testing.T) {
+	key := []byte("secret")
+	repo := inmem.New()
+	require.NoError(t, repo.UpdateGauge(context.Background(), "alloc", 1.5))
+	require.NoError(t, repo.UpdateCounter(context.Background(), "poll_count", 3))
+	handler := chi.NewRouter()
+	handler.Use(mw.KeyInject(key))
+	handler.Post("/values/", GetMetricsBulkPost(repo))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/values/", strings.NewReader("{")))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	body := `[{"id":"poll_count","type":"counter"},{"id":"missing","type":"gauge"},{"id":"alloc","type":"gauge"},{"id":"x","type":"summary"}]`
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/values/", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var results []bulk.Result
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &results))
+	require.Len(t, results, 4)
+	require.Equal(t, int64(3), *results[0].Delta)
+	require.Equal(t, hash.Create("poll_count:counter:3", key), results[0].Hash)
+	require.Equal(t, "not found", results[1].Error)
+	require.Nil(t, results[1].Value)
+	require.Equal(t, 1.5, *results[2].Value)
+	require.NotNil(t, results[2].Updated)
+	require.Contains(t, results[3].Error, "invalid metric type")
+}
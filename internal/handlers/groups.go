@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/groups"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// HeaderTimestamp - header of unix time in seconds the request was signed at.
+const HeaderTimestamp = "X-Timestamp"
+
+// DeleteGroupResult - response of group deletion.
+type DeleteGroupResult struct {
+	Deleted int `json:"deleted"` // number of deleted series
+}
+
+// PushGroup - implements handler for "/groups/{job}" and "/groups/{job}/{instance}"
+// accepting metrics in "/updates/" format. Metrics are labelled with job and
+// instance of the group and the group expires after "ttl" query parameter,
+// ttl of the server is used if parameter is absent, "0" disables expiry.
+// All metrics are validated before any is stored.
+func PushGroup(repo repo.Repository, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+
+		g := groups.Group{Job: chi.URLParam(r, "job"), Instance: chi.URLParam(r, "instance")}
+
+		reqTTL := ttl
+		if s := r.URL.Query().Get("ttl"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 {
+				http.Error(w, "invalid ttl", http.StatusBadRequest)
+				return
+			}
+			reqTTL = d
+		}
+
+		metrics := []model.Metric{}
+		if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+			log.Debug().AnErr("Decode", err).Msg("PushGroup")
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+
+		for _, m := range metrics {
+			if (m.MType != "gauge" || m.Value == nil) && (m.MType != "counter" || m.Delta == nil) {
+				http.Error(w, "invalid resquest", http.StatusBadRequest)
+				return
+			}
+			if valid, err := hash.Validate(m, key); !valid || err != nil {
+				log.Debug().AnErr("Validate", err).Msg("PushGroup")
+				http.Error(w, "invalid resquest", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := groups.Push(r.Context(), repo, g, metrics, reqTTL, time.Now()); err != nil {
+			log.Error().AnErr("Push", err).Msg("PushGroup")
+			http.Error(w, "failed to update", updateStatus(err))
+			return
+		}
+	}
+}
+
+// DeleteGroup - implements handler for DELETE of "/groups/{job}/{instance}"
+// deleting all series of the group and "/groups/{job}" deleting series of
+// every group of the job. Responds with DeleteGroupResult.
+// With key configured the request must be signed: header X-Hash holds hash.CreateTimed
+// of the URL path and HeaderTimestamp, which must be within hash.MaxSkew of server time.
+func DeleteGroup(repo repo.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+
+		if err := validTimedHash(r, key); err != nil {
+			log.Debug().AnErr("ValidateTimed", err).Msg("DeleteGroup")
+			http.Error(w, "invalid hash", http.StatusUnauthorized)
+			return
+		}
+
+		g := groups.Group{Job: chi.URLParam(r, "job"), Instance: chi.URLParam(r, "instance")}
+		n, err := groups.Delete(r.Context(), repo, g, g.Instance == "")
+		if err != nil {
+			log.Error().AnErr("Delete", err).Msg("DeleteGroup")
+			http.Error(w, "failed to delete", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := json.Marshal(DeleteGroupResult{Deleted: n})
+		if err != nil {
+			http.Error(w, "failed to build response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
+
+// validTimedHash checks that request r is signed with key: header X-Hash holds
+// hash.CreateTimed of the URL path and HeaderTimestamp. Any request is valid without key.
+func validTimedHash(r *http.Request, key []byte) error {
+	if len(key) == 0 {
+		return nil
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return err
+	}
+	return hash.ValidateTimed(r.URL.Path, ts, r.Header.Get("X-Hash"), key, time.Now())
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestGroups(t *testing.T) {
+	key := []byte("secret")
+	repo := inmem.New()
+	handler := chi.NewRouter()
+	handler.Use(mw.KeyInject(key))
+	handler.Post("/groups/{job}/{instance}", PushGroup(repo, 0))
+	handler.Delete("/groups/{job}", DeleteGroup(repo))
+	handler.Delete("/groups/{job}/{instance}", DeleteGroup(repo))
+
+	body := fmt.Sprintf(`[{"id":"duration","type":"gauge","value":1.5,"hash":%q}]`,
+		hash.Create(fmt.Sprintf("duration:gauge:%f", 1.5), key))
+
+	now := time.Now().Unix()
+	stale := now - int64(hash.MaxSkew/time.Second) - 1
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		hash   string
+		ts     int64
+		code   int
+		resp   string
+	}{
+		{"push", http.MethodPost, "/groups/backup/db1?ttl=5m", body, "", 0, http.StatusOK, ""},
+		{"invalid ttl", http.MethodPost, "/groups/backup/db1?ttl=x", body, "", 0, http.StatusBadRequest, ""},
+		{"invalid hash", http.MethodPost, "/groups/backup/db1", `[{"id":"duration","type":"gauge","value":2}]`, "", 0, http.StatusBadRequest, ""},
+		{"delete unsigned", http.MethodDelete, "/groups/backup/db1", "", "", 0, http.StatusUnauthorized, ""},
+		{"delete untimed", http.MethodDelete, "/groups/backup/db1", "", hash.Create("/groups/backup/db1", key), 0, http.StatusUnauthorized, ""},
+		{"delete stale", http.MethodDelete, "/groups/backup/db1", "", hash.CreateTimed("/groups/backup/db1", stale, key), stale, http.StatusUnauthorized, ""},
+		{"delete", http.MethodDelete, "/groups/backup/db1", "", hash.CreateTimed("/groups/backup/db1", now, key), now, http.StatusOK, `{"deleted":3}`},
+		{"delete job", http.MethodDelete, "/groups/backup", "", hash.CreateTimed("/groups/backup", now, key), now, http.StatusOK, `{"deleted":0}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.hash != "" {
+				req.Header.Set("X-Hash", tt.hash)
+			}
+			if tt.ts != 0 {
+				req.Header.Set(HeaderTimestamp, strconv.FormatInt(tt.ts, 10))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.resp != "" {
+				require.JSONEq(t, tt.resp, rr.Body.String())
+			}
+			if tt.name == "push" {
+				v, err := repo.GetGauge(context.Background(), "duration;instance=db1;job=backup")
+				require.NoError(t, err)
+				require.Equal(t, 1.5, v)
+			}
+		})
+	}
+}
+
+func TestPushGroupTTL(t *testing.T) {
+	repo := inmem.New()
+	handler := chi.NewRouter()
+	handler.Post("/groups/{job}/{instance}", PushGroup(repo, time.Hour))
+
+	body := `[{"id":"duration","type":"gauge","value":1.5}]`
+	for _, target := range []string{"/groups/backup/db1?ttl=0", "/groups/backup/db2"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// ttl of a request does not change ttl of the next ones
+	_, err := repo.GetGauge(context.Background(), "push_ttl_seconds;instance=db1;job=backup")
+	require.Error(t, err)
+	v, err := repo.GetGauge(context.Background(), "push_ttl_seconds;instance=db2;job=backup")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour.Seconds(), v)
+}
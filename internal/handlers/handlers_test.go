@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/andrei-cloud/go-devops/internal/model"
 	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
@@ -64,7 +65,9 @@ func ExampleGetMetricsPost() {
 		MType: "gauge",
 	}
 
-	repo.UpdateGauge(context.Background(), m.ID, v)
+	ctx := model.WithSource(context.Background(), model.Source{Agent: "host1", Transport: model.TransportHTTP})
+	ctx = model.WithUpdated(ctx, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC))
+	repo.UpdateGauge(ctx, m.ID, v)
 
 	body, _ := json.Marshal(m)
 	req, _ := http.NewRequest("POST", "/value/", bytes.NewReader(body))
@@ -79,7 +82,7 @@ func ExampleGetMetricsPost() {
 
 	// Output:
 	// 200
-	// {"id":"test","type":"gauge","value":0.123}
+	// {"id":"test","type":"gauge","value":0.123,"updated":"2022-01-02T03:04:05Z","source":"host1"}
 }
 
 func ExamplePing() {
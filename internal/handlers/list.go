@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/internal/search"
+)
+
+// ListMetrics - implements handler for "/api/metrics" returning search.Page
+// with metrics filtered by "prefix", "glob", "regex" and "type", sorted by
+// "sort" in "order" and paginated with "limit" and "cursor" query parameters.
+// With key configured returned metrics are signed as in "/value/".
+func ListMetrics(repo repo.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+
+		q, err := search.ParseQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := search.List(r.Context(), repo, q, key)
+		if err != nil {
+			log.Error().AnErr("List", err).Msg("ListMetrics")
+			http.Error(w, "failed to get metrics", http.StatusInternalServerError)
+			return
+		}
+
+		out, err := json.Marshal(page)
+		if err != nil {
+			http.Error(w, "failed to build response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/search"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestListMetrics(t *testing.T) {
+	repo := inmem.New()
+	require.NoError(t, repo.UpdateGauge(context.Background(), "alloc", 1.5))
+	require.NoError(t, repo.UpdateCounter(context.Background(), "poll_count", 3))
+	handler := chi.NewRouter()
+	handler.Use(mw.KeyInject([]byte("secret")))
+	handler.Get("/api/metrics", ListMetrics(repo))
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		ids    []string
+	}{
+		{"all", "/api/metrics", http.StatusOK, []string{"alloc", "poll_count"}},
+		{"type", "/api/metrics?type=counter", http.StatusOK, []string{"poll_count"}},
+		{"desc", "/api/metrics?order=desc&limit=1", http.StatusOK, []string{"poll_count"}},
+		{"invalid", "/api/metrics?limit=-1", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.code != http.StatusOK {
+				return
+			}
+			var page search.Page
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+			var ids []string
+			for _, m := range page.Metrics {
+				ids = append(ids, m.ID)
+				require.NotEmpty(t, m.Hash)
+			}
+			require.Equal(t, tt.ids, ids)
+		})
+	}
+}
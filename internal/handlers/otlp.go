@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP/HTTP content types.
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+// OTLPMetrics - implements handler for "/v1/metrics" accepting OTLP/HTTP
+// export requests encoded as binary protobuf or JSON. Response is encoded
+// the same way as request.
+func OTLPMetrics(svc colpb.MetricsServiceServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		var (
+			unmarshal func([]byte, proto.Message) error
+			marshal   func(proto.Message) ([]byte, error)
+		)
+		switch contentType {
+		case ContentTypeProtobuf:
+			unmarshal, marshal = proto.Unmarshal, proto.Marshal
+		case ContentTypeJSON:
+			unmarshal, marshal = protojson.Unmarshal, protojson.Marshal
+		default:
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWriteBody))
+		if err != nil {
+			log.Error().AnErr("ReadAll", err).Msg("OTLPMetrics")
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		req := &colpb.ExportMetricsServiceRequest{}
+		if err := unmarshal(body, req); err != nil {
+			log.Debug().AnErr("Unmarshal", err).Msg("OTLPMetrics")
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := svc.Export(r.Context(), req)
+		if err != nil {
+			log.Error().AnErr("Export", err).Msg("OTLPMetrics")
+			code := http.StatusInternalServerError
+			switch status.Code(err) {
+			case codes.PermissionDenied:
+				code = http.StatusForbidden
+			case codes.Unauthenticated:
+				code = http.StatusUnauthorized
+			}
+			http.Error(w, "failed to export", code)
+			return
+		}
+
+		out, err := marshal(resp)
+		if err != nil {
+			log.Error().AnErr("Marshal", err).Msg("OTLPMetrics")
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+	}
+}
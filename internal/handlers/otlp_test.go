@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/andrei-cloud/go-devops/internal/otlp"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	repo := inmem.New()
+	handler := OTLPMetrics(otlp.NewReceiver(repo, otlp.NewTranslator(config.OtlpConfig{})))
+
+	req := &colpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+			Name: "temperature",
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{{
+				Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5},
+			}}}},
+		}}}},
+	}}}
+	pbBody, err := proto.Marshal(req)
+	require.NoError(t, err)
+	jsonBody, err := protojson.Marshal(req)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		code        int
+	}{
+		{"protobuf", ContentTypeProtobuf, pbBody, http.StatusOK},
+		{"json", ContentTypeJSON + "; charset=utf-8", jsonBody, http.StatusOK},
+		{"invalid body", ContentTypeProtobuf, []byte("garbage"), http.StatusBadRequest},
+		{"unsupported content type", "text/plain", pbBody, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+			require.Equal(t, tt.code, rr.Code)
+			if tt.code == http.StatusOK {
+				require.Contains(t, tt.contentType, rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	v, err := repo.GetGauge(context.Background(), "temperature")
+	require.NoError(t, err)
+	require.Equal(t, 21.5, v)
+}
@@ -2,15 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi"
 	"github.com/rs/zerolog/log"
 
+	"github.com/andrei-cloud/go-devops/internal/bulk"
 	"github.com/andrei-cloud/go-devops/internal/hash"
 	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
 	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/registry"
 	"github.com/andrei-cloud/go-devops/internal/repo"
 )
 
@@ -31,7 +34,7 @@ func Update(repo repo.Repository) http.HandlerFunc {
 			} else {
 				if err := repo.UpdateGauge(r.Context(), metricName, value); err != nil {
 					log.Error().AnErr("UpdateGauge", err).Msg("Update")
-					http.Error(w, "failed to update", http.StatusInternalServerError)
+					http.Error(w, "failed to update", updateStatus(err))
 					return
 				}
 			}
@@ -43,7 +46,7 @@ func Update(repo repo.Repository) http.HandlerFunc {
 			} else {
 				if err := repo.UpdateCounter(r.Context(), metricName, value); err != nil {
 					log.Error().AnErr("UpdateCounter", err).Msg("Update")
-					http.Error(w, "failed to update", http.StatusInternalServerError)
+					http.Error(w, "failed to update", updateStatus(err))
 					return
 				}
 			}
@@ -88,7 +91,7 @@ func UpdatePost(repo repo.Repository) http.HandlerFunc {
 			if valid && metric.Value != nil {
 				if err := repo.UpdateGauge(r.Context(), metric.ID, *metric.Value); err != nil {
 					log.Error().AnErr("UpdateGauge", err).Msg("UpdatePost")
-					http.Error(w, "failed to update", http.StatusInternalServerError)
+					http.Error(w, "failed to update", updateStatus(err))
 					return
 				}
 			} else {
@@ -99,7 +102,7 @@ func UpdatePost(repo repo.Repository) http.HandlerFunc {
 			if valid && metric.Delta != nil {
 				if err := repo.UpdateCounter(r.Context(), metric.ID, *metric.Delta); err != nil {
 					log.Error().AnErr("UpdateCounter", err).Msg("UpdatePost")
-					http.Error(w, "failed to update", http.StatusInternalServerError)
+					http.Error(w, "failed to update", updateStatus(err))
 					return
 				}
 			} else {
@@ -115,7 +118,9 @@ func UpdatePost(repo repo.Repository) http.HandlerFunc {
 
 // UpdateBulkPost - implements handler for "/updates/" in bulk.
 // Multiple metrics cann be updated at the same time.
-// Handler accepts metric parameters via POST request body.
+// Handler accepts metric parameters via POST request body and responds with
+// report of accepted and rejected metrics, with 207 if only some of them were accepted.
+// With "?atomic=true" the batch is applied in whole or not at all.
 func UpdateBulkPost(repo repo.Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var key []byte
@@ -124,51 +129,68 @@ func UpdateBulkPost(repo repo.Repository) http.HandlerFunc {
 			key = ctxKey.([]byte)
 		}
 
-		if r.Header.Get("Content-Type") != "application/json" {
+		atomic := false
+		if s := r.URL.Query().Get("atomic"); s != "" {
+			var err error
+			if atomic, err = strconv.ParseBool(s); err != nil {
+				http.Error(w, "invalid atomic parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// metrics of request with invalid content type are still updated,
+		// but error is reported instead of report
+		invalidType := r.Header.Get("Content-Type") != "application/json"
+		if invalidType {
 			http.Error(w, "invalid content type", http.StatusInternalServerError)
 		}
 
 		metrics := []model.Metric{}
 		if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
 			log.Debug().AnErr("Decode", err).Msg("UpdateBulkPost")
-			http.Error(w, "invalid resquest", http.StatusInternalServerError)
+			if !invalidType {
+				http.Error(w, "invalid resquest", http.StatusInternalServerError)
+			}
+			return
 		}
 
-		for _, m := range metrics {
-			valid, err := hash.Validate(m, key)
-			if err != nil {
-				log.Debug().AnErr("Validate", err).Msg("UpdateBulkPost")
-				http.Error(w, "invalid resquest", http.StatusBadRequest)
-				return
-			}
+		report := bulk.Update(r.Context(), repo, metrics, key, atomic)
+		if invalidType {
+			return
+		}
 
-			switch m.MType {
-			case "gauge":
-				if valid && m.Value != nil {
-					if err := repo.UpdateGauge(r.Context(), m.ID, *m.Value); err != nil {
-						log.Debug().AnErr("UpdateGauge", err).Msg("UpdateBulkPost")
-						http.Error(w, "failed to update", http.StatusInternalServerError)
-						return
-					}
-				} else {
-					http.Error(w, "invalid resquest", http.StatusBadRequest)
-					return
-				}
-			case "counter":
-				if valid && m.Delta != nil {
-					if err := repo.UpdateCounter(r.Context(), m.ID, *m.Delta); err != nil {
-						log.Debug().AnErr("UpdateCounter", err).Msg("UpdateBulkPost")
-						http.Error(w, "failed to update", http.StatusInternalServerError)
-						return
-					}
-				} else {
-					http.Error(w, "invalid resquest", http.StatusBadRequest)
-					return
-				}
+		// partially applied batch is not an error: sending it again would
+		// count accepted counters twice
+		code := http.StatusOK
+		if err := report.Err(); err != nil {
+			log.Debug().AnErr("Update", err).Msg("UpdateBulkPost")
+			switch {
+			case report.Accepted > 0:
+				code = http.StatusMultiStatus
+			case errors.Is(err, bulk.ErrUnknownType):
+				code = http.StatusNotImplemented
+			case errors.Is(err, bulk.ErrInvalid):
+				code = http.StatusBadRequest
 			default:
-				http.Error(w, "invalid metric type", http.StatusNotImplemented)
-				return
+				code = updateStatus(err)
 			}
 		}
+		resp, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, "failed to build response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write(resp)
+	}
+}
+
+// updateStatus - returns status of failed update, updates of agents
+// rejected by allow-list are forbidden.
+func updateStatus(err error) int {
+	if errors.Is(err, registry.ErrUnknownAgent) {
+		return http.StatusForbidden
 	}
+	return http.StatusInternalServerError
 }
@@ -1,6 +1,8 @@
 package handlers_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/andrei-cloud/go-devops/internal/bulk"
 	"github.com/andrei-cloud/go-devops/internal/router"
 	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
 	"github.com/andrei-cloud/go-devops/internal/storage/persistent"
@@ -277,11 +280,11 @@ func TestUpdateBulkPost(t *testing.T) {
 
 	query := `^insert into metrics(.+)`
 
-	mock.ExpectExec(query).WithArgs("Alloc", 1.45).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(query).WithArgs("Alloc", 1.46).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(query).WithArgs("PollCount", 345).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec(query).WithArgs("PollCount", 000).WillReturnError(fmt.Errorf("DB error"))
-	mock.ExpectExec(query).WithArgs("Test", 0.01).WillReturnError(fmt.Errorf("DB error"))
+	mock.ExpectExec(query).WithArgs("Alloc", 1.45, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(query).WithArgs("Alloc", 1.46, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(query).WithArgs("PollCount", 345, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(query).WithArgs("PollCount", 000, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnError(fmt.Errorf("DB error"))
+	mock.ExpectExec(query).WithArgs("Test", 0.01, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnError(fmt.Errorf("DB error"))
 
 	r := router.SetupRouter(&persistent.Storage{DB: mockdb}, []byte{}, nil)
 	ts := httptest.NewServer(r)
@@ -300,3 +303,53 @@ func TestUpdateBulkPost(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateBulkPostReport(t *testing.T) {
+	repo := inmem.New()
+	ts := httptest.NewServer(router.SetupRouter(repo, []byte{}, nil))
+	defer ts.Close()
+
+	post := func(query, body string) (int, bulk.Report) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/updates/"+query, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var report bulk.Report
+		if resp.Header.Get("Content-Type") == "application/json" {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		}
+		return resp.StatusCode, report
+	}
+
+	body := `[{"id":"alloc","type":"gauge","value":1.5},{"id":"heap","type":"gauge"},{"id":"poll","type":"counter","delta":2}]`
+	code, report := post("?atomic=true", body)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.True(t, report.Atomic)
+	assert.Equal(t, 0, report.Accepted)
+	assert.Equal(t, 3, report.Rejected)
+	assert.Equal(t, bulk.ErrNotApplied.Error(), report.Results[0].Error)
+	_, err := repo.GetGauge(context.Background(), "alloc")
+	require.Error(t, err)
+
+	code, report = post("", body)
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, []string{bulk.StatusAccepted, bulk.StatusRejected, bulk.StatusAccepted},
+		[]string{report.Results[0].Status, report.Results[1].Status, report.Results[2].Status})
+	assert.Equal(t, "heap", report.Results[1].ID)
+	assert.Equal(t, "invalid metric: gauge heap: value is missing", report.Results[1].Error)
+
+	code, report = post("?atomic=1", `[{"id":"poll","type":"counter","delta":3}]`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, report.Accepted)
+	c, err := repo.GetCounter(context.Background(), "poll")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), c)
+
+	code, report = post("", `[{"id":"heap","type":"gauge"}]`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, 1, report.Rejected)
+
+	code, _ = post("?atomic=yes", body)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/influx"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Integer fields policies of "/write" handler, selected by "integers" query parameter.
+const (
+	IntegersAsCounters = "counter" // default, integer fields are added to counters
+	IntegersAsGauges   = "gauge"   // integer fields replace gauges
+)
+
+const maxWriteBody = 32 << 20
+
+// WriteResult - response of "/write" handler.
+type WriteResult struct {
+	Accepted int                `json:"accepted"` // number of applied lines
+	Rejected int                `json:"rejected"` // number of rejected lines
+	Errors   []influx.LineError `json:"errors,omitempty"`
+}
+
+// Write - implements handler for "/write" accepting InfluxDB line protocol.
+// Every field becomes metric "<measurement>_<field>" ("value" field is named
+// after measurement) labelled with the tags of the line. Float and boolean
+// fields are gauges, integer fields ("i" and "u" suffix) are counters unless
+// "integers=gauge" is requested, string fields are rejected.
+// Each line is validated and applied on its own. Response is 204 if all lines
+// are applied, otherwise WriteResult with per line errors is returned with
+// 200 if some lines are applied and 400 if none.
+// With key configured the body must be signed: header X-Hash holds hash.Create of the body.
+func Write(repo repo.Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key []byte
+		ctxKey := r.Context().Value(mw.CtxKey{})
+		if ctxKey != nil {
+			key = ctxKey.([]byte)
+		}
+
+		precision, ok := influx.Precisions[r.URL.Query().Get("precision")]
+		if !ok {
+			http.Error(w, "invalid precision", http.StatusBadRequest)
+			return
+		}
+		policy := r.URL.Query().Get("integers")
+		if policy == "" {
+			policy = IntegersAsCounters
+		}
+		if policy != IntegersAsCounters && policy != IntegersAsGauges {
+			http.Error(w, "invalid integers policy", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWriteBody))
+		if err != nil {
+			log.Error().AnErr("ReadAll", err).Msg("Write")
+			http.Error(w, "invalid resquest", http.StatusBadRequest)
+			return
+		}
+
+		if len(key) != 0 && !validBodyHash(string(body), r.Header.Get("X-Hash"), key) {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+
+		points, errs := influx.Parse(body, precision)
+		result := WriteResult{Errors: errs}
+
+		forbidden := false
+		for _, p := range points {
+			metrics, err := PointMetrics(p, policy)
+			if err == nil {
+				err = applyMetrics(r, repo, metrics)
+			}
+			if err != nil {
+				forbidden = forbidden || errors.Is(err, registry.ErrUnknownAgent)
+				result.Errors = append(result.Errors, influx.LineError{Line: p.Line, Error: err.Error()})
+				continue
+			}
+			result.Accepted++
+		}
+		result.Rejected = len(result.Errors)
+
+		if result.Rejected == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		code := http.StatusOK
+		switch {
+		case result.Accepted == 0 && forbidden:
+			code = http.StatusForbidden
+		case result.Accepted == 0:
+			code = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Error().AnErr("Encode", err).Msg("Write")
+		}
+	}
+}
+
+// PointMetrics - maps fields of line protocol point to metrics.
+// returns error if any field can not be mapped.
+func PointMetrics(p influx.Point, policy string) ([]model.Metric, error) {
+	metrics := make([]model.Metric, 0, len(p.Fields))
+	for name, f := range p.Fields {
+		m := model.Metric{ID: p.Measurement + "_" + name, MType: "gauge"}
+		if name == "value" {
+			m.ID = p.Measurement
+		}
+		m.ID = model.SeriesID(m.ID, p.Tags)
+
+		var (
+			value float64
+			delta int64
+		)
+		switch f.Kind {
+		case influx.Float:
+			value = f.Float
+		case influx.Boolean:
+			if f.Bool {
+				value = 1
+			}
+		case influx.Integer:
+			value, delta = float64(f.Int), f.Int
+			if policy == IntegersAsCounters {
+				m.MType = "counter"
+			}
+		case influx.Unsigned:
+			if f.Uint > 1<<63-1 {
+				return nil, fmt.Errorf("field %q: value overflows int64", name)
+			}
+			value, delta = float64(f.Uint), int64(f.Uint)
+			if policy == IntegersAsCounters {
+				m.MType = "counter"
+			}
+		default:
+			return nil, fmt.Errorf("field %q: string values are not supported", name)
+		}
+
+		if m.MType == "counter" {
+			m.Delta = &delta
+		} else {
+			m.Value = &value
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func applyMetrics(r *http.Request, repo repo.Repository, metrics []model.Metric) error {
+	for _, m := range metrics {
+		var err error
+		if m.MType == "counter" {
+			err = repo.UpdateCounter(r.Context(), m.ID, *m.Delta)
+		} else {
+			err = repo.UpdateGauge(r.Context(), m.ID, *m.Value)
+		}
+		if err != nil {
+			log.Error().AnErr("Update", err).Str("metric", m.ID).Msg("Write")
+			return fmt.Errorf("failed to update %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+func validBodyHash(body, h string, key []byte) bool {
+	return hmac.Equal([]byte(h), []byte(hash.Create(body, key)))
+}
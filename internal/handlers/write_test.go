@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		body  string
+		code  int
+		resp  string
+	}{
+		{"all valid", "", "cpu,host=a usage=0.5,procs=3i\nreq value=2i", http.StatusNoContent, ""},
+		{"partial", "", "cpu,host=a usage=0.7\nbad line\nlog msg=\"x\"", http.StatusOK,
+			`{"accepted":1,"rejected":2,"errors":[{"line":2,"error":"invalid field \"line\""},{"line":3,"error":"field \"msg\": string values are not supported"}]}`},
+		{"none valid", "", "bad", http.StatusBadRequest, `{"accepted":0,"rejected":1,"errors":[{"line":1,"error":"missing fields"}]}`},
+		{"integers as gauges", "?integers=gauge", "disk free=10i", http.StatusNoContent, ""},
+		{"precision", "?precision=s", "disk used=1 1465839830", http.StatusNoContent, ""},
+		{"invalid precision", "?precision=h", "disk used=1", http.StatusBadRequest, ""},
+		{"invalid policy", "?integers=x", "disk used=1", http.StatusBadRequest, ""},
+	}
+
+	repo := inmem.New()
+	handler := chi.NewRouter()
+	handler.Post("/write", Write(repo))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/write"+tt.query, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, tt.code, rr.Code)
+			if tt.resp != "" {
+				require.JSONEq(t, tt.resp, rr.Body.String())
+			}
+		})
+	}
+
+	ctx := context.Background()
+	v, err := repo.GetGauge(ctx, "cpu_usage;host=a")
+	require.NoError(t, err)
+	require.Equal(t, 0.7, v)
+
+	c, err := repo.GetCounter(ctx, "cpu_procs;host=a")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), c)
+
+	c, err = repo.GetCounter(ctx, "req")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), c)
+
+	g, err := repo.GetGauge(ctx, "disk_free")
+	require.NoError(t, err)
+	require.Equal(t, float64(10), g)
+}
+
+func TestWriteHash(t *testing.T) {
+	key := []byte("secret")
+	handler := chi.NewRouter()
+	handler.Use(mw.KeyInject(key))
+	handler.Post("/write", Write(inmem.New()))
+
+	body := "cpu value=1"
+	for _, tt := range []struct {
+		hash string
+		code int
+	}{
+		{hash.Create(body, key), http.StatusNoContent},
+		{hash.Create(body, []byte("other")), http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		req.Header.Set("X-Hash", tt.hash)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, tt.code, rr.Code)
+	}
+}
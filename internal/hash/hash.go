@@ -5,7 +5,9 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/andrei-cloud/go-devops/internal/model"
 )
@@ -17,6 +19,46 @@ func Create(src string, key []byte) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// MaxSkew - maximal difference between timestamp of signed request and server time.
+const MaxSkew = 5 * time.Minute
+
+// Errors of timestamped signatures.
+var (
+	ErrInvalidHash = errors.New("invalid hash")
+	ErrStale       = errors.New("stale signature")
+)
+
+// CreateTimed - creates hash of src signed together with unix timestamp ts,
+// so captured hash can not be replayed once ts is older than MaxSkew.
+func CreateTimed(src string, ts int64, key []byte) string {
+	return Create(fmt.Sprintf("%s:%d", src, ts), key)
+}
+
+// ValidateTimed - checks h is hash of src and ts created with key and ts is within MaxSkew of now.
+func ValidateTimed(src string, ts int64, h string, key []byte, now time.Time) error {
+	if !hmac.Equal([]byte(h), []byte(CreateTimed(src, ts, key))) {
+		return ErrInvalidHash
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > MaxSkew || d < -MaxSkew {
+		return ErrStale
+	}
+	return nil
+}
+
+// Sign - returns metric m with hash created with key, m is returned as is if key is empty.
+func Sign(m model.Metric, key []byte) model.Metric {
+	if len(key) == 0 {
+		return m
+	}
+	switch m.MType {
+	case "gauge":
+		m.Hash = Create(fmt.Sprintf("%s:gauge:%f", m.ID, *m.Value), key)
+	case "counter":
+		m.Hash = Create(fmt.Sprintf("%s:counter:%d", m.ID, *m.Delta), key)
+	}
+	return m
+}
+
 // Validate - checks if given metric and it's hash is valid for key provided.
 func Validate(m model.Metric, key []byte) (bool, error) {
 	var data string
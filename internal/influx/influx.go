@@ -0,0 +1,307 @@
+// Package influx implements InfluxDB line protocol parsing and encoding.
+package influx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldKind - type of field value.
+type FieldKind int
+
+// Field value kinds of line protocol.
+const (
+	Float FieldKind = iota
+	Integer
+	Unsigned
+	Boolean
+	String
+)
+
+// Field - single field value of a point.
+type Field struct {
+	Kind  FieldKind
+	Float float64
+	Int   int64
+	Uint  uint64
+	Bool  bool
+	Str   string
+}
+
+// Point - single line of line protocol.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]Field
+	Time        time.Time // zero if timestamp is omitted
+	Line        int       // line number within parsed data, 1-based
+}
+
+// LineError - error of single line, Line is 1-based.
+type LineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Precisions supported by "precision" parameter.
+var Precisions = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"n":  time.Nanosecond,
+	"us": time.Microsecond,
+	"u":  time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// Parse - parses multiple lines, empty lines and comments are skipped.
+// Every valid line is returned as a point, every invalid line as an error.
+func Parse(data []byte, precision time.Duration) ([]Point, []LineError) {
+	var (
+		points []Point
+		errs   []LineError
+	)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := ParseLine(line, precision)
+		if err != nil {
+			errs = append(errs, LineError{Line: i + 1, Error: err.Error()})
+			continue
+		}
+		p.Line = i + 1
+		points = append(points, p)
+	}
+	return points, errs
+}
+
+// ParseLine - parses single line:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	p := Point{Tags: map[string]string{}, Fields: map[string]Field{}}
+
+	key, rest := splitUnescaped(line, ' ')
+	if rest == "" {
+		return p, fmt.Errorf("missing fields")
+	}
+
+	parts := splitAllUnescaped(key, ',')
+	p.Measurement = unescape(parts[0])
+	if p.Measurement == "" {
+		return p, fmt.Errorf("missing measurement")
+	}
+	for _, tag := range parts[1:] {
+		k, v := splitUnescaped(tag, '=')
+		if k == "" || v == "" {
+			return p, fmt.Errorf("invalid tag %q", tag)
+		}
+		p.Tags[unescape(k)] = unescape(v)
+	}
+
+	fields, ts := splitFields(rest)
+	for _, field := range splitFieldSet(fields) {
+		k, v := splitUnescaped(field, '=')
+		if k == "" || v == "" {
+			return p, fmt.Errorf("invalid field %q", field)
+		}
+		f, err := parseFieldValue(v)
+		if err != nil {
+			return p, fmt.Errorf("field %q: %w", unescape(k), err)
+		}
+		p.Fields[unescape(k)] = f
+	}
+	if len(p.Fields) == 0 {
+		return p, fmt.Errorf("missing fields")
+	}
+
+	if ts = strings.TrimSpace(ts); ts != "" {
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp %q", ts)
+		}
+		p.Time = time.Unix(0, n*int64(precision)).UTC()
+	}
+	return p, nil
+}
+
+func parseFieldValue(v string) (Field, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+			return Field{}, fmt.Errorf("unterminated string %s", v)
+		}
+		s := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(v[1 : len(v)-1])
+		return Field{Kind: String, Str: s}, nil
+	case strings.HasSuffix(v, "i"):
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return Field{}, fmt.Errorf("invalid integer %s", v)
+		}
+		return Field{Kind: Integer, Int: n}, nil
+	case strings.HasSuffix(v, "u"):
+		n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return Field{}, fmt.Errorf("invalid unsigned %s", v)
+		}
+		return Field{Kind: Unsigned, Uint: n}, nil
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return Field{Kind: Boolean, Bool: true}, nil
+	case "f", "F", "false", "False", "FALSE":
+		return Field{Kind: Boolean, Bool: false}, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return Field{}, fmt.Errorf("invalid value %s", v)
+	}
+	return Field{Kind: Float, Float: f}, nil
+}
+
+// splitFields separates field set from timestamp, spaces within quoted
+// string values do not split.
+func splitFields(s string) (string, string) {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case ' ':
+			if !inQuotes {
+				return s[:i], s[i+1:]
+			}
+		}
+	}
+	return s, ""
+}
+
+// splitFieldSet splits fields by unescaped commas outside of quoted strings.
+func splitFieldSet(s string) []string {
+	var (
+		parts    []string
+		inQuotes bool
+		start    int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitUnescaped splits s on the first unescaped sep.
+func splitUnescaped(s string, sep byte) (string, string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+func splitAllUnescaped(s string, sep byte) []string {
+	var parts []string
+	for {
+		head, tail := splitUnescaped(s, sep)
+		parts = append(parts, head)
+		if len(head) == len(s) {
+			return parts
+		}
+		s = tail
+	}
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\\`, `\`).Replace(s)
+}
+
+// AppendLine - appends point encoded as single line without trailing newline,
+// tags and fields are written in sorted order.
+func AppendLine(b []byte, p Point) []byte {
+	b = append(b, escapeMeasurement.Replace(p.Measurement)...)
+	for _, k := range sortedKeys(p.Tags) {
+		if p.Tags[k] == "" {
+			continue
+		}
+		b = append(b, ',')
+		b = append(b, escapeKey.Replace(k)...)
+		b = append(b, '=')
+		b = append(b, escapeKey.Replace(p.Tags[k])...)
+	}
+
+	fields := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for i, k := range fields {
+		if i == 0 {
+			b = append(b, ' ')
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, escapeKey.Replace(k)...)
+		b = append(b, '=')
+		b = appendFieldValue(b, p.Fields[k])
+	}
+
+	if !p.Time.IsZero() {
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, p.Time.UnixNano(), 10)
+	}
+	return b
+}
+
+var (
+	escapeMeasurement = strings.NewReplacer(`,`, `\,`, ` `, `\ `, `\`, `\\`)
+	escapeKey         = strings.NewReplacer(`,`, `\,`, ` `, `\ `, `=`, `\=`, `\`, `\\`)
+	escapeString      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+func appendFieldValue(b []byte, f Field) []byte {
+	switch f.Kind {
+	case Integer:
+		return append(strconv.AppendInt(b, f.Int, 10), 'i')
+	case Unsigned:
+		return append(strconv.AppendUint(b, f.Uint, 10), 'u')
+	case Boolean:
+		return strconv.AppendBool(b, f.Bool)
+	case String:
+		b = append(b, '"')
+		b = append(b, escapeString.Replace(f.Str)...)
+		return append(b, '"')
+	}
+	return strconv.AppendFloat(b, f.Float, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,76 @@
+package influx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := ParseLine(`cpu\ load,host=web\,1,region=eu usage=0.64,cores=8i,up=true,note="a \"b\" c" 1465839830100400200`, time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, "cpu load", p.Measurement)
+	require.Equal(t, map[string]string{"host": "web,1", "region": "eu"}, p.Tags)
+	require.Equal(t, Field{Kind: Float, Float: 0.64}, p.Fields["usage"])
+	require.Equal(t, Field{Kind: Integer, Int: 8}, p.Fields["cores"])
+	require.Equal(t, Field{Kind: Boolean, Bool: true}, p.Fields["up"])
+	require.Equal(t, Field{Kind: String, Str: `a "b" c`}, p.Fields["note"])
+	require.Equal(t, int64(1465839830100400200), p.Time.UnixNano())
+
+	p, err = ParseLine("mem free=12u 1465839830", time.Second)
+	require.NoError(t, err)
+	require.Equal(t, Field{Kind: Unsigned, Uint: 12}, p.Fields["free"])
+	require.Equal(t, int64(1465839830), p.Time.Unix())
+
+	p, err = ParseLine("mem free=1", time.Nanosecond)
+	require.NoError(t, err)
+	require.True(t, p.Time.IsZero())
+}
+
+func TestParseLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"cpu",
+		",host=a value=1",
+		"cpu,host value=1",
+		"cpu value",
+		"cpu value=abc",
+		"cpu value=1x2i",
+		`cpu value="open`,
+		"cpu value=1 notatime",
+	} {
+		t.Run(line, func(t *testing.T) {
+			_, err := ParseLine(line, time.Nanosecond)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	points, errs := Parse([]byte("# comment\ncpu value=1\n\nbroken\nmem value=2i\n"), time.Nanosecond)
+	require.Len(t, points, 2)
+	require.Equal(t, 2, points[0].Line)
+	require.Equal(t, 5, points[1].Line)
+	require.Equal(t, []LineError{{Line: 4, Error: "missing fields"}}, errs)
+}
+
+func TestAppendLine(t *testing.T) {
+	p := Point{
+		Measurement: "cpu load",
+		Tags:        map[string]string{"host": "web,1", "dc": "eu", "empty": ""},
+		Fields: map[string]Field{
+			"value": {Kind: Float, Float: 0.5},
+			"procs": {Kind: Integer, Int: 3},
+			"note":  {Kind: String, Str: `a "b"`},
+		},
+		Time: time.Unix(0, 1465839830100400200),
+	}
+	line := string(AppendLine(nil, p))
+	require.Equal(t, `cpu\ load,dc=eu,host=web\,1 note="a \"b\"",procs=3i,value=0.5 1465839830100400200`, line)
+
+	parsed, err := ParseLine(line, time.Nanosecond)
+	require.NoError(t, err)
+	require.Equal(t, p.Measurement, parsed.Measurement)
+	require.Equal(t, p.Fields, parsed.Fields)
+	require.Equal(t, "web,1", parsed.Tags["host"])
+}
@@ -13,7 +13,10 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
 )
 
 // Logging - interceptor for logging requests and latency.
@@ -31,21 +34,81 @@ func Logging(ctx context.Context, method string, req interface{},
 
 // CheckIP - interceptor validates trusted subnet.
 func CheckIP(s *net.IPNet) grpc.UnaryServerInterceptor {
+	return CheckSubnet(func() *net.IPNet { return s })
+}
+
+// CheckSubnet - interceptor validates trusted subnet returned by subnet,
+// used when subnet changes at runtime.
+func CheckSubnet(subnet func() *net.IPNet) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler) (resp interface{}, err error) {
 
-		if s != nil {
-			md, ok := metadata.FromIncomingContext(ctx)
-			if ok {
-				values := md.Get("X-Real-IP")
-				if len(values) > 0 {
-					log.Debug().Fields(map[string]interface{}{"real-ip": values[0]}).Msgf("CheckIP")
-					if !s.Contains(net.ParseIP(values[0])) {
-						return nil, status.Errorf(codes.PermissionDenied, `restricted IP address: %s`, values[0])
-					}
+		if err := checkIP(ctx, subnet()); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// CheckSubnetStream - stream interceptor validates trusted subnet returned by subnet.
+func CheckSubnetStream(subnet func() *net.IPNet) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+
+		if err := checkIP(ss.Context(), subnet()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkIP(ctx context.Context, s *net.IPNet) error {
+	if s != nil {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if ok {
+			values := md.Get("X-Real-IP")
+			if len(values) > 0 {
+				log.Debug().Fields(map[string]interface{}{"real-ip": values[0]}).Msgf("CheckIP")
+				if !s.Contains(net.ParseIP(values[0])) {
+					return status.Errorf(codes.PermissionDenied, `restricted IP address: %s`, values[0])
 				}
 			}
 		}
-		return handler(ctx, req)
 	}
+	return nil
+}
+
+// Metadata keys identifying agent reporting metrics.
+const (
+	MetadataAgentID      = "x-agent-id"
+	MetadataAgentVersion = "x-agent-version"
+)
+
+// SourceInject - interceptor injects source of updates into request context.
+// Agent is identified by x-agent-id metadata, by X-Real-IP metadata or by peer address otherwise,
+// the metadata is not signed and only the peer address is trusted for access control.
+func SourceInject(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+	s := model.Source{Transport: model.TransportGRPC}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(MetadataAgentID); len(values) > 0 {
+			s.Agent = values[0]
+		}
+		if values := md.Get(MetadataAgentVersion); len(values) > 0 {
+			s.Version = values[0]
+		}
+		if values := md.Get("X-Real-IP"); len(values) > 0 && s.Agent == "" {
+			s.Agent = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		s.Addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(s.Addr); err == nil {
+			s.Addr = host
+		}
+	}
+	if s.Agent == "" {
+		s.Agent = s.Addr
+	}
+	return handler(model.WithSource(ctx, s), req)
 }
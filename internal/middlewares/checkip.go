@@ -8,14 +8,26 @@ import (
 
 // CheckIP - middleware validates trusted subnet.
 func CheckIP(s *net.IPNet) func(http.Handler) http.Handler {
+	return CheckSubnet(func() *net.IPNet { return s })
+}
+
+// CheckSubnet - middleware validates peer address of request against trusted subnet
+// returned by subnet, used when subnet changes at runtime. Nil subnet allows any address.
+func CheckSubnet(subnet func() *net.IPNet) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if s != nil {
+			s := subnet()
+			if s == nil {
 				next.ServeHTTP(w, r)
+				return
 			}
 
-			if !s.Contains(net.ParseIP(r.RemoteAddr)) {
-				http.Error(w, "restricted ip address", http.StatusUnauthorized)
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			if !s.Contains(net.ParseIP(host)) {
+				http.Error(w, "restricted ip address", http.StatusForbidden)
 				return
 			}
 			next.ServeHTTP(w, r)
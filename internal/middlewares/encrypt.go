@@ -10,12 +10,14 @@ import (
 
 // CryptoMW - middleware provides decryption of encrypted mesage.
 func CryptoMW(e encrypt.Decrypter) func(http.Handler) http.Handler {
-	var b bytes.Buffer
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if e != nil {
 				if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
-					var err error
+					var (
+						b   bytes.Buffer
+						err error
+					)
 
 					_, err = b.ReadFrom(r.Body)
 					if err != nil {
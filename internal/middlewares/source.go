@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+// Headers identifying agent reporting metrics.
+const (
+	HeaderAgentID      = "X-Agent-ID"
+	HeaderAgentVersion = "X-Agent-Version"
+)
+
+// SourceInject - middleware injects source of updates into request context.
+// Agent is identified by X-Agent-ID header, by X-Real-IP header or by remote address otherwise,
+// the headers are not signed and only the remote address is trusted for access control.
+func SourceInject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := model.Source{
+			Agent:     r.Header.Get(HeaderAgentID),
+			Transport: model.TransportHTTP,
+			Version:   r.Header.Get(HeaderAgentVersion),
+			Addr:      r.RemoteAddr,
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			s.Addr = host
+		}
+		if s.Agent == "" {
+			s.Agent = r.Header.Get("X-Real-IP")
+		}
+		if s.Agent == "" {
+			s.Agent = s.Addr
+		}
+		next.ServeHTTP(w, r.WithContext(model.WithSource(r.Context(), s)))
+	})
+}
@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	model "github.com/andrei-cloud/go-devops/internal/model"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -48,6 +49,34 @@ func (mr *MockRepositoryMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockRepository)(nil).Close))
 }
 
+// DeleteCounter mocks base method.
+func (m *MockRepository) DeleteCounter(ctx context.Context, c string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCounter", ctx, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCounter indicates an expected call of DeleteCounter.
+func (mr *MockRepositoryMockRecorder) DeleteCounter(ctx, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCounter", reflect.TypeOf((*MockRepository)(nil).DeleteCounter), ctx, c)
+}
+
+// DeleteGauge mocks base method.
+func (m *MockRepository) DeleteGauge(ctx context.Context, g string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGauge", ctx, g)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGauge indicates an expected call of DeleteGauge.
+func (mr *MockRepositoryMockRecorder) DeleteGauge(ctx, g interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGauge", reflect.TypeOf((*MockRepository)(nil).DeleteGauge), ctx, g)
+}
+
 // GetCounter mocks base method.
 func (m *MockRepository) GetCounter(ctx context.Context, c string) (int64, error) {
 	m.ctrl.T.Helper()
@@ -108,6 +137,36 @@ func (mr *MockRepositoryMockRecorder) GetGaugeAll(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeAll", reflect.TypeOf((*MockRepository)(nil).GetGaugeAll), ctx)
 }
 
+// GetMetadata mocks base method.
+func (m *MockRepository) GetMetadata(ctx context.Context, mtype, id string) (model.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetadata", ctx, mtype, id)
+	ret0, _ := ret[0].(model.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetadata indicates an expected call of GetMetadata.
+func (mr *MockRepositoryMockRecorder) GetMetadata(ctx, mtype, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetadata", reflect.TypeOf((*MockRepository)(nil).GetMetadata), ctx, mtype, id)
+}
+
+// GetMetadataAll mocks base method.
+func (m *MockRepository) GetMetadataAll(ctx context.Context, mtype string) (map[string]model.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetadataAll", ctx, mtype)
+	ret0, _ := ret[0].(map[string]model.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetadataAll indicates an expected call of GetMetadataAll.
+func (mr *MockRepositoryMockRecorder) GetMetadataAll(ctx, mtype interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetadataAll", reflect.TypeOf((*MockRepository)(nil).GetMetadataAll), ctx, mtype)
+}
+
 // Ping mocks base method.
 func (m *MockRepository) Ping() error {
 	m.ctrl.T.Helper()
@@ -122,6 +181,34 @@ func (mr *MockRepositoryMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockRepository)(nil).Ping))
 }
 
+// Rename mocks base method.
+func (m *MockRepository) Rename(ctx context.Context, mtype, from, to string, merge bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rename", ctx, mtype, from, to, merge)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rename indicates an expected call of Rename.
+func (mr *MockRepositoryMockRecorder) Rename(ctx, mtype, from, to, merge interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rename", reflect.TypeOf((*MockRepository)(nil).Rename), ctx, mtype, from, to, merge)
+}
+
+// ResetCounter mocks base method.
+func (m *MockRepository) ResetCounter(ctx context.Context, c string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetCounter", ctx, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetCounter indicates an expected call of ResetCounter.
+func (mr *MockRepositoryMockRecorder) ResetCounter(ctx, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetCounter", reflect.TypeOf((*MockRepository)(nil).ResetCounter), ctx, c)
+}
+
 // UpdateCounter mocks base method.
 func (m *MockRepository) UpdateCounter(ctx context.Context, c string, v int64) error {
 	m.ctrl.T.Helper()
@@ -149,3 +236,17 @@ func (mr *MockRepositoryMockRecorder) UpdateGauge(ctx, g, v interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateGauge", reflect.TypeOf((*MockRepository)(nil).UpdateGauge), ctx, g, v)
 }
+
+// UpdateMetrics mocks base method.
+func (m *MockRepository) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMetrics", ctx, metrics)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMetrics indicates an expected call of UpdateMetrics.
+func (mr *MockRepositoryMockRecorder) UpdateMetrics(ctx, metrics interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetrics", reflect.TypeOf((*MockRepository)(nil).UpdateMetrics), ctx, metrics)
+}
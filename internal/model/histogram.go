@@ -0,0 +1,70 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// Quantiles reported for every flattened histogram.
+var Quantiles = []float64{0.5, 0.9, 0.99}
+
+// Histogram - The type defining a distribution of float64 values.
+// Bounds holds len(Counts)+1 bucket boundaries, Counts[n] is the number of
+// observations within [Bounds[n], Bounds[n+1]).
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64 // sum of observations, zero when unknown
+}
+
+// Count - returns total number of observations in histogram.
+func (h Histogram) Count() uint64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+// Quantile - estimates q-quantile of the distribution
+// returns upper bound of the bucket the quantile falls into.
+func (h Histogram) Quantile(q float64) float64 {
+	total := h.Count()
+	if total == 0 || len(h.Bounds) != len(h.Counts)+1 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range h.Counts {
+		seen += c
+		if seen >= rank && c != 0 {
+			upper := h.Bounds[i+1]
+			if math.IsInf(upper, 1) {
+				upper = h.Bounds[i]
+			}
+			if math.IsInf(upper, -1) {
+				return 0
+			}
+			return upper
+		}
+	}
+	return 0
+}
+
+// Gauges - flattens histogram into gauge metrics prefixed with name:
+//
+//	<name>_count - total number of observations
+//	<name>_sum   - sum of observations (if known)
+//	<name>_pXX   - quantile estimations
+func (h Histogram) Gauges(name string) map[string]float64 {
+	gauges := make(map[string]float64, len(Quantiles)+2)
+	gauges[name+"_count"] = float64(h.Count())
+	if h.Sum != 0 {
+		gauges[name+"_sum"] = h.Sum
+	}
+	for _, q := range Quantiles {
+		gauges[fmt.Sprintf("%s_p%d", name, int(math.Round(q*100)))] = h.Quantile(q)
+	}
+	return gauges
+}
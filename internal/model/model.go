@@ -1,6 +1,11 @@
 // This backage contain the model structre defining the Metric entity
 package model
 
+import (
+	"fmt"
+	"time"
+)
+
 // Metric - The type defining a Metric entity.
 type Metric struct {
 	ID    string   `json:"id"`              // имя метрики
@@ -8,4 +13,27 @@ type Metric struct {
 	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
 	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
 	Hash  string   `json:"hash,omitempty"`  // значение хеш-функции
+
+	Updated *time.Time `json:"updated,omitempty"` // время последнего обновления метрики
+	Source  string     `json:"source,omitempty"`  // агент, обновивший метрику
+}
+
+// Validate - checks metric has ID, known type and value matching the type.
+func (m Metric) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("metric id is empty")
+	}
+	switch m.MType {
+	case "gauge":
+		if m.Value == nil {
+			return fmt.Errorf("gauge %s: value is missing", m.ID)
+		}
+	case "counter":
+		if m.Delta == nil {
+			return fmt.Errorf("counter %s: delta is missing", m.ID)
+		}
+	default:
+		return fmt.Errorf("metric %s: invalid metric type %q", m.ID, m.MType)
+	}
+	return nil
 }
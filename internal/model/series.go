@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels are encoded into metric ID in Graphite tags format "name;key1=value1;key2=value2"
+// with keys sorted, so every backend stores labelled series without schema changes.
+const (
+	labelSeparator = ";"
+	labelAssign    = "="
+)
+
+// SeriesID - encodes metric name with labels, empty labels are skipped.
+func SeriesID(name string, labels map[string]string) string {
+	name = escapeLabel(name)
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString(labelSeparator)
+		b.WriteString(escapeLabel(k))
+		b.WriteString(labelAssign)
+		b.WriteString(escapeLabel(labels[k]))
+	}
+	return b.String()
+}
+
+// ParseSeriesID - splits metric ID into name and labels.
+// returns error if any label is malformed.
+func ParseSeriesID(id string) (string, map[string]string, error) {
+	parts := strings.Split(id, labelSeparator)
+	labels := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, ok := strings.Cut(p, labelAssign)
+		if !ok || k == "" || v == "" {
+			return "", nil, fmt.Errorf("invalid label %q in %q", p, id)
+		}
+		labels[k] = v
+	}
+	return parts[0], labels, nil
+}
+
+// WithLabels - adds labels to metric ID, labels already present in ID take precedence.
+func WithLabels(id string, labels map[string]string) (string, error) {
+	name, own, err := ParseSeriesID(id)
+	if err != nil {
+		return "", err
+	}
+	merged := make(map[string]string, len(own)+len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range own {
+		merged[k] = v
+	}
+	return SeriesID(name, merged), nil
+}
+
+var labelEscaper = strings.NewReplacer(labelSeparator, "_", labelAssign, "_")
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesID(t *testing.T) {
+	require.Equal(t, "requests", SeriesID("requests", nil))
+	require.Equal(t, "requests;app=api;host=web1",
+		SeriesID("requests", map[string]string{"host": "web1", "app": "api", "empty": ""}))
+	require.Equal(t, "requests;host=a_b_c", SeriesID("requests", map[string]string{"host": "a;b=c"}))
+}
+
+func TestParseSeriesID(t *testing.T) {
+	name, labels, err := ParseSeriesID("requests;app=api;host=web1")
+	require.NoError(t, err)
+	require.Equal(t, "requests", name)
+	require.Equal(t, map[string]string{"app": "api", "host": "web1"}, labels)
+
+	_, _, err = ParseSeriesID("requests;host")
+	require.Error(t, err)
+}
+
+func TestWithLabels(t *testing.T) {
+	id, err := WithLabels("requests;host=custom", map[string]string{"host": "web1", "dc": "eu"})
+	require.NoError(t, err)
+	require.Equal(t, "requests;dc=eu;host=custom", id)
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// Transports of metric updates.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// Source - agent reporting metric update.
+type Source struct {
+	Agent     string // agent ID, host name of agent or its address, reported by agent
+	Transport string // TransportHTTP or TransportGRPC
+	Version   string // agent version, empty if unknown
+	Addr      string // host of remote address of connection, not reported by agent
+}
+
+// Metadata - time and source agent of the last update of metric.
+type Metadata struct {
+	Updated time.Time `json:"updated"`
+	Source  string    `json:"source,omitempty"`
+}
+
+type sourceKey struct{}
+
+type updatedKey struct{}
+
+// WithSource - returns context of update reported by source s.
+func WithSource(ctx context.Context, s Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, s)
+}
+
+// SourceFromContext - returns source of update made with ctx.
+func SourceFromContext(ctx context.Context) (Source, bool) {
+	s, ok := ctx.Value(sourceKey{}).(Source)
+	return s, ok
+}
+
+// WithUpdated - returns context of update made at t instead of current time,
+// used to restore metadata of stored metrics.
+func WithUpdated(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, updatedKey{}, t)
+}
+
+// MetadataFromContext - returns metadata to store with update made with ctx.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md := Metadata{Updated: time.Now()}
+	if t, ok := ctx.Value(updatedKey{}).(time.Time); ok && !t.IsZero() {
+		md.Updated = t
+	}
+	if s, ok := SourceFromContext(ctx); ok {
+		md.Source = s.Agent
+	}
+	return md
+}
@@ -0,0 +1,83 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Receiver - implements OTLP metrics service applying metrics to repository.
+type Receiver struct {
+	colpb.UnimplementedMetricsServiceServer
+
+	repo repo.Repository
+	tr   *Translator
+}
+
+var _ colpb.MetricsServiceServer = &Receiver{}
+
+// NewReceiver - creates receiver shared by gRPC service and HTTP handler,
+// so temporality state of streams does not depend on transport.
+func NewReceiver(repo repo.Repository, tr *Translator) *Receiver {
+	return &Receiver{repo: repo, tr: tr}
+}
+
+// Export - translates metrics and applies them to repository.
+// Data points which can not be translated or applied are reported as partial success,
+// exports of agents rejected by allow-list fail with PermissionDenied.
+func (r *Receiver) Export(ctx context.Context, req *colpb.ExportMetricsServiceRequest) (*colpb.ExportMetricsServiceResponse, error) {
+	res := r.tr.Translate(req)
+
+	for _, m := range res.Metrics {
+		var err error
+		if m.MType == "counter" {
+			err = r.repo.UpdateCounter(ctx, m.ID, *m.Delta)
+		} else {
+			err = r.repo.UpdateGauge(ctx, m.ID, *m.Value)
+		}
+		if errors.Is(err, registry.ErrUnknownAgent) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if err != nil {
+			log.Error().AnErr("Update", err).Str("metric", m.ID).Msg("OTLP Export")
+			res.reject("failed to update %s", m.ID)
+		}
+	}
+
+	response := &colpb.ExportMetricsServiceResponse{}
+	if res.Rejected > 0 {
+		log.Debug().Int64("rejected", res.Rejected).Str("error", res.Error).Msg("OTLP Export")
+		response.PartialSuccess = &colpb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: res.Rejected,
+			ErrorMessage:       res.Error,
+		}
+	}
+	return response, nil
+}
+
+// guard - service accepting exports only while allowed reports true.
+type guard struct {
+	colpb.MetricsServiceServer
+	allowed func() bool
+}
+
+// Guard - returns svc rejecting exports with Unauthenticated status while allowed reports false,
+// used to disable unsigned OTLP when the server requires signed metrics.
+func Guard(svc colpb.MetricsServiceServer, allowed func() bool) colpb.MetricsServiceServer {
+	return &guard{MetricsServiceServer: svc, allowed: allowed}
+}
+
+// Export - exports metrics if allowed.
+func (g *guard) Export(ctx context.Context, req *colpb.ExportMetricsServiceRequest) (*colpb.ExportMetricsServiceResponse, error) {
+	if !g.allowed() {
+		return nil, status.Error(codes.Unauthenticated, "unsigned OTLP is not allowed while key is set")
+	}
+	return g.MetricsServiceServer.Export(ctx, req)
+}
@@ -0,0 +1,397 @@
+// Package otlp implements ingestion of OpenTelemetry (OTLP) metrics.
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+const (
+	scopeNameAttr = "otel.scope.name"
+	staleAfter    = time.Hour
+)
+
+var (
+	defaultResourceLabels = []string{"service.name", "service.instance.id"}
+	invalidNameChars      = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+)
+
+// Result - outcome of translation of export request.
+type Result struct {
+	Metrics  []model.Metric // updates to apply, counters carry increments
+	Rejected int64          // number of data points which can not be translated
+	Error    string         // first translation error
+}
+
+func (r *Result) reject(format string, args ...interface{}) {
+	r.rejectN(1, format, args...)
+}
+
+func (r *Result) rejectN(n int, format string, args ...interface{}) {
+	r.Rejected += int64(n)
+	if r.Error == "" {
+		r.Error = fmt.Sprintf(format, args...)
+	}
+}
+
+// stream - state of single time series between export requests.
+type stream struct {
+	start uint64 // start time of cumulative stream
+	last  uint64 // time of the last applied data point
+	total float64
+	hist  model.Histogram
+	seen  time.Time
+}
+
+// Translator - translates OTLP metrics into repository updates.
+// Counters of repository are additive, so monotonic sums are converted into
+// increments: for cumulative temporality the difference from the previous
+// data point of the stream is reported (stream reset is detected by start
+// time change or decreasing value), for delta temporality the value itself.
+// Fractional parts are carried over between data points, so the sum of
+// reported increments always equals rounded total of the stream.
+// Non-monotonic sums and gauges are gauges, delta non-monotonic sums are
+// accumulated. Histograms and summaries are flattened into <name>_count,
+// _sum and quantile gauges, delta histograms are accumulated.
+type Translator struct {
+	cfg     config.OtlpConfig
+	started uint64
+
+	mu      sync.Mutex
+	streams map[string]*stream
+	swept   time.Time
+}
+
+// NewTranslator - creates translator with resource and scope mapping cfg.
+func NewTranslator(cfg config.OtlpConfig) *Translator {
+	if len(cfg.ResourceLabels) == 0 {
+		cfg.ResourceLabels = defaultResourceLabels
+	}
+	now := time.Now()
+	return &Translator{
+		cfg:     cfg,
+		started: uint64(now.UnixNano()),
+		streams: make(map[string]*stream),
+		swept:   now,
+	}
+}
+
+// Translate - converts export request into metric updates.
+func (t *Translator) Translate(req *colpb.ExportMetricsServiceRequest) Result {
+	var res Result
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, rm := range req.GetResourceMetrics() {
+		resAttrs := rm.GetResource().GetAttributes()
+		resLabels := make(map[string]string)
+		for _, key := range t.cfg.ResourceLabels {
+			if v, ok := attrValue(resAttrs, key); ok {
+				resLabels[labelName(key)] = v
+			}
+		}
+
+		for _, sm := range rm.GetScopeMetrics() {
+			scope := sm.GetScope()
+			base := copyLabels(resLabels)
+			if t.cfg.ScopeLabels {
+				base["otel_scope_name"] = scope.GetName()
+				base["otel_scope_version"] = scope.GetVersion()
+			}
+			prefix := t.prefix(resAttrs, scope)
+
+			for _, m := range sm.GetMetrics() {
+				name := metricName(prefix, m.GetName())
+				if name == "" {
+					res.reject("metric without name")
+					continue
+				}
+				t.translateMetric(&res, name, base, m, now)
+			}
+		}
+	}
+
+	if now.Sub(t.swept) > staleAfter {
+		for id, s := range t.streams {
+			if now.Sub(s.seen) > staleAfter {
+				delete(t.streams, id)
+			}
+		}
+		t.swept = now
+	}
+	return res
+}
+
+func (t *Translator) prefix(resAttrs []*commonpb.KeyValue, scope *commonpb.InstrumentationScope) string {
+	if t.cfg.Prefix == "" {
+		return ""
+	}
+	if t.cfg.Prefix == scopeNameAttr {
+		return scope.GetName()
+	}
+	if v, ok := attrValue(resAttrs, t.cfg.Prefix); ok {
+		return v
+	}
+	v, _ := attrValue(scope.GetAttributes(), t.cfg.Prefix)
+	return v
+}
+
+func (t *Translator) translateMetric(res *Result, name string, base map[string]string, m *metricspb.Metric, now time.Time) {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			v, err := numberValue(dp)
+			if err != nil {
+				res.reject("%s: %v", name, err)
+				continue
+			}
+			res.Metrics = append(res.Metrics, gauge(model.SeriesID(name, pointLabels(base, dp.GetAttributes())), v))
+		}
+	case *metricspb.Metric_Sum:
+		temporality := data.Sum.GetAggregationTemporality()
+		if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED {
+			res.rejectN(len(data.Sum.GetDataPoints()), "%s: unspecified aggregation temporality", name)
+			return
+		}
+		for _, dp := range data.Sum.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			v, err := numberValue(dp)
+			if err != nil {
+				res.reject("%s: %v", name, err)
+				continue
+			}
+			id := model.SeriesID(name, pointLabels(base, dp.GetAttributes()))
+			t.sum(res, id, data.Sum.GetIsMonotonic(), temporality, dp, v, now)
+		}
+	case *metricspb.Metric_Histogram:
+		temporality := data.Histogram.GetAggregationTemporality()
+		for _, dp := range data.Histogram.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			h, err := histogram(dp)
+			if err != nil {
+				res.reject("%s: %v", name, err)
+				continue
+			}
+			labels := pointLabels(base, dp.GetAttributes())
+			id := model.SeriesID(name, labels)
+			if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+				s := t.stream(id, now)
+				h = mergeHistogram(s.hist, h)
+				s.hist = h
+			}
+			for k, v := range h.Gauges(name) {
+				res.Metrics = append(res.Metrics, gauge(model.SeriesID(k, labels), v))
+			}
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			labels := pointLabels(base, dp.GetAttributes())
+			res.Metrics = append(res.Metrics,
+				gauge(model.SeriesID(name+"_count", labels), float64(dp.GetCount())),
+				gauge(model.SeriesID(name+"_sum", labels), dp.GetSum()))
+			for _, q := range dp.GetQuantileValues() {
+				qname := fmt.Sprintf("%s_p%d", name, int(math.Round(q.GetQuantile()*100)))
+				res.Metrics = append(res.Metrics, gauge(model.SeriesID(qname, labels), q.GetValue()))
+			}
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		res.rejectN(len(data.ExponentialHistogram.GetDataPoints()), "%s: exponential histograms are not supported", name)
+	default:
+		res.reject("%s: metric without data", name)
+	}
+}
+
+// sum applies data point of sum to the stream state.
+func (t *Translator) sum(res *Result, id string, monotonic bool, temporality metricspb.AggregationTemporality,
+	dp *metricspb.NumberDataPoint, v float64, now time.Time) {
+	_, known := t.streams[id]
+	s := t.stream(id, now)
+
+	prev := s.total
+	if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		s.total += v
+	} else {
+		if known && dp.GetTimeUnixNano() != 0 && dp.GetTimeUnixNano() <= s.last {
+			return // duplicate or out of order data point
+		}
+		s.last = dp.GetTimeUnixNano()
+		switch {
+		case !known && monotonic:
+			// stream started before the server, only values after the first
+			// data point are reported
+			if dp.GetStartTimeUnixNano() < t.started {
+				prev = v
+			}
+		case known && monotonic && (dp.GetStartTimeUnixNano() != s.start || v < s.total):
+			prev = 0 // stream was reset
+		}
+		s.start = dp.GetStartTimeUnixNano()
+		s.total = v
+	}
+
+	if !monotonic {
+		res.Metrics = append(res.Metrics, gauge(id, s.total))
+		return
+	}
+	delta := int64(math.Round(s.total) - math.Round(prev))
+	if delta < 0 {
+		res.reject("%s: negative increment of monotonic sum", id)
+		return
+	}
+	if delta > 0 {
+		res.Metrics = append(res.Metrics, model.Metric{ID: id, MType: "counter", Delta: &delta})
+	}
+}
+
+func (t *Translator) stream(id string, now time.Time) *stream {
+	s, ok := t.streams[id]
+	if !ok {
+		s = &stream{}
+		t.streams[id] = s
+	}
+	s.seen = now
+	return s
+}
+
+func gauge(id string, v float64) model.Metric {
+	return model.Metric{ID: id, MType: "gauge", Value: &v}
+}
+
+func noValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE) != 0
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) (float64, error) {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), nil
+	case *metricspb.NumberDataPoint_AsDouble:
+		if math.IsNaN(v.AsDouble) || math.IsInf(v.AsDouble, 0) {
+			return 0, fmt.Errorf("non finite value")
+		}
+		return v.AsDouble, nil
+	}
+	return 0, fmt.Errorf("data point without value")
+}
+
+// histogram converts explicit bucket histogram, bucket i covers
+// (bounds[i-1], bounds[i]], the last bucket is unbounded.
+func histogram(dp *metricspb.HistogramDataPoint) (model.Histogram, error) {
+	bounds, counts := dp.GetExplicitBounds(), dp.GetBucketCounts()
+	if len(counts) == 0 {
+		return model.Histogram{
+			Bounds: []float64{math.Inf(-1), math.Inf(1)},
+			Counts: []uint64{dp.GetCount()},
+			Sum:    dp.GetSum(),
+		}, nil
+	}
+	if len(counts) != len(bounds)+1 {
+		return model.Histogram{}, fmt.Errorf("%d bucket counts for %d bounds", len(counts), len(bounds))
+	}
+	h := model.Histogram{
+		Bounds: make([]float64, 0, len(bounds)+2),
+		Counts: append([]uint64(nil), counts...),
+		Sum:    dp.GetSum(),
+	}
+	h.Bounds = append(h.Bounds, math.Inf(-1))
+	h.Bounds = append(h.Bounds, bounds...)
+	h.Bounds = append(h.Bounds, math.Inf(1))
+	return h, nil
+}
+
+// mergeHistogram adds delta histogram d to accumulated h,
+// accumulation restarts if bucket layout changes.
+func mergeHistogram(h, d model.Histogram) model.Histogram {
+	if len(h.Bounds) != len(d.Bounds) {
+		return d
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != d.Bounds[i] {
+			return d
+		}
+	}
+	merged := model.Histogram{Bounds: h.Bounds, Counts: make([]uint64, len(h.Counts)), Sum: h.Sum + d.Sum}
+	for i := range h.Counts {
+		merged.Counts[i] = h.Counts[i] + d.Counts[i]
+	}
+	return merged
+}
+
+func pointLabels(base map[string]string, attrs []*commonpb.KeyValue) map[string]string {
+	labels := copyLabels(base)
+	for _, kv := range attrs {
+		if v, ok := stringValue(kv.GetValue()); ok {
+			labels[labelName(kv.GetKey())] = v
+		}
+	}
+	return labels
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+func attrValue(attrs []*commonpb.KeyValue, key string) (string, bool) {
+	for _, kv := range attrs {
+		if kv.GetKey() == key {
+			return stringValue(kv.GetValue())
+		}
+	}
+	return "", false
+}
+
+// stringValue formats scalar attribute values, arrays, maps and bytes are skipped.
+func stringValue(v *commonpb.AnyValue) (string, bool) {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue, val.StringValue != ""
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+func labelName(key string) string {
+	return invalidNameChars.ReplaceAllString(key, "_")
+}
+
+func metricName(prefix, name string) string {
+	if name == "" {
+		return ""
+	}
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+	return invalidNameChars.ReplaceAllString(name, "_")
+}
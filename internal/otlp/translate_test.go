@@ -0,0 +1,178 @@
+package otlp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+const (
+	cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta      = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+)
+
+func strAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func request(metrics ...*metricspb.Metric) *colpb.ExportMetricsServiceRequest {
+	return &colpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			strAttr("service.name", "checkout"),
+			strAttr("process.pid", "42"),
+		}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{
+			Scope:   &commonpb.InstrumentationScope{Name: "http", Version: "1.0"},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+func sum(name string, temporality metricspb.AggregationTemporality, monotonic bool, start, ts uint64, v float64) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		AggregationTemporality: temporality,
+		IsMonotonic:            monotonic,
+		DataPoints: []*metricspb.NumberDataPoint{{
+			Attributes:        []*commonpb.KeyValue{strAttr("route", "/pay")},
+			StartTimeUnixNano: start,
+			TimeUnixNano:      ts,
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+		}},
+	}}}
+}
+
+// updates returns counter increments and gauge values of result.
+func updates(res Result) (map[string]int64, map[string]float64) {
+	counters, gauges := map[string]int64{}, map[string]float64{}
+	for _, m := range res.Metrics {
+		if m.MType == "counter" {
+			counters[m.ID] += *m.Delta
+		} else {
+			gauges[m.ID] = *m.Value
+		}
+	}
+	return counters, gauges
+}
+
+func TestTranslateCumulativeSum(t *testing.T) {
+	tr := NewTranslator(config.OtlpConfig{})
+	id := "http_requests;route=/pay;service_name=checkout"
+	before, after := tr.started-1, tr.started+1
+
+	// stream started before the server: first point is a baseline only
+	res := tr.Translate(request(sum("http.requests", cumulative, true, before, after, 100)))
+	counters, _ := updates(res)
+	require.Empty(t, counters)
+
+	res = tr.Translate(request(sum("http.requests", cumulative, true, before, after+1, 110.4)))
+	counters, _ = updates(res)
+	require.Equal(t, map[string]int64{id: 10}, counters)
+
+	// duplicate data point is ignored
+	res = tr.Translate(request(sum("http.requests", cumulative, true, before, after+1, 110.4)))
+	counters, _ = updates(res)
+	require.Empty(t, counters)
+
+	// fractional part is carried over
+	res = tr.Translate(request(sum("http.requests", cumulative, true, before, after+2, 111.6)))
+	counters, _ = updates(res)
+	require.Equal(t, map[string]int64{id: 2}, counters)
+
+	// reset by new start time reports whole value
+	res = tr.Translate(request(sum("http.requests", cumulative, true, after+3, after+4, 5)))
+	counters, _ = updates(res)
+	require.Equal(t, map[string]int64{id: 5}, counters)
+
+	// stream started after the server reports whole first value
+	res = tr.Translate(request(sum("jobs", cumulative, true, after, after+1, 7)))
+	counters, _ = updates(res)
+	require.Equal(t, map[string]int64{"jobs;route=/pay;service_name=checkout": 7}, counters)
+}
+
+func TestTranslateDeltaSum(t *testing.T) {
+	tr := NewTranslator(config.OtlpConfig{})
+	id := "bytes;route=/pay;service_name=checkout"
+
+	var total int64
+	for _, v := range []float64{0.6, 0.6, 0.6, 3} {
+		counters, _ := updates(tr.Translate(request(sum("bytes", delta, true, 0, 0, v))))
+		total += counters[id]
+	}
+	require.Equal(t, int64(5), total)
+
+	_, gauges := updates(tr.Translate(request(sum("queue", delta, false, 0, 0, 3))))
+	require.Equal(t, float64(3), gauges["queue;route=/pay;service_name=checkout"])
+	_, gauges = updates(tr.Translate(request(sum("queue", delta, false, 0, 0, -1))))
+	require.Equal(t, float64(2), gauges["queue;route=/pay;service_name=checkout"])
+
+	_, gauges = updates(tr.Translate(request(sum("inflight", cumulative, false, 0, 1, 4))))
+	require.Equal(t, float64(4), gauges["inflight;route=/pay;service_name=checkout"])
+
+	res := tr.Translate(request(sum("bytes", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED, true, 0, 0, 1)))
+	require.Equal(t, int64(1), res.Rejected)
+	require.Contains(t, res.Error, "temporality")
+}
+
+func TestTranslateGaugeAndHistogram(t *testing.T) {
+	tr := NewTranslator(config.OtlpConfig{ResourceLabels: []string{"process.pid"}, ScopeLabels: true, Prefix: "service.name"})
+	labels := ";otel_scope_name=http;otel_scope_version=1.0;process_pid=42"
+
+	gauge := &metricspb.Metric{Name: "temperature", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+		DataPoints: []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 21}}},
+	}}}
+	hist := func(counts ...uint64) *metricspb.Metric {
+		sum := 1.0
+		return &metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: delta,
+			DataPoints: []*metricspb.HistogramDataPoint{{
+				ExplicitBounds: []float64{0.1, 0.5},
+				BucketCounts:   counts,
+				Sum:            &sum,
+			}},
+		}}}
+	}
+
+	_, gauges := updates(tr.Translate(request(gauge, hist(8, 2, 0))))
+	require.Equal(t, float64(21), gauges["checkout_temperature"+labels])
+	require.Equal(t, float64(10), gauges["checkout_latency_count"+labels])
+	require.Equal(t, 0.1, gauges["checkout_latency_p50"+labels])
+
+	_, gauges = updates(tr.Translate(request(hist(0, 10, 0))))
+	require.Equal(t, float64(20), gauges["checkout_latency_count"+labels])
+	require.Equal(t, float64(2), gauges["checkout_latency_sum"+labels])
+	require.Equal(t, 0.5, gauges["checkout_latency_p90"+labels])
+
+	res := tr.Translate(request(hist(1, 2)))
+	require.Equal(t, int64(1), res.Rejected)
+}
+
+func TestReceiverExport(t *testing.T) {
+	repo := inmem.New()
+	tr := NewTranslator(config.OtlpConfig{})
+	r := NewReceiver(repo, tr)
+	ctx := context.Background()
+	start := uint64(time.Now().UnixNano())
+
+	resp, err := r.Export(ctx, request(sum("orders", cumulative, true, start, start+1, 3)))
+	require.NoError(t, err)
+	require.Nil(t, resp.PartialSuccess)
+	_, err = r.Export(ctx, request(sum("orders", cumulative, true, start, start+2, 8)))
+	require.NoError(t, err)
+
+	c, err := repo.GetCounter(ctx, "orders;route=/pay;service_name=checkout")
+	require.NoError(t, err)
+	require.Equal(t, int64(8), c)
+
+	resp, err = r.Export(ctx, request(&metricspb.Metric{Name: "empty"}))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), resp.PartialSuccess.RejectedDataPoints)
+}
@@ -0,0 +1,82 @@
+// Package profiles keeps versioned configuration profiles distributed by server to agents.
+package profiles
+
+import (
+	"path"
+	"sync"
+
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Request - configuration request of agent.
+type Request struct {
+	ID       string            `json:"id"`
+	Hostname string            `json:"hostname"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Applied  string            `json:"applied,omitempty"` // version of profile applied by agent, empty if none
+	Hash     string            `json:"hash,omitempty"`    // registry.Sign of ID for registry.ActionConfig
+}
+
+// Response - profile selected for agent.
+type Response struct {
+	Profile  string               `json:"profile"`
+	Version  string               `json:"version"`
+	Settings config.AgentSettings `json:"settings"`
+}
+
+// Store - profiles of the server, safe for concurrent use.
+type Store struct {
+	mu       sync.RWMutex
+	profiles []config.AgentProfile
+	changed  chan struct{}
+}
+
+// New - creates store of profiles.
+func New(profiles []config.AgentProfile) *Store {
+	return &Store{profiles: profiles, changed: make(chan struct{})}
+}
+
+// Set - replaces profiles and notifies watchers.
+func (s *Store) Set(profiles []config.AgentProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles = profiles
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Changed - returns channel closed on the next Set.
+func (s *Store) Changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+// Match - returns the first profile applying to agent with host name and labels.
+func (s *Store) Match(host string, labels map[string]string) (Response, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.profiles {
+		if matches(p, host, labels) {
+			return Response{Profile: p.Name, Version: p.Version, Settings: p.Settings}, true
+		}
+	}
+	return Response{}, false
+}
+
+func matches(p config.AgentProfile, host string, labels map[string]string) bool {
+	for k, v := range p.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	if len(p.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range p.Hosts {
+		if ok, err := path.Match(pattern, host); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package profiles_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+var testProfiles = []config.AgentProfile{
+	{Name: "web", Version: "web-2", Hosts: []string{"web-*"}, Labels: map[string]string{"env": "prod"},
+		Settings: config.AgentSettings{PollInterval: config.Duration{Duration: time.Second}}},
+	{Name: "db", Version: "db-1", Hosts: []string{"db-?", "pg"}},
+	{Name: "default", Version: "default-1"},
+}
+
+func TestMatch(t *testing.T) {
+	s := profiles.New(testProfiles)
+
+	tests := []struct {
+		name   string
+		host   string
+		labels map[string]string
+		want   string
+	}{
+		{"host and labels", "web-1", map[string]string{"env": "prod", "dc": "eu"}, "web-2"},
+		{"missing label", "web-1", map[string]string{"env": "dev"}, "default-1"},
+		{"second pattern", "pg", nil, "db-1"},
+		{"pattern mismatch", "db-10", nil, "default-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := s.Match(tt.host, tt.labels)
+			require.True(t, ok)
+			require.Equal(t, tt.want, p.Version)
+		})
+	}
+
+	changed := s.Changed()
+	s.Set(testProfiles[:1])
+	select {
+	case <-changed:
+	default:
+		t.Fatal("watchers are not notified")
+	}
+	_, ok := s.Match("db-1", nil)
+	require.False(t, ok)
+}
+
+func TestConfigHTTP(t *testing.T) {
+	key := []byte("secret")
+	reg := registry.New(0)
+	store := profiles.New(testProfiles[:2])
+	srv := httptest.NewServer(router.WithAgents(router.SetupRouter(inmem.New(), key, nil), reg, store, key, nil))
+	defer srv.Close()
+
+	_, err := reg.Register(registry.Registration{ID: "web-1"}, "http", time.Now())
+	require.NoError(t, err)
+
+	post := func(body string) *http.Response {
+		resp, err := http.Post(srv.URL+"/agents/config", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := post(`{"id":"web-1","hostname":"web-1","labels":{"env":"prod"},"applied":"web-1","hash":"` +
+		registry.Sign("web-1", registry.ActionConfig, key) + `"}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"profile":"web","version":"web-2","settings":{"poll_interval":"1s","report_interval":"0s","runtime_metrics":false}}`, string(body))
+	require.Equal(t, "web-1", reg.List(time.Now())[0].ConfigVersion)
+
+	resp = post(`{"id":"other","hostname":"other","hash":"` + registry.Sign("other", registry.ActionConfig, key) + `"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = post(`{"id":"web-1","hostname":"web-1","hash":"bad"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestWatchConfig(t *testing.T) {
+	store := profiles.New(testProfiles[1:2])
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	pb.RegisterAgentsServer(g, rpc.NewAgentsServer(registry.New(0), store, nil))
+	go g.Serve(lis)
+	defer g.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := pb.NewAgentsClient(conn).WatchConfig(ctx, &pb.ConfigRequest{Id: "web-1", Hostname: "web-1"})
+	require.NoError(t, err)
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.False(t, resp.Found)
+
+	// unrelated change is not sent
+	store.Set(testProfiles[1:2])
+	store.Set(testProfiles)
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	p, ok, err := rpc.ConfigFromProto(resp)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "default-1", p.Version)
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"errors"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Statuses of registration and heartbeat responses.
+const (
+	StatusRegistered   = "registered"   // agent is registered
+	StatusOK           = "ok"           // heartbeat of registered agent is accepted
+	StatusUnknown      = "unknown"      // agent is not in allow-list, accepted and flagged
+	StatusUnregistered = "unregistered" // agent must register again, e.g. after server restart
+)
+
+// ErrUnknownAgent - agent is not in allow-list and unknown agents are rejected.
+var ErrUnknownAgent = errors.New("unknown agent")
+
+// Registration - request sent by agent on startup.
+type Registration struct {
+	ID         string   `json:"id"`
+	Hostname   string   `json:"hostname"`
+	Version    string   `json:"version"`
+	Commit     string   `json:"commit"`
+	Collectors []string `json:"collectors"`
+	Hash       string   `json:"hash,omitempty"` // Sign of ID for ActionRegister
+}
+
+// RegistrationResponse - response to registration with suggested agent settings.
+type RegistrationResponse struct {
+	Status string            `json:"status"`
+	Hints  config.AgentHints `json:"hints"`
+}
+
+// Heartbeat - request periodically sent by registered agent.
+type Heartbeat struct {
+	ID            string `json:"id"`
+	Hash          string `json:"hash,omitempty"`           // Sign of ID for ActionHeartbeat
+	ConfigVersion string `json:"config_version,omitempty"` // version of configuration profile applied by agent
+}
+
+// HeartbeatResponse - response to heartbeat.
+type HeartbeatResponse struct {
+	Status string `json:"status"`
+}
+
+// Actions signed by agents.
+const (
+	ActionRegister  = "register"
+	ActionHeartbeat = "heartbeat"
+	ActionConfig    = "config"
+)
+
+// Sign - returns hash of agent id for action created with key.
+func Sign(id, action string, key []byte) string {
+	return hash.Create(id+":"+action, key)
+}
+
+// SetAllowList - restricts agents to ids, unknown agents are rejected if
+// reject is set or flagged otherwise. Empty ids allow any agent.
+func (r *Registry) SetAllowList(ids []string, reject bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowed = nil
+	if len(ids) > 0 {
+		r.allowed = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			r.allowed[id] = struct{}{}
+		}
+	}
+	r.reject = reject
+}
+
+// SetHints - sets settings returned to registering agents.
+func (r *Registry) SetHints(h config.AgentHints) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hints = h
+}
+
+// Register - records registration of agent reg over transport at now.
+// returns ErrUnknownAgent if agent is rejected by allow-list.
+func (r *Registry) Register(reg Registration, transport string, now time.Time) (RegistrationResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	known := r.known(reg.ID)
+	if !known && r.reject {
+		return RegistrationResponse{}, ErrUnknownAgent
+	}
+
+	a := r.agents[reg.ID]
+	a.ID = reg.ID
+	a.Hostname = reg.Hostname
+	a.Version = reg.Version
+	a.Commit = reg.Commit
+	a.Collectors = reg.Collectors
+	a.Transport = transport
+	a.Registered = now
+	a.Unknown = !known
+	if now.After(a.LastSeen) {
+		a.LastSeen = now
+	}
+	r.put(a)
+
+	resp := RegistrationResponse{Status: StatusRegistered, Hints: r.hints}
+	if !known {
+		resp.Status = StatusUnknown
+	}
+	return resp, nil
+}
+
+// Heartbeat - records heartbeat hb of agent over transport at now.
+// returns ErrUnknownAgent if agent is rejected by allow-list.
+func (r *Registry) Heartbeat(hb Heartbeat, transport string, now time.Time) (HeartbeatResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := hb.ID
+	known := r.known(id)
+	if !known && r.reject {
+		return HeartbeatResponse{}, ErrUnknownAgent
+	}
+
+	a, ok := r.agents[id]
+	if !ok || a.Registered.IsZero() {
+		return HeartbeatResponse{Status: StatusUnregistered}, nil
+	}
+	a.Transport = transport
+	a.ConfigVersion = hb.ConfigVersion
+	if now.After(a.LastSeen) {
+		a.LastSeen = now
+	}
+	r.agents[id] = a
+
+	if !known {
+		return HeartbeatResponse{Status: StatusUnknown}, nil
+	}
+	return HeartbeatResponse{Status: StatusOK}, nil
+}
+
+// Applied - records version of configuration profile applied by agent id,
+// agents not registered since server start are ignored.
+func (r *Registry) Applied(id, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a, ok := r.agents[id]; ok {
+		a.ConfigVersion = version
+		r.agents[id] = a
+	}
+}
+
+// known reports whether agent id passes allow-list, must be called with lock held.
+func (r *Registry) known(id string) bool {
+	if r.allowed == nil {
+		return true
+	}
+	_, ok := r.allowed[id]
+	return ok
+}
@@ -0,0 +1,205 @@
+// Package registry keeps track of agents reporting metrics to the server.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// Agent statuses.
+const (
+	StatusUp    = "up"
+	StatusStale = "stale"
+)
+
+// DefaultStaleAfter - default time without reports after which agent is stale.
+const DefaultStaleAfter = time.Minute
+
+// MaxAgents - maximal number of agents kept in registry, the least recently
+// seen agent is forgotten when a new agent is recorded over the limit.
+const MaxAgents = 10000
+
+// Agent - known agent and its last report.
+type Agent struct {
+	ID            string    `json:"id"`
+	Hostname      string    `json:"hostname,omitempty"`
+	Transport     string    `json:"transport"`
+	Version       string    `json:"version,omitempty"`
+	Commit        string    `json:"commit,omitempty"`
+	Collectors    []string  `json:"collectors,omitempty"`
+	ConfigVersion string    `json:"config_version,omitempty"` // version of configuration profile applied by agent
+	Registered    time.Time `json:"registered,omitempty"`     // zero if agent did not register since server start
+	LastSeen      time.Time `json:"last_seen"`                // time of the last report or heartbeat
+	Status        string    `json:"status"`
+	Unknown       bool      `json:"unknown,omitempty"` // agent is not in allow-list
+}
+
+// Registry - agents seen since server start.
+type Registry struct {
+	mu         sync.RWMutex
+	agents     map[string]Agent
+	staleAfter time.Duration
+	allowed    map[string]struct{} // nil allows any agent
+	bound      map[string]string   // address of the last signed registration of agent
+	reject     bool
+	hints      config.AgentHints
+}
+
+// New - creates empty registry, agents not reporting within staleAfter are stale.
+func New(staleAfter time.Duration) *Registry {
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	return &Registry{agents: make(map[string]Agent), bound: make(map[string]string), staleAfter: staleAfter}
+}
+
+// Seen - records report of agent s at t.
+func (r *Registry) Seen(s model.Source, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a := r.agents[s.Agent]
+	a.ID = s.Agent
+	a.Transport = s.Transport
+	if s.Version != "" {
+		a.Version = s.Version
+	}
+	if t.After(a.LastSeen) {
+		a.LastSeen = t
+	}
+	a.Unknown = !r.known(r.identity(s))
+	r.put(a)
+}
+
+// Check - returns ErrUnknownAgent if updates of agent s are rejected by allow-list.
+// Agent is checked by its ID only if it registered from s.Addr with signed
+// registration, by s.Addr otherwise.
+func (r *Registry) Check(s model.Source) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id := r.identity(s); r.reject && !r.known(id) {
+		return fmt.Errorf("%w: %s", ErrUnknownAgent, id)
+	}
+	return nil
+}
+
+// Bind - records that agent id registered from addr with registration signed with key,
+// so updates reported by id from addr are checked against allow-list by id.
+func (r *Registry) Bind(id, addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.agents[id]; ok && addr != "" {
+		r.bound[id] = addr
+	}
+}
+
+// identity returns verified identity of source s, must be called with lock held.
+func (r *Registry) identity(s model.Source) string {
+	if addr, ok := r.bound[s.Agent]; ok && addr == s.Addr {
+		return s.Agent
+	}
+	return s.Addr
+}
+
+// put stores agent a, forgetting the least recently seen agent if registry is full.
+// must be called with lock held.
+func (r *Registry) put(a Agent) {
+	if _, ok := r.agents[a.ID]; !ok && len(r.agents) >= MaxAgents {
+		oldest := ""
+		for id, o := range r.agents {
+			if oldest == "" || o.LastSeen.Before(r.agents[oldest].LastSeen) {
+				oldest = id
+			}
+		}
+		delete(r.agents, oldest)
+		delete(r.bound, oldest)
+	}
+	r.agents[a.ID] = a
+}
+
+// List - returns agents sorted by ID with their status at now.
+func (r *Registry) List(now time.Time) []Agent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	agents := make([]Agent, 0, len(r.agents))
+	for _, a := range r.agents {
+		a.Status = StatusUp
+		if now.Sub(a.LastSeen) > r.staleAfter {
+			a.Status = StatusStale
+		}
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	return agents
+}
+
+type repository struct {
+	repo.Repository
+	reg *Registry
+}
+
+var _ repo.Repository = &repository{}
+
+// Repository - wraps repository r so every successful update reported by
+// an agent over HTTP or gRPC is recorded in reg. Updates of agents rejected
+// by allow-list fail with ErrUnknownAgent and are not applied.
+func Repository(r repo.Repository, reg *Registry) repo.Repository {
+	return &repository{Repository: r, reg: reg}
+}
+
+// UpdateGauge - updates gauge and records its source.
+func (r *repository) UpdateGauge(ctx context.Context, g string, v float64) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if err := r.Repository.UpdateGauge(ctx, g, v); err != nil {
+		return err
+	}
+	r.seen(ctx)
+	return nil
+}
+
+// UpdateCounter - updates counter and records its source.
+func (r *repository) UpdateCounter(ctx context.Context, c string, v int64) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if err := r.Repository.UpdateCounter(ctx, c, v); err != nil {
+		return err
+	}
+	r.seen(ctx)
+	return nil
+}
+
+// UpdateMetrics - updates metrics atomically and records their source.
+func (r *repository) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	if err := r.Repository.UpdateMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	r.seen(ctx)
+	return nil
+}
+
+// check rejects updates of unknown agents, restored updates have no transport and are allowed.
+func (r *repository) check(ctx context.Context) error {
+	if s, ok := model.SourceFromContext(ctx); ok && s.Agent != "" && s.Transport != "" {
+		return r.reg.Check(s)
+	}
+	return nil
+}
+
+// seen records source of ctx, restored updates have no transport and are skipped.
+func (r *repository) seen(ctx context.Context) {
+	if s, ok := model.SourceFromContext(ctx); ok && s.Agent != "" && s.Transport != "" {
+		r.reg.Seen(s, time.Now())
+	}
+}
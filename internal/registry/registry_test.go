@@ -0,0 +1,242 @@
+package registry_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := registry.New(time.Minute)
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	reg.Seen(model.Source{Agent: "b", Transport: model.TransportGRPC, Version: "v1.0.0"}, now)
+	reg.Seen(model.Source{Agent: "a", Transport: model.TransportHTTP}, now.Add(-2*time.Minute))
+	reg.Seen(model.Source{Agent: "b", Transport: model.TransportHTTP}, now.Add(-time.Hour))
+
+	require.Equal(t, []registry.Agent{
+		{ID: "a", Transport: model.TransportHTTP, LastSeen: now.Add(-2 * time.Minute), Status: registry.StatusStale},
+		{ID: "b", Transport: model.TransportHTTP, Version: "v1.0.0", LastSeen: now, Status: registry.StatusUp},
+	}, reg.List(now))
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	reg := registry.New(0)
+	storage := inmem.New()
+	r := registry.Repository(storage, reg)
+
+	// restored updates carry no transport
+	restored := model.WithUpdated(model.WithSource(ctx, model.Source{Agent: "old"}), time.Unix(0, 0))
+	require.NoError(t, r.UpdateGauge(restored, "restored", 1))
+	require.Empty(t, reg.List(time.Now()))
+
+	srv := httptest.NewServer(router.WithAgents(router.SetupRouter(r, nil, nil), reg, profiles.New(nil), nil, nil))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/update/", strings.NewReader(`{"id":"Alloc","type":"gauge","value":1.5}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(mw.HeaderAgentID, "host1")
+	req.Header.Set(mw.HeaderAgentVersion, "v1.2.3")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	md, err := storage.GetMetadata(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	require.Equal(t, "host1", md.Source)
+	require.WithinDuration(t, time.Now(), md.Updated, time.Second)
+
+	md, err = storage.GetMetadata(ctx, "gauge", "restored")
+	require.NoError(t, err)
+	require.Equal(t, model.Metadata{Updated: time.Unix(0, 0), Source: "old"}, md)
+
+	// agent without ID header is identified by address
+	resp, err = http.Post(srv.URL+"/update/counter/PollCount/1", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	agents := reg.List(time.Now())
+	require.Len(t, agents, 2)
+	require.Equal(t, "127.0.0.1", agents[0].ID)
+	require.Equal(t, "host1", agents[1].ID)
+	require.Equal(t, "v1.2.3", agents[1].Version)
+	require.Equal(t, registry.StatusUp, agents[1].Status)
+
+	// updates of agents rejected by allow-list are not applied
+	reg.SetAllowList([]string{"host1"}, true)
+	resp, err = http.Post(srv.URL+"/update/counter/PollCount/1", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	v, err := storage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), v)
+	require.ErrorIs(t, r.UpdateMetrics(model.WithSource(ctx, model.Source{Agent: "host2", Transport: model.TransportGRPC}),
+		[]model.Metric{{ID: "PollCount", MType: "counter", Delta: &v}}), registry.ErrUnknownAgent)
+	require.NoError(t, r.UpdateGauge(restored, "restored", 2))
+}
+
+func TestMaxAgents(t *testing.T) {
+	reg := registry.New(time.Minute)
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	reg.Seen(model.Source{Agent: "oldest", Transport: model.TransportHTTP}, now.Add(-time.Hour))
+	for i := 1; i <= registry.MaxAgents; i++ {
+		reg.Seen(model.Source{Agent: fmt.Sprintf("agent%d", i), Transport: model.TransportHTTP}, now)
+	}
+
+	agents := reg.List(now)
+	require.Len(t, agents, registry.MaxAgents)
+	for _, a := range agents {
+		require.NotEqual(t, "oldest", a.ID)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	reg := registry.New(time.Minute)
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	hints := config.AgentHints{ReportInterval: config.Duration{Duration: 5 * time.Second}}
+	reg.SetHints(hints)
+
+	// heartbeat before registration asks agent to register
+	hb, err := reg.Heartbeat(registry.Heartbeat{ID: "a"}, model.TransportHTTP, now)
+	require.NoError(t, err)
+	require.Equal(t, registry.StatusUnregistered, hb.Status)
+
+	resp, err := reg.Register(registry.Registration{
+		ID: "a", Hostname: "host-a", Version: "v1", Commit: "abc", Collectors: []string{"system"},
+	}, model.TransportGRPC, now)
+	require.NoError(t, err)
+	require.Equal(t, registry.RegistrationResponse{Status: registry.StatusRegistered, Hints: hints}, resp)
+
+	hb, err = reg.Heartbeat(registry.Heartbeat{ID: "a"}, model.TransportGRPC, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, registry.StatusOK, hb.Status)
+
+	require.Equal(t, []registry.Agent{{
+		ID: "a", Hostname: "host-a", Transport: model.TransportGRPC, Version: "v1", Commit: "abc",
+		Collectors: []string{"system"}, Registered: now, LastSeen: now.Add(time.Minute), Status: registry.StatusUp,
+	}}, reg.List(now.Add(time.Minute)))
+
+	// unknown agents are flagged
+	reg.SetAllowList([]string{"a"}, false)
+	resp, err = reg.Register(registry.Registration{ID: "b"}, model.TransportHTTP, now)
+	require.NoError(t, err)
+	require.Equal(t, registry.StatusUnknown, resp.Status)
+	hb, err = reg.Heartbeat(registry.Heartbeat{ID: "b"}, model.TransportHTTP, now)
+	require.NoError(t, err)
+	require.Equal(t, registry.StatusUnknown, hb.Status)
+	reg.Seen(model.Source{Agent: "c", Transport: model.TransportHTTP}, now)
+	agents := reg.List(now)
+	require.Len(t, agents, 3)
+	require.False(t, agents[0].Unknown)
+	require.True(t, agents[1].Unknown)
+	require.True(t, agents[2].Unknown)
+
+	// or rejected
+	reg.SetAllowList([]string{"a"}, true)
+	_, err = reg.Register(registry.Registration{ID: "d"}, model.TransportHTTP, now)
+	require.ErrorIs(t, err, registry.ErrUnknownAgent)
+	_, err = reg.Heartbeat(registry.Heartbeat{ID: "b"}, model.TransportHTTP, now)
+	require.ErrorIs(t, err, registry.ErrUnknownAgent)
+}
+
+func TestRegisterHTTP(t *testing.T) {
+	key := []byte("secret")
+	reg := registry.New(0)
+	reg.SetAllowList([]string{"host1"}, true)
+	reg.SetHints(config.AgentHints{PollInterval: config.Duration{Duration: time.Second}})
+	srv := httptest.NewServer(router.WithAgents(router.SetupRouter(inmem.New(), key, nil), reg, profiles.New(nil), key, nil))
+	defer srv.Close()
+
+	post := func(path string, v interface{}) *http.Response {
+		body, err := json.Marshal(v)
+		require.NoError(t, err)
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(string(body)))
+		require.NoError(t, err)
+		return resp
+	}
+
+	tests := []struct {
+		name string
+		path string
+		req  interface{}
+		code int
+		want string
+	}{
+		{"invalid hash", "/agents/register", registry.Registration{ID: "host1", Hash: "bad"}, http.StatusBadRequest, ""},
+		{"rejected", "/agents/register", registry.Registration{ID: "host2", Hash: registry.Sign("host2", registry.ActionRegister, key)}, http.StatusForbidden, ""},
+		{"registered", "/agents/register", registry.Registration{ID: "host1", Hash: registry.Sign("host1", registry.ActionRegister, key)}, http.StatusOK, `{"status":"registered","hints":{"report_interval":"0s","poll_interval":"1s","heartbeat_interval":"0s"}}`},
+		{"heartbeat signed for register", "/agents/heartbeat", registry.Heartbeat{ID: "host1", Hash: registry.Sign("host1", registry.ActionRegister, key)}, http.StatusBadRequest, ""},
+		{"heartbeat", "/agents/heartbeat", registry.Heartbeat{ID: "host1", Hash: registry.Sign("host1", registry.ActionHeartbeat, key)}, http.StatusOK, `{"status":"ok"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(tt.path, tt.req)
+			defer resp.Body.Close()
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.want != "" {
+				var got json.RawMessage
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				require.JSONEq(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestAllowListIdentity(t *testing.T) {
+	key := []byte("secret")
+	reg := registry.New(0)
+	reg.SetAllowList([]string{"host1"}, true)
+	r := registry.Repository(inmem.New(), reg)
+	srv := httptest.NewServer(router.WithAgents(router.SetupRouter(r, key, nil), reg, profiles.New(nil), key, nil))
+	defer srv.Close()
+
+	update := func(agent string) int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/update/counter/PollCount/1", nil)
+		require.NoError(t, err)
+		req.Header.Set(mw.HeaderAgentID, agent)
+		req.Header.Set("X-Real-IP", "host1")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// unsigned headers are not trusted
+	require.Equal(t, http.StatusForbidden, update("host1"))
+	require.Equal(t, http.StatusForbidden, update(""))
+
+	// signed registration binds agent ID to its address
+	body, err := json.Marshal(registry.Registration{ID: "host1", Hash: registry.Sign("host1", registry.ActionRegister, key)})
+	require.NoError(t, err)
+	resp, err := http.Post(srv.URL+"/agents/register", "application/json", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, http.StatusOK, update("host1"))
+	require.ErrorIs(t, reg.Check(model.Source{Agent: "host1", Transport: model.TransportGRPC, Addr: "10.0.0.1"}),
+		registry.ErrUnknownAgent)
+
+	// address in allow-list is trusted
+	reg.SetAllowList([]string{"127.0.0.1"}, true)
+	require.Equal(t, http.StatusOK, update("host2"))
+}
@@ -0,0 +1,119 @@
+// Package relay implements relay mode of the agent: metrics of downstream
+// agents are accepted with server API, aggregated and reported upstream
+// together with metrics of the agent itself.
+package relay
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+
+	"github.com/andrei-cloud/go-devops/internal/collector"
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/interceptors"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+type relay struct {
+	*collector.Aggregator
+
+	addr     string
+	grpcAddr string
+	key      []byte
+	decr     encrypt.Decrypter
+	subnet   *net.IPNet
+}
+
+var (
+	_ collector.Collector = &relay{}
+	_ collector.Runner    = &relay{}
+)
+
+// New - creates relay collector accepting metrics on relay addresses of cfg.
+// Downstream hashes are validated with RelayKey and requests are decrypted
+// with RelayCryptoKey. Accepted gauges are last-write-wins and counters are
+// summed until the agent reports them, when the agent signs and encrypts
+// them with its own keys. Returns error if RelayCryptoKey can not be loaded.
+func New(cfg config.AgentConfig) (*relay, error) {
+	r := &relay{
+		Aggregator: collector.NewAggregator(),
+		addr:       cfg.RelayAddress,
+		grpcAddr:   cfg.RelayGrpcAddress,
+	}
+	if cfg.RelayKey != "" {
+		r.key = []byte(cfg.RelayKey)
+	}
+	if cfg.RelayCryptoKey != "" {
+		decr, err := encrypt.Load(cfg.RelayCryptoKey)
+		if err != nil {
+			return nil, err
+		}
+		r.decr = decr
+	}
+	if cfg.RelaySubnet != "" {
+		var err error
+		if _, r.subnet, err = net.ParseCIDR(cfg.RelaySubnet); err != nil {
+			log.Error().AnErr("ParseCIDR", err).Msg("Relay")
+		}
+	}
+	return r, nil
+}
+
+// Run - serves downstream agents until ctx is done.
+func (r *relay) Run(ctx context.Context) {
+	repo := NewRepository(r.Aggregator)
+
+	srv := &http.Server{
+		Addr:           r.addr,
+		Handler:        router.SetupRouter(repo, r.key, r.decr),
+		ReadTimeout:    60 * time.Second,
+		WriteTimeout:   60 * time.Second,
+		IdleTimeout:    30 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+	go func() {
+		log.Info().Msgf("Relay HTTP listening on: %v", r.addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().AnErr("ListenAndServe", err).Msg("Relay")
+		}
+	}()
+
+	var g *grpc.Server
+	if r.grpcAddr != "" {
+		l, err := net.Listen("tcp", r.grpcAddr)
+		if err != nil {
+			log.Error().AnErr("Listen", err).Msgf("Relay: failed to listen on %s", r.grpcAddr)
+		} else {
+			var opts []grpc.ServerOption
+			if r.decr != nil {
+				opts = append(opts, grpc.ForceServerCodec(encrypt.ServerCodec{Dec: r.decr}))
+			}
+			opts = append(opts, grpc.ChainUnaryInterceptor(interceptors.CheckIP(r.subnet)))
+			g = grpc.NewServer(opts...)
+			pb.RegisterMetricsServer(g, rpc.NewMetricsServer(repo, r.key))
+			log.Info().Msgf("Relay gRPC listening on: %v", l.Addr())
+			go g.Serve(l)
+		}
+	}
+
+	<-ctx.Done()
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		log.Error().AnErr("Shutdown", err).Msg("Relay")
+	}
+	if g != nil {
+		g.GracefulStop()
+	}
+}
@@ -0,0 +1,127 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/andrei-cloud/go-devops/internal/collector"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+func counter(id string, d int64, key []byte) model.Metric {
+	return model.Metric{ID: id, MType: "counter", Delta: &d, Hash: hash.Create(fmt.Sprintf("%s:counter:%d", id, d), key)}
+}
+
+func gauge(id string, v float64, key []byte) model.Metric {
+	return model.Metric{ID: id, MType: "gauge", Value: &v, Hash: hash.Create(fmt.Sprintf("%s:gauge:%f", id, v), key)}
+}
+
+func TestRelayHTTP(t *testing.T) {
+	key := []byte("downstream")
+	agg := collector.NewAggregator()
+	srv := httptest.NewServer(router.SetupRouter(NewRepository(agg), key, nil))
+	defer srv.Close()
+
+	post := func(metrics ...model.Metric) int {
+		body, err := json.Marshal(metrics)
+		require.NoError(t, err)
+		resp, err := http.Post(srv.URL+"/updates/", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// two downstream agents
+	require.Equal(t, http.StatusOK, post(counter("PollCount", 3, key), gauge("Alloc", 1.5, key)))
+	require.Equal(t, http.StatusOK, post(counter("PollCount", 4, key), gauge("Alloc", 2.5, key)))
+	require.Equal(t, http.StatusBadRequest, post(counter("PollCount", 100, []byte("wrong"))))
+
+	resp, err := http.Get(srv.URL + "/value/counter/PollCount")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Equal(t, map[string]int64{"PollCount": 7}, agg.GetCounter())
+	require.Equal(t, map[string]float64{"Alloc": 2.5}, agg.GetGauges())
+	require.Empty(t, agg.GetCounter())
+}
+
+func TestRelayGRPC(t *testing.T) {
+	key := []byte("downstream")
+	agg := collector.NewAggregator()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	g := grpc.NewServer()
+	pb.RegisterMetricsServer(g, rpc.NewMetricsServer(NewRepository(agg), key))
+	go g.Serve(l)
+	defer g.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsClient(conn)
+
+	for _, d := range []int64{2, 5} {
+		m := counter("requests", d, key)
+		_, err = client.UpdateCounter(context.Background(), &pb.UpdCounterRequest{Metric: &pb.Metric{
+			Id: m.ID, Mtype: pb.Metric_COUNTER, Delta: d, Hash: m.Hash,
+		}})
+		require.NoError(t, err)
+	}
+	require.Equal(t, map[string]int64{"requests": 7}, agg.GetCounter())
+}
+
+func TestGroupSumsRelayedCounters(t *testing.T) {
+	own := collector.NewAggregator()
+	relayed := collector.NewAggregator()
+	own.AddCounter("PollCount", 1)
+	relayed.AddCounter("PollCount", 5)
+	relayed.AddCounter("jobs", 2)
+
+	g := collector.NewGroup(own, relayed)
+	require.Equal(t, map[string]int64{"PollCount": 6, "jobs": 2}, g.GetCounter())
+}
+
+func TestRenameWithFlush(t *testing.T) {
+	ctx := context.Background()
+	agg := collector.NewAggregator()
+	r := NewRepository(agg)
+	require.NoError(t, r.UpdateCounter(ctx, "a", 100))
+
+	// counters flushed concurrently with renames are reported once
+	var flushed int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			for _, v := range agg.GetCounter() {
+				flushed += v
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		r.Rename(ctx, "counter", "a", "b", true)
+		r.Rename(ctx, "counter", "b", "a", true)
+	}
+	<-done
+	for _, v := range agg.GetCounter() {
+		flushed += v
+	}
+	require.Equal(t, int64(100), flushed)
+}
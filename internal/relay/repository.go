@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andrei-cloud/go-devops/internal/collector"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+type repository struct {
+	agg *collector.Aggregator
+}
+
+var _ repo.Repository = &repository{}
+
+// NewRepository - creates repository buffering updates in aggregator until
+// they are reported upstream. Reads return buffered values: the last gauge
+// values and counter increments not reported yet.
+func NewRepository(agg *collector.Aggregator) *repository {
+	return &repository{agg: agg}
+}
+
+// UpdateGauge - replaces buffered value of gauge g.
+func (r *repository) UpdateGauge(ctx context.Context, g string, v float64) error {
+	r.agg.SetGauge(g, v)
+	return nil
+}
+
+// UpdateCounter - adds v to buffered increment of counter c.
+func (r *repository) UpdateCounter(ctx context.Context, c string, v int64) error {
+	r.agg.AddCounter(c, v)
+	return nil
+}
+
+// UpdateMetrics - applies all metrics to buffer, nothing is applied if any metric is invalid.
+func (r *repository) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, m := range metrics {
+		if err := r.agg.Add(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteGauge - drops buffered value of gauge g.
+func (r *repository) DeleteGauge(ctx context.Context, g string) error {
+	if !r.agg.DeleteGauge(g) {
+		return fmt.Errorf("%w: gauge %s", repo.ErrNotFound, g)
+	}
+	return nil
+}
+
+// DeleteCounter - drops buffered increment of counter c.
+func (r *repository) DeleteCounter(ctx context.Context, c string) error {
+	if !r.agg.DeleteCounter(c) {
+		return fmt.Errorf("%w: counter %s", repo.ErrNotFound, c)
+	}
+	return nil
+}
+
+// ResetCounter - drops buffered increment of counter c, total of upstream
+// server is not changed by relay.
+func (r *repository) ResetCounter(ctx context.Context, c string) error {
+	return r.agg.Do(func(_ map[string]float64, counters map[string]int64) error {
+		if _, ok := counters[c]; !ok {
+			return fmt.Errorf("%w: counter %s", repo.ErrNotFound, c)
+		}
+		counters[c] = 0
+		return nil
+	})
+}
+
+// Rename - moves buffered value of metric from to metric to,
+// buffered metric to is merged only if merge is set.
+// Metrics are changed at once, so reports do not see half-applied rename.
+func (r *repository) Rename(ctx context.Context, mtype, from, to string, merge bool) error {
+	return r.agg.Do(func(gauges map[string]float64, counters map[string]int64) error {
+		switch mtype {
+		case "gauge":
+			v, ok := gauges[from]
+			if !ok {
+				return fmt.Errorf("%w: gauge %s", repo.ErrNotFound, from)
+			}
+			if _, ok := gauges[to]; ok && !merge {
+				return fmt.Errorf("%w: gauge %s", repo.ErrExists, to)
+			}
+			delete(gauges, from)
+			gauges[to] = v
+		case "counter":
+			v, ok := counters[from]
+			if !ok {
+				return fmt.Errorf("%w: counter %s", repo.ErrNotFound, from)
+			}
+			if _, ok := counters[to]; ok && !merge {
+				return fmt.Errorf("%w: counter %s", repo.ErrExists, to)
+			}
+			delete(counters, from)
+			counters[to] += v
+		default:
+			return fmt.Errorf("unknown metric type %s", mtype)
+		}
+		return nil
+	})
+}
+
+// GetCounter - returns buffered increment of counter c.
+func (r *repository) GetCounter(ctx context.Context, c string) (int64, error) {
+	if v, ok := r.agg.Counter(c); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("counter not found")
+}
+
+// GetGauge - returns buffered value of gauge g.
+func (r *repository) GetGauge(ctx context.Context, g string) (float64, error) {
+	if v, ok := r.agg.Gauge(g); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("gauge not found")
+}
+
+// GetMetadata - metadata of buffered updates is not tracked.
+func (r *repository) GetMetadata(ctx context.Context, mtype, id string) (model.Metadata, error) {
+	return model.Metadata{}, fmt.Errorf("metadata is not tracked by relay")
+}
+
+// GetMetadataAll - metadata of buffered updates is not tracked.
+func (r *repository) GetMetadataAll(ctx context.Context, mtype string) (map[string]model.Metadata, error) {
+	return nil, fmt.Errorf("metadata is not tracked by relay")
+}
+
+// GetGaugeAll - returns buffered gauges.
+func (r *repository) GetGaugeAll(ctx context.Context) (map[string]float64, error) {
+	return r.agg.GetGauges(), nil
+}
+
+// GetCounterAll - returns buffered counter increments.
+func (r *repository) GetCounterAll(ctx context.Context) (map[string]int64, error) {
+	return r.agg.Counters(), nil
+}
+
+// Ping - buffer is always available.
+func (r *repository) Ping() error { return nil }
+
+// Close - nothing to close.
+func (r *repository) Close() error { return nil }
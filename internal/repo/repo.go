@@ -1,7 +1,20 @@
 // Package repo provides an interface primitives for Repository.
 package repo
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+// Errors of ResetCounter and Rename, wrapped with metric type and id.
+var (
+	// ErrNotFound - metric does not exist.
+	ErrNotFound = errors.New("metric not found")
+	// ErrExists - target metric of rename exists and merge is not requested.
+	ErrExists = errors.New("metric already exists")
+)
 
 // Repository - Interface representing the repository methods.
 type Repository interface {
@@ -18,12 +31,37 @@ type Repository interface {
 	// updates metric c with value v
 	// returns error if metric is not updated.
 	UpdateCounter(ctx context.Context, c string, v int64) error
+	// UpdateMetrics - method to update metrics of model.Metric format atomically:
+	// all metrics are applied, or none of them if any is invalid or not updated.
+	// Gauges are replaced with Value, counters are increased by Delta.
+	UpdateMetrics(ctx context.Context, metrics []model.Metric) error
+	// DeleteGauge - method to delete gauge metric g.
+	// returns error wrapping ErrNotFound if metric is not found, or error if not deleted.
+	DeleteGauge(ctx context.Context, g string) error
+	// DeleteCounter - method to delete counter metric c.
+	// returns error wrapping ErrNotFound if metric is not found, or error if not deleted.
+	DeleteCounter(ctx context.Context, c string) error
+	// ResetCounter - method to set value of counter metric c to zero.
+	// returns error wrapping ErrNotFound if metric is not found.
+	ResetCounter(ctx context.Context, c string) error
+	// Rename - method to rename metric from of type mtype to metric to.
+	// If to exists and merge is set, counters are summed and gauge takes value of from,
+	// otherwise error wrapping ErrExists is returned.
+	// returns error wrapping ErrNotFound if metric from is not found.
+	Rename(ctx context.Context, mtype, from, to string, merge bool) error
 	// GetCounter - method to get counter metric c.
 	// retruns single value of in64, or error if failed.
 	GetCounter(ctx context.Context, c string) (int64, error)
 	// GetGauge - method to get gauge metric g.
 	// retruns single value of float64, or error if failed.
 	GetGauge(ctx context.Context, g string) (float64, error)
+	// GetMetadata - method to get time and source agent of the last update
+	// of metric id of type mtype, updates carry source in context.
+	// returns error if metric is not found.
+	GetMetadata(ctx context.Context, mtype, id string) (model.Metadata, error)
+	// GetMetadataAll - method to get metadata of all metrics of type mtype.
+	// returns map of metadata by metric id or error if failed.
+	GetMetadataAll(ctx context.Context, mtype string) (map[string]model.Metadata, error)
 	// GetGaugeAll - method to get gauge all metrics of gauge type.
 	// retrun map of float64 values or error if failed.
 	GetGaugeAll(ctx context.Context) (map[string]float64, error)
@@ -2,15 +2,22 @@
 package router
 
 import (
+	"net"
 	"net/http"
 	"net/http/pprof"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/rs/zerolog/log"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 
+	"github.com/andrei-cloud/go-devops/internal/admin"
 	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/federate"
 	"github.com/andrei-cloud/go-devops/internal/handlers"
 	mw "github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	"github.com/andrei-cloud/go-devops/internal/registry"
 	"github.com/andrei-cloud/go-devops/internal/repo"
 )
 
@@ -21,15 +28,79 @@ import (
 func SetupRouter(repo repo.Repository, key []byte, e encrypt.Decrypter) *chi.Mux {
 	log.Debug().Msg("Setting up the router")
 	r := chi.NewRouter()
-	r.Use(mw.CryptoMW(e), mw.GzipMW, mw.KeyInject(key))
-	r.Get("/", handlers.Default())
-	r.Get("/value/{m_type}/{m_name}", handlers.GetMetrics(repo))
-	r.Get("/ping", handlers.Ping(repo))
-
-	r.Post("/update/{m_type}/{m_name}/{value}", handlers.Update(repo))
-	r.Post("/update/", handlers.UpdatePost(repo))
-	r.Post("/updates/", handlers.UpdateBulkPost(repo))
-	r.Post("/value/", handlers.GetMetricsPost(repo))
+	r.Group(func(r chi.Router) {
+		r.Use(mw.CryptoMW(e), mw.GzipMW, mw.KeyInject(key), mw.SourceInject)
+		r.Get("/", handlers.Default())
+		r.Get("/value/{m_type}/{m_name}", handlers.GetMetrics(repo))
+		r.Get("/ping", handlers.Ping(repo))
+		r.Get("/api/metrics", handlers.ListMetrics(repo))
+
+		r.Post("/update/{m_type}/{m_name}/{value}", handlers.Update(repo))
+		r.Post("/update/", handlers.UpdatePost(repo))
+		r.Post("/updates/", handlers.UpdateBulkPost(repo))
+		r.Post("/value/", handlers.GetMetricsPost(repo))
+		r.Post("/values/", handlers.GetMetricsBulkPost(repo))
+		r.Post("/write", handlers.Write(repo))
+	})
+
+	return r
+}
+
+// WithOTLP - Function to setup router for OTLP/HTTP metrics handler
+//
+//	OpenTelemetry exporters neither encrypt nor sign requests, so requests
+//	are only checked against trusted subnet returned by subnet. The caller
+//	mounts the handler only if unsigned metrics are accepted.
+func WithOTLP(r *chi.Mux, svc colpb.MetricsServiceServer, subnet func() *net.IPNet) *chi.Mux {
+	r.With(mw.CheckSubnet(subnet), mw.GzipMW, mw.SourceInject).Post("/v1/metrics", handlers.OTLPMetrics(svc))
+
+	return r
+}
+
+// WithGroups - Function to setup router for push-gateway style group handlers
+//
+//	ttl - default expiry of pushed groups, zero disables expiry.
+func WithGroups(r *chi.Mux, repo repo.Repository, key []byte, e encrypt.Decrypter, ttl time.Duration) *chi.Mux {
+	r.Group(func(r chi.Router) {
+		r.Use(mw.CryptoMW(e), mw.GzipMW, mw.KeyInject(key), mw.SourceInject)
+		r.Post("/groups/{job}", handlers.PushGroup(repo, ttl))
+		r.Post("/groups/{job}/{instance}", handlers.PushGroup(repo, ttl))
+		r.Delete("/groups/{job}", handlers.DeleteGroup(repo))
+		r.Delete("/groups/{job}/{instance}", handlers.DeleteGroup(repo))
+	})
+
+	return r
+}
+
+// WithFederation - Function to setup router for federation handler
+//
+//	requests are signed with key instead of body hashes, so crypto
+//	middleware is not applied.
+func WithFederation(r *chi.Mux, repo repo.Repository, j *federate.Journal, key []byte) *chi.Mux {
+	r.With(mw.GzipMW, mw.KeyInject(key)).Get("/federate", handlers.Federate(repo, j))
+
+	return r
+}
+
+// WithAgents - Function to setup router for handlers listing known agents
+// and accepting their registrations, heartbeats and configuration requests signed with key.
+func WithAgents(r *chi.Mux, reg *registry.Registry, store *profiles.Store, key []byte, e encrypt.Decrypter) *chi.Mux {
+	r.With(mw.GzipMW, mw.KeyInject(key)).Get("/agents", handlers.Agents(reg))
+	r.Group(func(r chi.Router) {
+		r.Use(mw.CryptoMW(e), mw.GzipMW, mw.KeyInject(key), mw.SourceInject)
+		r.Post("/agents/register", handlers.RegisterAgent(reg))
+		r.Post("/agents/heartbeat", handlers.AgentHeartbeat(reg))
+		r.Post("/agents/config", handlers.AgentConfig(reg, store))
+	})
+
+	return r
+}
+
+// WithAdmin - Function to setup router for admin handlers
+//
+//	requests are signed with admin key validated by svc, action "agents" lists agents of reg.
+func WithAdmin(r *chi.Mux, svc *admin.Service, reg *registry.Registry, e encrypt.Decrypter) *chi.Mux {
+	r.With(mw.CryptoMW(e), mw.GzipMW, mw.SourceInject).Post("/admin/{action}", handlers.Admin(svc, reg))
 
 	return r
 }
@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// AdminServer - gRPC service executing admin requests signed with admin key.
+type AdminServer struct {
+	pb.UnimplementedAdminServer
+
+	svc *admin.Service
+	reg *registry.Registry
+}
+
+// NewAdminServer - creates new instance of Admin gRPC service executing requests with svc,
+// agents of reg are listed to admin only.
+func NewAdminServer(svc *admin.Service, reg *registry.Registry) *AdminServer {
+	return &AdminServer{svc: svc, reg: reg}
+}
+
+// Delete - deletes metric or metrics matching glob or regex as gRPC request.
+func (s *AdminServer) Delete(ctx context.Context, req *pb.AdminRequest) (*pb.AdminResponse, error) {
+	return s.do(ctx, admin.ActionDelete, req)
+}
+
+// ResetCounter - sets counter to zero as gRPC request.
+func (s *AdminServer) ResetCounter(ctx context.Context, req *pb.AdminRequest) (*pb.AdminResponse, error) {
+	return s.do(ctx, admin.ActionReset, req)
+}
+
+// Rename - renames or merges metric as gRPC request.
+func (s *AdminServer) Rename(ctx context.Context, req *pb.AdminRequest) (*pb.AdminResponse, error) {
+	return s.do(ctx, admin.ActionRename, req)
+}
+
+// Audit - returns recent audit records as gRPC request.
+func (s *AdminServer) Audit(ctx context.Context, req *pb.AdminRequest) (*pb.AuditResponse, error) {
+	entries, err := s.svc.Audit(AdminRequestFromProto(req))
+	if err != nil {
+		return nil, adminStatus(err)
+	}
+	resp := &pb.AuditResponse{}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, &pb.AuditEntry{
+			Time:      e.Time.UnixMilli(),
+			Actor:     e.Actor,
+			Transport: e.Transport,
+			Action:    e.Action,
+			Request:   AdminRequestToProto(e.Request),
+			Affected:  int32(e.Affected),
+			Error:     e.Error,
+		})
+	}
+	return resp, nil
+}
+
+// Agents - returns agents known to the server as gRPC request.
+func (s *AdminServer) Agents(ctx context.Context, req *pb.AdminRequest) (*pb.AgentsResponse, error) {
+	if err := s.svc.Authorize(admin.ActionAgents, AdminRequestFromProto(req)); err != nil {
+		return nil, adminStatus(err)
+	}
+	resp := &pb.AgentsResponse{}
+	for _, a := range s.reg.List(time.Now()) {
+		info := &pb.AgentInfo{
+			Id:            a.ID,
+			Hostname:      a.Hostname,
+			Transport:     a.Transport,
+			Version:       a.Version,
+			Commit:        a.Commit,
+			Collectors:    a.Collectors,
+			ConfigVersion: a.ConfigVersion,
+			LastSeen:      a.LastSeen.UnixMilli(),
+			Status:        a.Status,
+			Unknown:       a.Unknown,
+		}
+		if !a.Registered.IsZero() {
+			info.Registered = a.Registered.UnixMilli()
+		}
+		resp.Agents = append(resp.Agents, info)
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) do(ctx context.Context, action string, req *pb.AdminRequest) (*pb.AdminResponse, error) {
+	res, err := s.svc.Do(ctx, action, AdminRequestFromProto(req))
+	if err != nil {
+		return nil, adminStatus(err)
+	}
+	resp := &pb.AdminResponse{}
+	for _, m := range res.Metrics {
+		resp.Metrics = append(resp.Metrics, &pb.AdminSeries{Type: m.Type, Id: m.ID})
+	}
+	return resp, nil
+}
+
+func adminStatus(err error) error {
+	switch {
+	case errors.Is(err, admin.ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, admin.ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repo.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repo.ErrExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	log.Error().AnErr("Do", err).Msg("AdminServer")
+	return status.Error(codes.Internal, "failed to execute admin request")
+}
+
+// AdminRequestFromProto - converts gRPC message to admin request.
+func AdminRequestFromProto(req *pb.AdminRequest) admin.Request {
+	return admin.Request{
+		Type:      req.Type,
+		ID:        req.Id,
+		Glob:      req.Glob,
+		Regex:     req.Regex,
+		To:        req.To,
+		Merge:     req.Merge,
+		DryRun:    req.DryRun,
+		Timestamp: req.Timestamp,
+		Hash:      req.Hash,
+	}
+}
+
+// AuditEntryFromProto - converts gRPC message to audit record.
+func AuditEntryFromProto(e *pb.AuditEntry) admin.Entry {
+	entry := admin.Entry{
+		Time:      time.UnixMilli(e.Time),
+		Actor:     e.Actor,
+		Transport: e.Transport,
+		Action:    e.Action,
+		Affected:  int(e.Affected),
+		Error:     e.Error,
+	}
+	if e.Request != nil {
+		entry.Request = AdminRequestFromProto(e.Request)
+	}
+	return entry
+}
+
+// AgentFromProto - converts gRPC message to agent of registry.
+func AgentFromProto(a *pb.AgentInfo) registry.Agent {
+	agent := registry.Agent{
+		ID:            a.Id,
+		Hostname:      a.Hostname,
+		Transport:     a.Transport,
+		Version:       a.Version,
+		Commit:        a.Commit,
+		Collectors:    a.Collectors,
+		ConfigVersion: a.ConfigVersion,
+		LastSeen:      time.UnixMilli(a.LastSeen),
+		Status:        a.Status,
+		Unknown:       a.Unknown,
+	}
+	if a.Registered != 0 {
+		agent.Registered = time.UnixMilli(a.Registered)
+	}
+	return agent
+}
+
+// AdminRequestToProto - converts admin request to gRPC message.
+func AdminRequestToProto(req admin.Request) *pb.AdminRequest {
+	return &pb.AdminRequest{
+		Type:      req.Type,
+		Id:        req.ID,
+		Glob:      req.Glob,
+		Regex:     req.Regex,
+		To:        req.To,
+		Merge:     req.Merge,
+		DryRun:    req.DryRun,
+		Timestamp: req.Timestamp,
+		Hash:      req.Hash,
+	}
+}
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// AgentsServer - gRPC service accepting agent registrations and heartbeats
+// and distributing configuration profiles.
+type AgentsServer struct {
+	pb.UnimplementedAgentsServer
+
+	reg   *registry.Registry
+	store *profiles.Store
+	key   keyHolder
+}
+
+// NewAgentsServer - creates new instance of Agents gRPC service recording agents in reg
+// and selecting their profiles from store, requests are validated with key.
+func NewAgentsServer(reg *registry.Registry, store *profiles.Store, key []byte) *AgentsServer {
+	s := &AgentsServer{reg: reg, store: store}
+	s.key.set(key)
+	return s
+}
+
+// SetKey - replaces key validating requests.
+func (s *AgentsServer) SetKey(key []byte) {
+	s.key.set(key)
+}
+
+// Register - registers agent as gRPC request.
+func (s *AgentsServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if !s.valid(req.Id, registry.ActionRegister, req.Hash) {
+		return nil, status.Errorf(codes.FailedPrecondition, `invalid hash of agent: %s`, req.Id)
+	}
+
+	resp, err := s.reg.Register(registry.Registration{
+		ID:         req.Id,
+		Hostname:   req.Hostname,
+		Version:    req.Version,
+		Commit:     req.Commit,
+		Collectors: req.Collectors,
+	}, model.TransportGRPC, time.Now())
+	if err != nil {
+		return nil, agentStatus(err, req.Id)
+	}
+	// signed registration binds agent ID to peer address
+	if src, ok := model.SourceFromContext(ctx); ok && len(s.key.get()) > 0 {
+		s.reg.Bind(req.Id, src.Addr)
+	}
+
+	return &pb.RegisterResponse{Status: resp.Status, Hints: HintsToProto(resp.Hints)}, nil
+}
+
+// Heartbeat - records heartbeat of agent as gRPC request.
+func (s *AgentsServer) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	if !s.valid(req.Id, registry.ActionHeartbeat, req.Hash) {
+		return nil, status.Errorf(codes.FailedPrecondition, `invalid hash of agent: %s`, req.Id)
+	}
+
+	resp, err := s.reg.Heartbeat(registry.Heartbeat{
+		ID:            req.Id,
+		ConfigVersion: req.ConfigVersion,
+	}, model.TransportGRPC, time.Now())
+	if err != nil {
+		return nil, agentStatus(err, req.Id)
+	}
+
+	return &pb.HeartbeatResponse{Status: resp.Status}, nil
+}
+
+// GetConfig - returns configuration profile of agent as gRPC request.
+func (s *AgentsServer) GetConfig(ctx context.Context, req *pb.ConfigRequest) (*pb.ConfigResponse, error) {
+	if !s.valid(req.Id, registry.ActionConfig, req.Hash) {
+		return nil, status.Errorf(codes.FailedPrecondition, `invalid hash of agent: %s`, req.Id)
+	}
+
+	s.reg.Applied(req.Id, req.Applied)
+	return s.config(req)
+}
+
+// WatchConfig - streams configuration profile of agent as gRPC request,
+// the current profile is sent first and then every time it changes.
+func (s *AgentsServer) WatchConfig(req *pb.ConfigRequest, stream pb.Agents_WatchConfigServer) error {
+	if !s.valid(req.Id, registry.ActionConfig, req.Hash) {
+		return status.Errorf(codes.FailedPrecondition, `invalid hash of agent: %s`, req.Id)
+	}
+
+	var last *pb.ConfigResponse
+	for {
+		changed := s.store.Changed()
+		resp, err := s.config(req)
+		if err != nil {
+			return err
+		}
+		if last == nil || !proto.Equal(last, resp) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			last = resp
+		}
+
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// config returns profile of agent req.
+func (s *AgentsServer) config(req *pb.ConfigRequest) (*pb.ConfigResponse, error) {
+	p, ok := s.store.Match(req.Hostname, req.Labels)
+	if !ok {
+		return &pb.ConfigResponse{}, nil
+	}
+	settings, err := json.Marshal(p.Settings)
+	if err != nil {
+		log.Error().AnErr("Marshal", err).Msg("AgentsServer")
+		return nil, status.Errorf(codes.Internal, `failed to encode profile: %s`, p.Profile)
+	}
+	return &pb.ConfigResponse{Found: true, Profile: p.Profile, Version: p.Version, Settings: settings}, nil
+}
+
+func (s *AgentsServer) valid(id, action, h string) bool {
+	if id == "" {
+		return false
+	}
+	key := s.key.get()
+	return len(key) == 0 || hmac.Equal([]byte(h), []byte(registry.Sign(id, action, key)))
+}
+
+func agentStatus(err error, id string) error {
+	if errors.Is(err, registry.ErrUnknownAgent) {
+		return status.Errorf(codes.PermissionDenied, `unknown agent: %s`, id)
+	}
+	log.Error().AnErr("Registry", err).Msg("AgentsServer")
+	return status.Errorf(codes.Internal, `failed to process agent: %s`, id)
+}
+
+// HintsToProto - converts agent hints to gRPC message with intervals in milliseconds.
+func HintsToProto(h config.AgentHints) *pb.Hints {
+	return &pb.Hints{
+		ReportInterval:    h.ReportInterval.Milliseconds(),
+		PollInterval:      h.PollInterval.Milliseconds(),
+		HeartbeatInterval: h.HeartbeatInterval.Milliseconds(),
+	}
+}
+
+// ConfigFromProto - converts gRPC message to profile, ok is false if no profile applies to agent.
+func ConfigFromProto(resp *pb.ConfigResponse) (p profiles.Response, ok bool, err error) {
+	if resp == nil || !resp.Found {
+		return p, false, nil
+	}
+	p.Profile = resp.Profile
+	p.Version = resp.Version
+	if err := json.Unmarshal(resp.Settings, &p.Settings); err != nil {
+		return p, false, err
+	}
+	return p, true, nil
+}
+
+// HintsFromProto - converts gRPC message to agent hints.
+func HintsFromProto(h *pb.Hints) config.AgentHints {
+	var hints config.AgentHints
+	if h == nil {
+		return hints
+	}
+	hints.ReportInterval.Duration = time.Duration(h.ReportInterval) * time.Millisecond
+	hints.PollInterval.Duration = time.Duration(h.PollInterval) * time.Millisecond
+	hints.HeartbeatInterval.Duration = time.Duration(h.HeartbeatInterval) * time.Millisecond
+	return hints
+}
@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"net/url"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/andrei-cloud/go-devops/internal/federate"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// FederationServer - gRPC service returning metrics snapshots like "/federate".
+type FederationServer struct {
+	pb.UnimplementedFederationServer
+
+	repo repo.Repository
+	j    *federate.Journal
+	key  keyHolder
+}
+
+// NewFederationServer - creates new instance of Federation gRPC service returning metrics of repo
+// updated after cursor of journal j, queries are validated and metrics are signed with key.
+func NewFederationServer(repo repo.Repository, j *federate.Journal, key []byte) *FederationServer {
+	s := &FederationServer{repo: repo, j: j}
+	s.key.set(key)
+	return s
+}
+
+// SetKey - replaces key validating queries.
+func (s *FederationServer) SetKey(key []byte) {
+	s.key.set(key)
+}
+
+// Federate - returns metrics matching query of "/federate" as gRPC request,
+// with key the query must be signed with federate.SignQuery.
+func (s *FederationServer) Federate(ctx context.Context, req *pb.FederateRequest) (*pb.FederateResponse, error) {
+	key := s.key.get()
+	if len(key) != 0 && !hmac.Equal([]byte(req.Hash), []byte(federate.SignQuery(req.Query, key))) {
+		return nil, status.Error(codes.Unauthenticated, "invalid hash")
+	}
+
+	v, err := url.ParseQuery(req.Query)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+	q, err := federate.ParseQuery(v)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	snap, err := federate.Snapshot(ctx, s.repo, s.j, q, key)
+	if err != nil {
+		log.Error().AnErr("Snapshot", err).Msg("Federate")
+		return nil, status.Error(codes.Internal, "failed to get metrics")
+	}
+	resp := &pb.FederateResponse{Epoch: snap.Epoch, Version: snap.Version, Full: snap.Full}
+	for _, m := range snap.Metrics {
+		r := &pb.MetricResult{Metric: MetricToProto(m), Source: m.Source}
+		if m.Updated != nil {
+			r.Updated = m.Updated.UnixMilli()
+		}
+		resp.Metrics = append(resp.Metrics, r)
+	}
+	for _, m := range snap.Removed {
+		resp.Removed = append(resp.Removed, MetricToProto(m))
+	}
+	return resp, nil
+}
+
+// FederateResponseFromProto - converts gRPC message to snapshot of metrics.
+func FederateResponseFromProto(resp *pb.FederateResponse) federate.Response {
+	snap := federate.Response{Epoch: resp.Epoch, Version: resp.Version, Full: resp.Full}
+	for _, r := range resp.Metrics {
+		snap.Metrics = append(snap.Metrics, MetricResultFromProto(r).Metric)
+	}
+	for _, m := range resp.Removed {
+		removed := MetricFromProto(m)
+		removed.Delta, removed.Value = nil, nil
+		snap.Removed = append(snap.Removed, removed)
+	}
+	return snap
+}
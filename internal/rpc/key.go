@@ -0,0 +1,21 @@
+package rpc
+
+import "sync"
+
+// keyHolder - HMAC key replaced at runtime.
+type keyHolder struct {
+	mu  sync.RWMutex
+	key []byte
+}
+
+func (k *keyHolder) get() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.key
+}
+
+func (k *keyHolder) set(key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.key = key
+}
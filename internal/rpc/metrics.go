@@ -0,0 +1,243 @@
+// Package rpc implements gRPC services shared by server and agent relay.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andrei-cloud/go-devops/internal/bulk"
+	"github.com/andrei-cloud/go-devops/internal/groups"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+
+	repo repo.Repository
+	key  keyHolder
+}
+
+// NewMetricsServer - creates new instance of Metrics gRPC service updating repo,
+// hashes of metrics are validated with key.
+func NewMetricsServer(repo repo.Repository, key []byte) *MetricsServer {
+	s := &MetricsServer{repo: repo}
+	s.key.set(key)
+	return s
+}
+
+// SetKey - replaces key validating hashes of metrics.
+func (s *MetricsServer) SetKey(key []byte) {
+	s.key.set(key)
+}
+
+// UpdateGauge - updates gauge metrics as gRPC request
+func (s *MetricsServer) UpdateGauge(ctx context.Context, req *pb.UpdGaugeRequest) (*pb.UpdGaugeResponse, error) {
+	var response pb.UpdGaugeResponse
+
+	lm := model.Metric{
+		ID:    req.Metric.Id,
+		Delta: &req.Metric.Delta,
+		Value: &req.Metric.Value,
+		Hash:  req.Metric.Hash,
+	}
+	switch req.Metric.Mtype {
+	case pb.Metric_COUNTER:
+		lm.MType = "counter"
+	case pb.Metric_GAUGE:
+		lm.MType = "gauge"
+	}
+
+	valid, err := hash.Validate(lm, s.key.get())
+	if err != nil {
+		log.Debug().AnErr("Validate", err).Msg("UpdateBulkPost")
+		return nil, status.Errorf(codes.Internal, `Failed to update metric: %s`, req.Metric.Id)
+	}
+
+	if valid {
+
+		if err := s.repo.UpdateGauge(ctx, req.Metric.Id, req.Metric.Value); err != nil {
+			log.Error().AnErr("UpdateGauge", err).Msg("failed to update in repository")
+			return nil, updateStatus(err, req.Metric.Id)
+		}
+	} else {
+		return nil, status.Errorf(codes.FailedPrecondition, `invalid hash on metric: %s`, req.Metric.Id)
+	}
+
+	return &response, nil
+}
+
+// UpdateCounter - updates counter metrics as gRPC request
+func (s *MetricsServer) UpdateCounter(ctx context.Context, req *pb.UpdCounterRequest) (*pb.UpdCounterResponse, error) {
+	var response pb.UpdCounterResponse
+
+	lm := model.Metric{
+		ID:    req.Metric.Id,
+		Delta: &req.Metric.Delta,
+		Value: &req.Metric.Value,
+		Hash:  req.Metric.Hash,
+	}
+	switch req.Metric.Mtype {
+	case pb.Metric_COUNTER:
+		lm.MType = "counter"
+	case pb.Metric_GAUGE:
+		lm.MType = "gauge"
+	}
+
+	valid, err := hash.Validate(lm, s.key.get())
+	if err != nil {
+		log.Debug().AnErr("Validate", err).Msg("UpdateBulkPost")
+		return nil, status.Errorf(codes.Internal, `Failed to update metric: %s`, req.Metric.Id)
+	}
+
+	if valid {
+		if err := s.repo.UpdateCounter(ctx, req.Metric.Id, req.Metric.Delta); err != nil {
+			log.Error().AnErr("UpdateCounter", err).Msg("failed to update in repository")
+			return nil, updateStatus(err, req.Metric.Id)
+		}
+	} else {
+		return nil, status.Errorf(codes.FailedPrecondition, `invalid hash on metric: %s`, req.Metric.Id)
+	}
+
+	return &response, nil
+}
+
+// UpdateMetrics - updates metrics in bulk as gRPC request and reports
+// result of every metric, Error of response is reason of the first rejection.
+// With Atomic set all metrics are applied or none of them. If no metric is applied
+// because of the repository, error status is returned instead of the report.
+func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.UpdMetricsRequest) (*pb.UpdMetricsResponse, error) {
+	metrics := make([]model.Metric, 0, len(req.Metrics))
+	for _, m := range req.Metrics {
+		metrics = append(metrics, MetricFromProto(m))
+	}
+
+	report := bulk.Update(ctx, s.repo, metrics, s.key.get(), req.Atomic)
+	response := pb.UpdMetricsResponse{Accepted: int32(report.Accepted), Rejected: int32(report.Rejected)}
+	if err := report.Err(); err != nil {
+		log.Debug().AnErr("Update", err).Msg("UpdateMetrics")
+		if report.Accepted == 0 {
+			switch {
+			case errors.Is(err, registry.ErrUnknownAgent):
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			case !errors.Is(err, bulk.ErrInvalid) && !errors.Is(err, bulk.ErrUnknownType) && !errors.Is(err, bulk.ErrNotApplied):
+				// failure of the repository is not caused by metrics, the batch may be sent again
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+		}
+		response.Error = err.Error()
+	}
+	for _, res := range report.Results {
+		response.Results = append(response.Results, &pb.UpdResult{Id: res.ID, Type: res.MType, Status: res.Status, Error: res.Error})
+	}
+	return &response, nil
+}
+
+// GetMetrics - returns values of metrics identified by id and type as gRPC request,
+// missing metrics are reported in error of their result.
+func (s *MetricsServer) GetMetrics(ctx context.Context, req *pb.GetMetricsRequest) (*pb.GetMetricsResponse, error) {
+	metrics := make([]model.Metric, 0, len(req.Metrics))
+	for _, m := range req.Metrics {
+		metrics = append(metrics, MetricFromProto(m))
+	}
+
+	var response pb.GetMetricsResponse
+	for _, res := range bulk.Get(ctx, s.repo, metrics, s.key.get()) {
+		r := &pb.MetricResult{Metric: MetricToProto(res.Metric), Error: res.Error, Source: res.Source}
+		if res.Updated != nil {
+			r.Updated = res.Updated.UnixMilli()
+		}
+		response.Results = append(response.Results, r)
+	}
+	return &response, nil
+}
+
+// DeleteGroup - deletes all series of push group as gRPC request, series of every
+// instance of the job are deleted without instance. With key the request must be
+// signed with hash.CreateTimed of the group path and timestamp within hash.MaxSkew.
+func (s *MetricsServer) DeleteGroup(ctx context.Context, req *pb.DeleteGroupRequest) (*pb.DeleteGroupResponse, error) {
+	if req.Job == "" {
+		return nil, status.Error(codes.InvalidArgument, "job is required")
+	}
+	g := groups.Group{Job: req.Job, Instance: req.Instance}
+	if key := s.key.get(); len(key) != 0 {
+		if err := hash.ValidateTimed(g.Path(), req.Timestamp, req.Hash, key, time.Now()); err != nil {
+			log.Debug().AnErr("ValidateTimed", err).Msg("DeleteGroup")
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+	}
+
+	n, err := groups.Delete(ctx, s.repo, g, g.Instance == "")
+	if err != nil {
+		log.Error().AnErr("Delete", err).Msg("DeleteGroup")
+		return nil, status.Errorf(codes.Internal, "failed to delete group: %s", g.Path())
+	}
+	return &pb.DeleteGroupResponse{Deleted: int32(n)}, nil
+}
+
+// updateStatus - returns status of failed update of metric id, updates of agents
+// rejected by allow-list are denied.
+func updateStatus(err error, id string) error {
+	if errors.Is(err, registry.ErrUnknownAgent) {
+		return status.Errorf(codes.PermissionDenied, `unknown agent, metric: %s`, id)
+	}
+	return status.Errorf(codes.Internal, `Failed to update metric: %s`, id)
+}
+
+// MetricFromProto - converts gRPC message to metric, value or delta is set by type.
+func MetricFromProto(m *pb.Metric) model.Metric {
+	lm := model.Metric{ID: m.Id, Hash: m.Hash}
+	switch m.Mtype {
+	case pb.Metric_COUNTER:
+		lm.MType = "counter"
+		d := m.Delta
+		lm.Delta = &d
+	case pb.Metric_GAUGE:
+		lm.MType = "gauge"
+		v := m.Value
+		lm.Value = &v
+	}
+	return lm
+}
+
+// MetricToProto - converts metric to gRPC message.
+func MetricToProto(m model.Metric) *pb.Metric {
+	metric := &pb.Metric{Id: m.ID, Hash: m.Hash}
+	switch m.MType {
+	case "counter":
+		metric.Mtype = pb.Metric_COUNTER
+	case "gauge":
+		metric.Mtype = pb.Metric_GAUGE
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	return metric
+}
+
+// MetricResultFromProto - converts gRPC message to result of bulk request.
+func MetricResultFromProto(r *pb.MetricResult) bulk.Result {
+	res := bulk.Result{Error: r.Error}
+	if r.Metric != nil {
+		res.Metric = MetricFromProto(r.Metric)
+	}
+	if r.Error != "" {
+		res.Delta, res.Value = nil, nil
+	}
+	if r.Updated != 0 {
+		updated := time.UnixMilli(r.Updated)
+		res.Updated = &updated
+	}
+	res.Source = r.Source
+	return res
+}
@@ -0,0 +1,313 @@
+// Package search implements listing of stored metrics for "/api/metrics":
+// filtering by name prefix, glob, regular expression and type, sorting
+// and cursor pagination.
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+)
+
+// Query parameters of "/api/metrics".
+const (
+	ParamPrefix = "prefix" // metric ID prefix
+	ParamGlob   = "glob"   // path.Match pattern of metric ID
+	ParamRegex  = "regex"  // regular expression of metric ID
+	ParamType   = "type"   // "gauge" or "counter", any if empty
+	ParamSort   = "sort"   // SortID, SortType or SortValue
+	ParamOrder  = "order"  // "asc" or "desc"
+	ParamLimit  = "limit"  // page size, DefaultLimit if empty
+	ParamCursor = "cursor" // next_cursor of the previous page
+)
+
+// Sort orders, ties are broken by ID and type.
+const (
+	SortID    = "id"
+	SortType  = "type"
+	SortValue = "value" // counters are compared with gauges by their totals
+)
+
+// Page size limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Query - filters, order and page of listing. All filters set must match.
+type Query struct {
+	Prefix string
+	Glob   string
+	Regex  string
+	Type   string
+	Sort   string
+	Desc   bool
+	Limit  int
+	Cursor string
+}
+
+// ParseQuery - parses and validates query parameters of "/api/metrics" request.
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{
+		Prefix: v.Get(ParamPrefix),
+		Glob:   v.Get(ParamGlob),
+		Regex:  v.Get(ParamRegex),
+		Type:   v.Get(ParamType),
+		Sort:   v.Get(ParamSort),
+		Limit:  DefaultLimit,
+		Cursor: v.Get(ParamCursor),
+	}
+	if q.Glob != "" {
+		if _, err := path.Match(q.Glob, ""); err != nil {
+			return q, fmt.Errorf("invalid %s: %w", ParamGlob, err)
+		}
+	}
+	if q.Regex != "" {
+		if _, err := regexp.Compile(q.Regex); err != nil {
+			return q, fmt.Errorf("invalid %s: %w", ParamRegex, err)
+		}
+	}
+	switch q.Type {
+	case "", "gauge", "counter":
+	default:
+		return q, fmt.Errorf("invalid %s %q", ParamType, q.Type)
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = SortID
+	case SortID, SortType, SortValue:
+	default:
+		return q, fmt.Errorf("invalid %s %q", ParamSort, q.Sort)
+	}
+	switch v.Get(ParamOrder) {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("invalid %s %q", ParamOrder, v.Get(ParamOrder))
+	}
+	if s := v.Get(ParamLimit); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > MaxLimit {
+			return q, fmt.Errorf("invalid %s %q: must be from 1 to %d", ParamLimit, s, MaxLimit)
+		}
+		q.Limit = n
+	}
+	if q.Cursor != "" {
+		if _, err := q.decodeCursor(); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// Values - encodes query as query parameters.
+func (q Query) Values() url.Values {
+	v := url.Values{}
+	for k, s := range map[string]string{
+		ParamPrefix: q.Prefix,
+		ParamGlob:   q.Glob,
+		ParamRegex:  q.Regex,
+		ParamType:   q.Type,
+		ParamSort:   q.Sort,
+		ParamCursor: q.Cursor,
+	} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	if q.Desc {
+		v.Set(ParamOrder, "desc")
+	}
+	if q.Limit > 0 {
+		v.Set(ParamLimit, strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// Page - body of "/api/metrics" response. Next is empty on the last page.
+type Page struct {
+	Metrics []model.Metric `json:"metrics"`
+	Total   int            `json:"total"` // number of metrics matching filters
+	Next    string         `json:"next_cursor,omitempty"`
+}
+
+// cursor - position after the last metric of page, valid for the same order only.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	ID    string `json:"i"`
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"` // formatted, JSON has no NaN and infinities
+}
+
+func (q Query) decodeCursor() (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.Sort != q.Sort || c.Desc != q.Desc {
+		return c, fmt.Errorf("invalid %s", ParamCursor)
+	}
+	return c, nil
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// item - metric with its value used for sorting.
+type item struct {
+	m model.Metric
+	v float64
+}
+
+// List - returns page of metrics of r matching q with metadata of their last update.
+// Metrics are signed with key if set.
+func List(ctx context.Context, r repo.Repository, q Query, key []byte) (Page, error) {
+	var page Page
+	match, err := q.matcher()
+	if err != nil {
+		return page, err
+	}
+
+	var items []item
+	if q.Type == "" || q.Type == "gauge" {
+		gauges, err := r.GetGaugeAll(ctx)
+		if err != nil {
+			return page, err
+		}
+		for id, v := range gauges {
+			if match(id) {
+				v := v
+				items = append(items, item{m: model.Metric{ID: id, MType: "gauge", Value: &v}, v: v})
+			}
+		}
+	}
+	if q.Type == "" || q.Type == "counter" {
+		counters, err := r.GetCounterAll(ctx)
+		if err != nil {
+			return page, err
+		}
+		for id, d := range counters {
+			if match(id) {
+				d := d
+				items = append(items, item{m: model.Metric{ID: id, MType: "counter", Delta: &d}, v: float64(d)})
+			}
+		}
+	}
+	page.Total = len(items)
+
+	less := q.less()
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+	if q.Cursor != "" {
+		c, err := q.decodeCursor()
+		if err != nil {
+			return page, err
+		}
+		last := item{m: model.Metric{ID: c.ID, MType: c.Type}}
+		if c.Value != "" {
+			if last.v, err = strconv.ParseFloat(c.Value, 64); err != nil {
+				return page, fmt.Errorf("invalid %s", ParamCursor)
+			}
+		}
+		items = items[sort.Search(len(items), func(i int) bool { return less(last, items[i]) }):]
+	}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		last := items[len(items)-1]
+		c := cursor{Sort: q.Sort, Desc: q.Desc, ID: last.m.ID, Type: last.m.MType}
+		if q.Sort == SortValue {
+			c.Value = strconv.FormatFloat(last.v, 'g', -1, 64)
+		}
+		page.Next = encodeCursor(c)
+	}
+
+	meta := map[string]map[string]model.Metadata{}
+	for _, mtype := range []string{"gauge", "counter"} {
+		// metadata is optional, relay does not track it
+		meta[mtype], _ = r.GetMetadataAll(ctx, mtype)
+	}
+	page.Metrics = make([]model.Metric, 0, len(items))
+	for _, it := range items {
+		m := it.m
+		if md, ok := meta[m.MType][m.ID]; ok {
+			updated := md.Updated
+			m.Updated, m.Source = &updated, md.Source
+		}
+		page.Metrics = append(page.Metrics, hash.Sign(m, key))
+	}
+	return page, nil
+}
+
+// matcher returns function reporting whether metric ID passes name filters of q.
+func (q Query) matcher() (func(string) bool, error) {
+	var re *regexp.Regexp
+	if q.Regex != "" {
+		var err error
+		if re, err = regexp.Compile(q.Regex); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ParamRegex, err)
+		}
+	}
+	return func(id string) bool {
+		if !strings.HasPrefix(id, q.Prefix) {
+			return false
+		}
+		if q.Glob != "" {
+			if ok, _ := path.Match(q.Glob, id); !ok {
+				return false
+			}
+		}
+		return re == nil || re.MatchString(id)
+	}, nil
+}
+
+// less returns strict order of items by sort key of q, then by ID and type.
+func (q Query) less() func(a, b item) bool {
+	return func(a, b item) bool {
+		c := 0
+		switch q.Sort {
+		case SortType:
+			c = strings.Compare(a.m.MType, b.m.MType)
+		case SortValue:
+			c = compareFloat(a.v, b.v)
+		}
+		if c == 0 {
+			c = strings.Compare(a.m.ID, b.m.ID)
+		}
+		if c == 0 {
+			c = strings.Compare(a.m.MType, b.m.MType)
+		}
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+}
+
+// compareFloat compares a and b, NaN is less than any number.
+func compareFloat(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a) || a < b:
+		return -1
+	case math.IsNaN(b) || a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestList(t *testing.T) {
+	ctx := model.WithSource(context.Background(), model.Source{Agent: "host1", Transport: model.TransportHTTP})
+	r := inmem.New()
+	gauges := map[string]float64{"cpu;host=a": 0.5, "cpu;host=b": 0.9, "mem;host=a": 512, "disk": 10}
+	for id, v := range gauges {
+		require.NoError(t, r.UpdateGauge(ctx, id, v))
+	}
+	require.NoError(t, r.UpdateCounter(ctx, "cpu_ticks", 100))
+	require.NoError(t, r.UpdateCounter(ctx, "disk", 3))
+
+	ids := func(p Page) []string {
+		var ids []string
+		for _, m := range p.Metrics {
+			ids = append(ids, m.MType+":"+m.ID)
+		}
+		return ids
+	}
+	list := func(params string) Page {
+		t.Helper()
+		v, err := url.ParseQuery(params)
+		require.NoError(t, err)
+		q, err := ParseQuery(v)
+		require.NoError(t, err)
+		p, err := List(ctx, r, q, nil)
+		require.NoError(t, err)
+		return p
+	}
+
+	p := list("prefix=cpu")
+	require.Equal(t, []string{"gauge:cpu;host=a", "gauge:cpu;host=b", "counter:cpu_ticks"}, ids(p))
+	require.Equal(t, 3, p.Total)
+	require.Empty(t, p.Next)
+	require.Equal(t, "host1", p.Metrics[0].Source)
+	require.NotNil(t, p.Metrics[0].Updated)
+
+	require.Equal(t, []string{"gauge:cpu;host=a", "gauge:mem;host=a"}, ids(list(url.Values{ParamGlob: {"*;host=a"}}.Encode())))
+	require.Equal(t, []string{"counter:disk"}, ids(list("regex=^d&type=counter")))
+
+	// pages of value order cover all metrics exactly once
+	var all []string
+	params := url.Values{ParamSort: {SortValue}, ParamOrder: {"desc"}, ParamLimit: {"4"}}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		p := list(params.Encode())
+		require.Equal(t, 6, p.Total)
+		all = append(all, ids(p)...)
+		if p.Next == "" {
+			break
+		}
+		params.Set(ParamCursor, p.Next)
+	}
+	require.Equal(t, []string{"gauge:mem;host=a", "counter:cpu_ticks", "gauge:disk", "counter:disk",
+		"gauge:cpu;host=b", "gauge:cpu;host=a"}, all)
+
+	// metric added before the cursor position is not returned on the next page
+	p = list("limit=2")
+	require.Equal(t, []string{"gauge:cpu;host=a", "gauge:cpu;host=b"}, ids(p))
+	require.NoError(t, r.UpdateGauge(ctx, "a", 1))
+	require.Equal(t, []string{"counter:cpu_ticks", "counter:disk"}, ids(list("limit=2&cursor="+p.Next)))
+
+	p, err := List(ctx, r, Query{Prefix: "disk", Sort: SortID, Limit: 1}, []byte("secret"))
+	require.NoError(t, err)
+	require.NotEmpty(t, p.Metrics[0].Hash)
+}
+
+func TestParseQuery(t *testing.T) {
+	next := encodeCursor(cursor{Sort: SortID, ID: "a", Type: "gauge"})
+	for _, params := range []string{
+		"glob=[",
+		"regex=(",
+		"type=histogram",
+		"sort=name",
+		"order=up",
+		"limit=0",
+		"limit=1001",
+		"cursor=x",
+		"sort=value&cursor=" + next,
+	} {
+		v, err := url.ParseQuery(params)
+		require.NoError(t, err)
+		_, err = ParseQuery(v)
+		require.Error(t, err, params)
+	}
+
+	q, err := ParseQuery(url.Values{ParamCursor: {next}})
+	require.NoError(t, err)
+	require.Equal(t, Query{Sort: SortID, Limit: DefaultLimit, Cursor: next}, q)
+	back, err := ParseQuery(q.Values())
+	require.NoError(t, err)
+	require.Equal(t, q, back)
+}
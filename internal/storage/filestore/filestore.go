@@ -63,9 +63,11 @@ func (s *FileStorage) Store(repo repo.Repository) error {
 		if err != nil {
 			return err
 		}
+		meta, _ := repo.GetMetadataAll(context.Background(), "gauge")
 		for k, v := range gauges {
 			metric.ID = k
 			metric.Value = &v
+			setMetadata(&metric, meta)
 			json.NewEncoder(writer).Encode(&metric)
 		}
 	}
@@ -79,9 +81,11 @@ func (s *FileStorage) Store(repo repo.Repository) error {
 		if err != nil {
 			return err
 		}
+		meta, _ := repo.GetMetadataAll(context.Background(), "counter")
 		for k, v := range counters {
 			metric.ID = k
 			metric.Delta = &v
+			setMetadata(&metric, meta)
 			json.NewEncoder(writer).Encode(&metric)
 		}
 	}
@@ -107,16 +111,22 @@ func (s *FileStorage) Restore(repo repo.Repository) error {
 			return err
 		}
 
+		// metadata of the last update is restored as well
+		ctx := model.WithSource(context.Background(), model.Source{Agent: metric.Source})
+		if metric.Updated != nil {
+			ctx = model.WithUpdated(ctx, *metric.Updated)
+		}
+
 		switch metric.MType {
 		case "gauge":
 			if metric.Value != nil {
-				if err := repo.UpdateGauge(context.Background(), metric.ID, *metric.Value); err != nil {
+				if err := repo.UpdateGauge(ctx, metric.ID, *metric.Value); err != nil {
 					fmt.Println(err)
 				}
 			}
 		case "counter":
 			if metric.Delta != nil {
-				if err := repo.UpdateCounter(context.Background(), metric.ID, *metric.Delta); err != nil {
+				if err := repo.UpdateCounter(ctx, metric.ID, *metric.Delta); err != nil {
 					fmt.Println(err)
 				}
 			}
@@ -131,6 +141,16 @@ func (s *FileStorage) Restore(repo repo.Repository) error {
 	return nil
 }
 
+// setMetadata sets time and source of the last update of metric from meta.
+func setMetadata(metric *model.Metric, meta map[string]model.Metadata) {
+	metric.Updated, metric.Source = nil, ""
+	if md, ok := meta[metric.ID]; ok {
+		updated := md.Updated
+		metric.Updated = &updated
+		metric.Source = md.Source
+	}
+}
+
 func (s *FileStorage) close(f *os.File) error {
 	return f.Close()
 }
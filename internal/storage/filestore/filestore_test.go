@@ -0,0 +1,42 @@
+package filestore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+)
+
+func TestStoreRestoreMetadata(t *testing.T) {
+	ctx := context.Background()
+	updated := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	uctx := model.WithUpdated(model.WithSource(ctx, model.Source{Agent: "host1"}), updated)
+
+	src := inmem.New()
+	require.NoError(t, src.UpdateGauge(uctx, "Alloc", 1.5))
+	require.NoError(t, src.UpdateCounter(uctx, "PollCount", 3))
+
+	fs := NewFileStorage(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, fs.Store(src))
+
+	dst := inmem.New()
+	require.NoError(t, fs.Restore(dst))
+
+	v, err := dst.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	require.Equal(t, 1.5, v)
+	for _, mtype := range []string{"gauge", "counter"} {
+		md, err := dst.GetMetadataAll(ctx, mtype)
+		require.NoError(t, err)
+		require.Len(t, md, 1)
+		for _, m := range md {
+			require.Equal(t, "host1", m.Source)
+			require.True(t, updated.Equal(m.Updated))
+		}
+	}
+}
@@ -4,13 +4,18 @@ package inmem
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/andrei-cloud/go-devops/internal/model"
 	"github.com/andrei-cloud/go-devops/internal/repo"
 )
 
 type storage struct {
+	mu       sync.RWMutex
 	counters map[string]int64
 	gauges   map[string]float64
+	// metadata of the last update by metric type and id
+	meta map[string]map[string]model.Metadata
 }
 
 var _ repo.Repository = &storage{}
@@ -20,28 +25,134 @@ func New() *storage {
 	s := &storage{}
 	s.counters = make(map[string]int64)
 	s.gauges = make(map[string]float64)
+	s.meta = map[string]map[string]model.Metadata{
+		"gauge":   make(map[string]model.Metadata),
+		"counter": make(map[string]model.Metadata),
+	}
 	return s
 }
 
 // UpdateGauge - updates metric of type gauge of name g and value v
 // return error if failed.
 func (s *storage) UpdateGauge(ctx context.Context, g string, v float64) error {
-	// fmt.Printf("UpdateGauge g: %s, v: %f\n", g, v)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.gauges[g] = v
+	s.meta["gauge"][g] = model.MetadataFromContext(ctx)
 	return nil
 }
 
 // UpdateCounter - updates metric of type counter of name c and value v
 // return error if failed.
 func (s *storage) UpdateCounter(ctx context.Context, c string, v int64) error {
-	// fmt.Printf("UpdateCounter c: %s, v: %d\n", c, v)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.counters[c] += v
+	s.meta["counter"][c] = model.MetadataFromContext(ctx)
+	return nil
+}
+
+// UpdateMetrics - updates all metrics under single lock
+// return error and updates nothing if any metric is invalid.
+func (s *storage) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+	md := model.MetadataFromContext(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		if m.MType == "gauge" {
+			s.gauges[m.ID] = *m.Value
+		} else {
+			s.counters[m.ID] += *m.Delta
+		}
+		s.meta[m.MType][m.ID] = md
+	}
+	return nil
+}
+
+// DeleteGauge - deletes metric of type gauge of name g
+// return error wrapping repo.ErrNotFound if not found.
+func (s *storage) DeleteGauge(ctx context.Context, g string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exist := s.gauges[g]; !exist {
+		return fmt.Errorf("%w: gauge %s", repo.ErrNotFound, g)
+	}
+	delete(s.gauges, g)
+	delete(s.meta["gauge"], g)
+	return nil
+}
+
+// DeleteCounter - deletes metric of type counter of name c
+// return error wrapping repo.ErrNotFound if not found.
+func (s *storage) DeleteCounter(ctx context.Context, c string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exist := s.counters[c]; !exist {
+		return fmt.Errorf("%w: counter %s", repo.ErrNotFound, c)
+	}
+	delete(s.counters, c)
+	delete(s.meta["counter"], c)
+	return nil
+}
+
+// ResetCounter - sets value of metric of type counter of name c to zero
+// return error if not found.
+func (s *storage) ResetCounter(ctx context.Context, c string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exist := s.counters[c]; !exist {
+		return fmt.Errorf("%w: counter %s", repo.ErrNotFound, c)
+	}
+	s.counters[c] = 0
+	s.meta["counter"][c] = model.MetadataFromContext(ctx)
+	return nil
+}
+
+// Rename - renames metric of type mtype from name from to name to,
+// existing metric to is merged only if merge is set.
+// return error if from is not found or to exists.
+func (s *storage) Rename(ctx context.Context, mtype, from, to string, merge bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch mtype {
+	case "gauge":
+		v, exist := s.gauges[from]
+		if !exist {
+			return fmt.Errorf("%w: gauge %s", repo.ErrNotFound, from)
+		}
+		if _, exist := s.gauges[to]; exist && !merge {
+			return fmt.Errorf("%w: gauge %s", repo.ErrExists, to)
+		}
+		delete(s.gauges, from)
+		s.gauges[to] = v
+	case "counter":
+		v, exist := s.counters[from]
+		if !exist {
+			return fmt.Errorf("%w: counter %s", repo.ErrNotFound, from)
+		}
+		if _, exist := s.counters[to]; exist && !merge {
+			return fmt.Errorf("%w: counter %s", repo.ErrExists, to)
+		}
+		delete(s.counters, from)
+		s.counters[to] += v
+	default:
+		return fmt.Errorf("unknown metric type %s", mtype)
+	}
+	s.meta[mtype][to] = s.meta[mtype][from]
+	delete(s.meta[mtype], from)
 	return nil
 }
 
 // GetCounter - gets metric of type counter of name c
 // return error if failed.
 func (s *storage) GetCounter(ctx context.Context, c string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if v, exist := s.counters[c]; exist {
 		return v, nil
 	}
@@ -51,22 +162,59 @@ func (s *storage) GetCounter(ctx context.Context, c string) (int64, error) {
 // GetGauge - gets metric of type Gauge of name g
 // return error if failed.
 func (s *storage) GetGauge(ctx context.Context, g string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if v, exist := s.gauges[g]; exist {
 		return v, nil
 	}
 	return 0, fmt.Errorf("gauge not found")
 }
 
-// GetGaugeAll - return map with all metrics of type gauge
+// GetMetadata - gets metadata of the last update of metric id of type mtype
+// return error if not found.
+func (s *storage) GetMetadata(ctx context.Context, mtype, id string) (model.Metadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if md, exist := s.meta[mtype][id]; exist {
+		return md, nil
+	}
+	return model.Metadata{}, fmt.Errorf("%s not found", mtype)
+}
+
+// GetMetadataAll - return map with metadata of all metrics of type mtype
+// reurns error if failed.
+func (s *storage) GetMetadataAll(ctx context.Context, mtype string) (map[string]model.Metadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	md := make(map[string]model.Metadata, len(s.meta[mtype]))
+	for id, m := range s.meta[mtype] {
+		md[id] = m
+	}
+	return md, nil
+}
+
+// GetGaugeAll - return copy of map with all metrics of type gauge
 // reurns error if failed.
 func (s *storage) GetGaugeAll(ctx context.Context) (map[string]float64, error) {
-	return s.gauges, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	gauges := make(map[string]float64, len(s.gauges))
+	for id, v := range s.gauges {
+		gauges[id] = v
+	}
+	return gauges, nil
 }
 
-// GetCounterAll - return map with all metrics of type gauge
+// GetCounterAll - return copy of map with all metrics of type counter
 // reurns error if failed.
 func (s *storage) GetCounterAll(ctx context.Context) (map[string]int64, error) {
-	return s.counters, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counters := make(map[string]int64, len(s.counters))
+	for id, v := range s.counters {
+		counters[id] = v
+	}
+	return counters, nil
 }
 
 // Ping - for in memory repository always nil error, Success.
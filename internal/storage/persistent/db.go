@@ -4,11 +4,14 @@ package persistent
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/rs/zerolog/log"
 
+	"github.com/andrei-cloud/go-devops/internal/model"
 	"github.com/andrei-cloud/go-devops/internal/repo"
 )
 
@@ -47,6 +50,29 @@ func createTable(ctx context.Context, db *sql.DB) error {
 		"delta" bigint,
 		"value" double precision
 	  );`)
+	if err != nil {
+		return err
+	}
+
+	// metric names derived from runtime/metrics do not fit into initial 45 characters,
+	// the column is widened once, rewriting table on every start is avoided.
+	var width sql.NullInt64
+	err = db.QueryRowContext(ctx, `SELECT character_maximum_length FROM information_schema.columns
+		WHERE table_name = 'metrics' AND column_name = 'id';`).Scan(&width)
+	if err != nil {
+		return err
+	}
+	if width.Valid && width.Int64 < 255 {
+		_, err = db.ExecContext(ctx, `ALTER TABLE "metrics" ALTER COLUMN "id" TYPE varchar(255);`)
+		if err != nil {
+			return err
+		}
+	}
+
+	// time and source agent of the last update, null for rows updated before.
+	_, err = db.ExecContext(ctx, `ALTER TABLE "metrics"
+		ADD COLUMN IF NOT EXISTS "updated" timestamptz,
+		ADD COLUMN IF NOT EXISTS "source" varchar(255);`)
 
 	return err
 }
@@ -68,30 +94,162 @@ func (s *Storage) Ping() error {
 // return error if failed.
 func (s *Storage) UpdateGauge(ctx context.Context, g string, v float64) error {
 	log.Debug().Str("metric", g).Float64("value", v).Msg("DB UpdateGauge")
-	_, err := s.DB.ExecContext(ctx, `insert into metrics (id, mtype, value) values ($1, 'gauge', $2) on conflict (id) do update set value = $2;`, g, v)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return updateGauge(ctx, s.DB, g, v)
 }
 
 // UpdateCounter - updates metric of type counter of name c and value v
 // return error if failed.
 func (s *Storage) UpdateCounter(ctx context.Context, c string, v int64) error {
 	log.Debug().Str("metric", c).Int64("delta", v).Msg("DB UpdateCounter")
-	_, err := s.DB.ExecContext(ctx, `insert into metrics (id, mtype, delta) 
-	values ($1, 'counter', $2)
+	return updateCounter(ctx, s.DB, c, v)
+}
+
+// UpdateMetrics - updates all metrics in single transaction
+// return error and updates nothing if any metric is invalid or failed.
+func (s *Storage) UpdateMetrics(ctx context.Context, metrics []model.Metric) error {
+	log.Debug().Int("metrics", len(metrics)).Msg("DB UpdateMetrics")
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range metrics {
+		if m.MType == "gauge" {
+			err = updateGauge(ctx, tx, m.ID, *m.Value)
+		} else {
+			err = updateCounter(ctx, tx, m.ID, *m.Delta)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// execer - database or transaction executing statements.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func updateGauge(ctx context.Context, ex execer, g string, v float64) error {
+	md := model.MetadataFromContext(ctx)
+	_, err := ex.ExecContext(ctx, `insert into metrics (id, mtype, value, updated, source) values ($1, 'gauge', $2, $3, $4)
+	on conflict (id) do update set value = $2, updated = $3, source = $4;`, g, v, md.Updated, md.Source)
+	return err
+}
+
+func updateCounter(ctx context.Context, ex execer, c string, v int64) error {
+	md := model.MetadataFromContext(ctx)
+	_, err := ex.ExecContext(ctx, `insert into metrics (id, mtype, delta, updated, source)
+	values ($1, 'counter', $2, $3, $4)
 	on conflict (id)
 	do
-	update set delta = (select delta from metrics where id= $1 and mtype = 'counter') + $2;`, c, v)
+	update set delta = (select delta from metrics where id= $1 and mtype = 'counter') + $2, updated = $3, source = $4;`, c, v, md.Updated, md.Source)
+	return err
+}
+
+// DeleteGauge - deletes metric of type gauge of name g
+// return error wrapping repo.ErrNotFound if not found, or error if failed.
+func (s *Storage) DeleteGauge(ctx context.Context, g string) error {
+	log.Debug().Str("metric", g).Msg("DB DeleteGauge")
+	return s.delete(ctx, "gauge", g)
+}
+
+// DeleteCounter - deletes metric of type counter of name c
+// return error wrapping repo.ErrNotFound if not found, or error if failed.
+func (s *Storage) DeleteCounter(ctx context.Context, c string) error {
+	log.Debug().Str("metric", c).Msg("DB DeleteCounter")
+	return s.delete(ctx, "counter", c)
+}
+
+func (s *Storage) delete(ctx context.Context, mtype, id string) error {
+	res, err := s.DB.ExecContext(ctx, "DELETE FROM metrics WHERE mtype = $1 and id = $2", mtype, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s %s", repo.ErrNotFound, mtype, id)
+	}
+	return nil
+}
 
+// ResetCounter - sets value of metric of type counter of name c to zero
+// return error if not found or failed.
+func (s *Storage) ResetCounter(ctx context.Context, c string) error {
+	log.Debug().Str("metric", c).Msg("DB ResetCounter")
+	md := model.MetadataFromContext(ctx)
+	res, err := s.DB.ExecContext(ctx, "UPDATE metrics SET delta = 0, updated = $2, source = $3 WHERE mtype = 'counter' and id = $1",
+		c, md.Updated, md.Source)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: counter %s", repo.ErrNotFound, c)
+	}
 	return nil
 }
 
+// Rename - renames metric of type mtype from name from to name to in single transaction,
+// existing metric to is merged only if merge is set.
+// return error if from is not found, to exists or failed.
+func (s *Storage) Rename(ctx context.Context, mtype, from, to string, merge bool) error {
+	log.Debug().Str("from", from).Str("to", to).Bool("merge", merge).Msg("DB Rename")
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found string
+	err = tx.QueryRowContext(ctx, "SELECT id FROM metrics WHERE mtype = $1 and id = $2 FOR UPDATE", mtype, from).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s %s", repo.ErrNotFound, mtype, from)
+	}
+	if err != nil {
+		return err
+	}
+
+	// ids are unique across types, so metric of another type can not be merged
+	var existing string
+	err = tx.QueryRowContext(ctx, "SELECT mtype FROM metrics WHERE id = $1 FOR UPDATE", to).Scan(&existing)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	case existing != mtype || !merge:
+		return fmt.Errorf("%w: %s %s", repo.ErrExists, existing, to)
+	default:
+		if mtype == "counter" {
+			_, err = tx.ExecContext(ctx, "UPDATE metrics SET delta = delta + (SELECT delta FROM metrics WHERE id = $2) WHERE id = $1", from, to)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM metrics WHERE id = $1", to); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE metrics SET id = $2 WHERE id = $1", from, to); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // GetCounter - gets metric of type counter of name c
 // return error if failed.
 func (s *Storage) GetCounter(ctx context.Context, c string) (int64, error) {
@@ -120,6 +278,47 @@ func (s *Storage) GetGauge(ctx context.Context, g string) (float64, error) {
 	return value, nil
 }
 
+// GetMetadata - gets time and source agent of the last update of metric id of type mtype
+// return error if failed.
+func (s *Storage) GetMetadata(ctx context.Context, mtype, id string) (model.Metadata, error) {
+	var (
+		updated sql.NullTime
+		source  sql.NullString
+	)
+
+	err := s.DB.QueryRowContext(ctx, "SELECT updated, source FROM metrics WHERE mtype = $1 and id = $2", mtype, id).Scan(&updated, &source)
+	if err != nil {
+		return model.Metadata{}, err
+	}
+
+	return model.Metadata{Updated: updated.Time, Source: source.String}, nil
+}
+
+// GetMetadataAll - return map with metadata of all metrics of type mtype
+// reurns error if failed.
+func (s *Storage) GetMetadataAll(ctx context.Context, mtype string) (map[string]model.Metadata, error) {
+	var (
+		id      string
+		updated sql.NullTime
+		source  sql.NullString
+	)
+
+	md := make(map[string]model.Metadata)
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, updated, source FROM metrics WHERE mtype = $1", mtype)
+	if err != nil {
+		return md, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = rows.Scan(&id, &updated, &source); err != nil {
+			return md, err
+		}
+		md[id] = model.Metadata{Updated: updated.Time, Source: source.String}
+	}
+
+	return md, rows.Err()
+}
+
 // GetGaugeAll - return map with all metrics of type gauge
 // reurns error if failed.
 func (s *Storage) GetGaugeAll(ctx context.Context) (map[string]float64, error) {
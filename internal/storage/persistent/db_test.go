@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/andrei-cloud/go-devops/internal/model"
 	"github.com/andrei-cloud/go-devops/internal/repo"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/suite"
@@ -34,8 +36,20 @@ func (s *DBTestSuite) TearDownTest() {
 func (s *DBTestSuite) TestCreateTable() {
 	query := "^CREATE TABLE IF NOT EXISTS (.+)"
 
+	width := "^SELECT character_maximum_length FROM information_schema.columns (.+)"
+
 	s.mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectQuery(width).WillReturnRows(sqlmock.NewRows([]string{"character_maximum_length"}).AddRow(45))
+	s.mock.ExpectExec("^ALTER TABLE (.+) ALTER COLUMN (.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec("^ALTER TABLE (.+) ADD COLUMN (.+)").WillReturnResult(sqlmock.NewResult(0, 0))
 	s.NoError(createTable(context.Background(), s.db))
+
+	// column already widened is not altered
+	s.mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectQuery(width).WillReturnRows(sqlmock.NewRows([]string{"character_maximum_length"}).AddRow(255))
+	s.mock.ExpectExec("^ALTER TABLE (.+) ADD COLUMN (.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.NoError(createTable(context.Background(), s.db))
+	s.NoError(s.mock.ExpectationsWereMet())
 }
 
 func (s *DBTestSuite) TestPing() {
@@ -48,8 +62,8 @@ func (s *DBTestSuite) TestPing() {
 func (s *DBTestSuite) TestUpdateGauge() {
 	query := "^insert into metrics (.+)"
 
-	s.mock.ExpectExec(query).WithArgs("test", 1.234).WillReturnResult(sqlmock.NewResult(1, 1))
-	s.mock.ExpectExec(query).WithArgs("fail", 1.234).WillReturnError(fmt.Errorf("DB error"))
+	s.mock.ExpectExec(query).WithArgs("test", 1.234, sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(query).WithArgs("fail", 1.234, sqlmock.AnyArg(), "").WillReturnError(fmt.Errorf("DB error"))
 	s.NoError(s.repo.UpdateGauge(context.Background(), "test", 1.234))
 	s.Error(s.repo.UpdateGauge(context.Background(), "fail", 1.234))
 }
@@ -57,12 +71,84 @@ func (s *DBTestSuite) TestUpdateGauge() {
 func (s *DBTestSuite) TestUpdateCounter() {
 	query := "^insert into metrics (.+)"
 
-	s.mock.ExpectExec(query).WithArgs("test", 1234).WillReturnResult(sqlmock.NewResult(1, 1))
-	s.mock.ExpectExec(query).WithArgs("fail", 1234).WillReturnError(fmt.Errorf("DB error"))
+	s.mock.ExpectExec(query).WithArgs("test", 1234, sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(query).WithArgs("fail", 1234, sqlmock.AnyArg(), "").WillReturnError(fmt.Errorf("DB error"))
 	s.NoError(s.repo.UpdateCounter(context.Background(), "test", 1234))
 	s.Error(s.repo.UpdateCounter(context.Background(), "fail", 1234))
 }
 
+func (s *DBTestSuite) TestUpdateMetrics() {
+	query := "^insert into metrics (.+)"
+	v, d := 1.5, int64(2)
+	metrics := []model.Metric{{ID: "g", MType: "gauge", Value: &v}, {ID: "c", MType: "counter", Delta: &d}}
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(query).WithArgs("g", 1.5, sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(query).WithArgs("c", 2, sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit()
+	s.NoError(s.repo.UpdateMetrics(context.Background(), metrics))
+
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(query).WithArgs("g", 1.5, sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(query).WithArgs("c", 2, sqlmock.AnyArg(), "").WillReturnError(fmt.Errorf("DB error"))
+	s.mock.ExpectRollback()
+	s.Error(s.repo.UpdateMetrics(context.Background(), metrics))
+
+	// invalid metric fails before transaction
+	s.Error(s.repo.UpdateMetrics(context.Background(), append(metrics, model.Metric{ID: "x", MType: "gauge"})))
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+func (s *DBTestSuite) TestDelete() {
+	query := "^DELETE FROM metrics WHERE (.+)"
+
+	s.mock.ExpectExec(query).WithArgs("gauge", "test").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(query).WithArgs("counter", "missing").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(query).WithArgs("counter", "fail").WillReturnError(fmt.Errorf("DB error"))
+	s.NoError(s.repo.DeleteGauge(context.Background(), "test"))
+	s.ErrorIs(s.repo.DeleteCounter(context.Background(), "missing"), repo.ErrNotFound)
+	s.Error(s.repo.DeleteCounter(context.Background(), "fail"))
+}
+
+func (s *DBTestSuite) TestResetCounter() {
+	query := "^UPDATE metrics SET delta = 0(.+)"
+
+	s.mock.ExpectExec(query).WithArgs("test", sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(query).WithArgs("missing", sqlmock.AnyArg(), "").WillReturnResult(sqlmock.NewResult(0, 0))
+	s.NoError(s.repo.ResetCounter(context.Background(), "test"))
+	s.ErrorIs(s.repo.ResetCounter(context.Background(), "missing"), repo.ErrNotFound)
+}
+
+func (s *DBTestSuite) TestRename() {
+	ctx := context.Background()
+	selectFrom := "^SELECT id FROM metrics WHERE (.+) FOR UPDATE"
+	selectTo := "^SELECT mtype FROM metrics WHERE (.+) FOR UPDATE"
+
+	// merge of counters
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(selectFrom).WithArgs("counter", "old").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("old"))
+	s.mock.ExpectQuery(selectTo).WithArgs("new").WillReturnRows(sqlmock.NewRows([]string{"mtype"}).AddRow("counter"))
+	s.mock.ExpectExec("^UPDATE metrics SET delta = delta (.+)").WithArgs("old", "new").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec("^DELETE FROM metrics WHERE id = (.+)").WithArgs("new").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec("^UPDATE metrics SET id = (.+)").WithArgs("old", "new").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	s.NoError(s.repo.Rename(ctx, "counter", "old", "new", true))
+
+	// existing target without merge
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(selectFrom).WithArgs("gauge", "old").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("old"))
+	s.mock.ExpectQuery(selectTo).WithArgs("new").WillReturnRows(sqlmock.NewRows([]string{"mtype"}).AddRow("gauge"))
+	s.mock.ExpectRollback()
+	s.ErrorIs(s.repo.Rename(ctx, "gauge", "old", "new", false), repo.ErrExists)
+
+	// missing source
+	s.mock.ExpectBegin()
+	s.mock.ExpectQuery(selectFrom).WithArgs("gauge", "missing").WillReturnError(sql.ErrNoRows)
+	s.mock.ExpectRollback()
+	s.ErrorIs(s.repo.Rename(ctx, "gauge", "missing", "new", false), repo.ErrNotFound)
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
 func (s *DBTestSuite) TestGetCounter() {
 	query := "^SELECT delta FROM metrics WHERE mtype = 'counter' (.+)"
 
@@ -92,6 +178,51 @@ func (s *DBTestSuite) TestGetGauge() {
 
 }
 
+func (s *DBTestSuite) TestUpdateSource() {
+	query := "^insert into metrics (.+)"
+	updated := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := model.WithSource(context.Background(), model.Source{Agent: "host1", Transport: model.TransportGRPC})
+	ctx = model.WithUpdated(ctx, updated)
+
+	s.mock.ExpectExec(query).WithArgs("test", 1.234, updated, "host1").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.NoError(s.repo.UpdateGauge(ctx, "test", 1.234))
+}
+
+func (s *DBTestSuite) TestGetMetadata() {
+	query := "^SELECT updated, source FROM metrics WHERE (.+)"
+	updated := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s.mock.ExpectQuery(query).WithArgs("gauge", "test").
+		WillReturnRows(sqlmock.NewRows([]string{"updated", "source"}).AddRow(updated, "host1"))
+	s.mock.ExpectQuery(query).WithArgs("gauge", "old").
+		WillReturnRows(sqlmock.NewRows([]string{"updated", "source"}).AddRow(nil, nil))
+	s.mock.ExpectQuery(query).WithArgs("counter", "fail").WillReturnError(fmt.Errorf("DB error"))
+
+	md, err := s.repo.GetMetadata(context.Background(), "gauge", "test")
+	s.NoError(err)
+	s.Equal(model.Metadata{Updated: updated, Source: "host1"}, md)
+
+	md, err = s.repo.GetMetadata(context.Background(), "gauge", "old")
+	s.NoError(err)
+	s.Equal(model.Metadata{}, md)
+
+	_, err = s.repo.GetMetadata(context.Background(), "counter", "fail")
+	s.Error(err)
+}
+
+func (s *DBTestSuite) TestGetMetadataAll() {
+	query := "^SELECT id, updated, source FROM metrics WHERE (.+)"
+	updated := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"id", "updated", "source"}).
+		AddRow("one", updated, "host1").
+		AddRow("two", nil, nil)
+	s.mock.ExpectQuery(query).WithArgs("counter").WillReturnRows(rows)
+	md, err := s.repo.GetMetadataAll(context.Background(), "counter")
+	s.NoError(err)
+	s.Equal(map[string]model.Metadata{"one": {Updated: updated, Source: "host1"}, "two": {}}, md)
+}
+
 func (s *DBTestSuite) TestGetGaugeAll() {
 	query := "^SELECT id, value FROM metrics WHERE mtype = 'gauge'"
 
@@ -0,0 +1,686 @@
+// Package agent implements the agent functionality for collecting and sending metrics
+// for observing machine.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/andrei-cloud/go-devops/internal/bulk"
+	"github.com/andrei-cloud/go-devops/internal/collector"
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/interceptors"
+	"github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	"github.com/andrei-cloud/go-devops/internal/relay"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+// Agent - agent collecting metrics and reporting them to the server, created with New.
+type Agent struct {
+	cfg            config.AgentConfig
+	baseURL        string
+	version        string // agent version reported to the server
+	commit         string // agent build commit reported to the server on registration
+	base           collector.Collector
+	client         *http.Client
+	gclient        pb.MetricsClient
+	gagents        pb.AgentsClient
+	gOpts          []grpc.DialOption
+	collector      collector.Collector
+	key            []byte
+	pollInterval   time.Duration
+	reportInterval time.Duration
+	isBulk         bool
+	pending        map[string]int64 // counters failed to report, sent with the next report
+	id             string           // agent ID reported to the server, host name
+	collectors     []string         // names of enabled collectors reported on registration
+	heartbeat      time.Duration    // interval between heartbeats
+	registered     bool             // server accepted registration
+	localPoll      time.Duration    // poll interval used without configuration profile
+	localReport    time.Duration    // report interval used without configuration profile
+	remote         *collector.Switch
+	updates        chan *profiles.Response // configuration profiles to apply, nil if none applies
+	mu             sync.Mutex
+	applied        string // version of applied configuration profile
+}
+
+// Option - configures agent created with New.
+type Option func(*Agent)
+
+// WithConfig - sets agent configuration, default configuration is used otherwise.
+func WithConfig(cfg config.AgentConfig) Option {
+	return func(a *Agent) {
+		a.cfg = cfg
+	}
+}
+
+// WithCollector - sets collector of system metrics, collector.NewCollector is used otherwise.
+func WithCollector(c collector.Collector) Option {
+	return func(a *Agent) {
+		a.base = c
+	}
+}
+
+// WithHTTPClient - sets HTTP client reporting metrics to the server.
+func WithHTTPClient(cl *http.Client) Option {
+	return func(a *Agent) {
+		a.client = cl
+	}
+}
+
+// WithBuild - sets agent version and build commit reported to the server.
+func WithBuild(version, commit string) Option {
+	return func(a *Agent) {
+		a.version = version
+		a.commit = commit
+	}
+}
+
+// New - creates new instance of the agent.
+func New(opts ...Option) (*Agent, error) {
+	var encr encrypt.Encrypter
+	a := &Agent{version: "N/A", commit: "N/A"}
+	if err := config.SetDefaults(&a.cfg); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if err := a.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if a.client == nil {
+		a.client = &http.Client{}
+	}
+	if a.base == nil {
+		a.base = collector.NewCollector()
+	}
+	a.baseURL = fmt.Sprintf("http://%s/update", a.cfg.Address)
+	a.pollInterval = a.cfg.PollInt
+	a.reportInterval = a.cfg.ReportInt
+	a.heartbeat = a.cfg.HeartbeatInt.Duration
+	a.isBulk = a.cfg.IsBulk
+	a.pending = make(map[string]int64)
+	a.updates = make(chan *profiles.Response)
+	if host, err := os.Hostname(); err == nil {
+		a.id = host
+	} else {
+		log.Error().AnErr("Hostname", err).Msg("New")
+	}
+	group := collector.NewGroup(a.base)
+	a.collectors = []string{"system"}
+	if a.cfg.RuntimeMetrics {
+		group.Add(collector.NewRuntimeCollector())
+		a.collectors = append(a.collectors, "runtime")
+	}
+	if a.cfg.Cgroup != "" {
+		if c := newCgroupCollector(a.cfg.Cgroup); c != nil {
+			group.Add(c)
+			a.collectors = append(a.collectors, "cgroup")
+		}
+	}
+	if len(a.cfg.Exec) > 0 {
+		group.Add(collector.NewExecCollector(a.cfg.Exec))
+		a.collectors = append(a.collectors, "exec")
+	}
+	if a.cfg.StatsdAddress != "" || a.cfg.StatsdSocket != "" {
+		group.Add(collector.NewStatsdCollector(a.cfg.StatsdAddress, a.cfg.StatsdSocket))
+		a.collectors = append(a.collectors, "statsd")
+	}
+	if len(a.cfg.Scrape) > 0 {
+		group.Add(collector.NewScrapeCollector(a.cfg.Scrape))
+		a.collectors = append(a.collectors, "scrape")
+	}
+	if a.cfg.PushAddress != "" {
+		group.Add(collector.NewPushCollector(a.cfg.PushAddress, hostLabels(a.cfg.Labels)))
+		a.collectors = append(a.collectors, "push")
+	}
+	if a.cfg.RelayAddress != "" {
+		// relayed counters are buffered until upstream accepts them,
+		// which is possible for bulk reports only
+		r, err := relay.New(a.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relay crypto key: %w", err)
+		}
+		group.Add(r)
+		a.isBulk = true
+		a.collectors = append(a.collectors, "relay")
+	}
+	// collectors of configuration profile
+	a.remote = collector.NewSwitch()
+	group.Add(a.remote)
+	a.collector = group
+	if a.cfg.Key != "" {
+		a.key = []byte(a.cfg.Key)
+	}
+	if a.cfg.CryptoKey != "" {
+		e, err := encrypt.Load(a.cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crypto key: %w", err)
+		}
+		encr = e
+		a = a.WithEncrypter(encr)
+	}
+	if a.cfg.Grpc {
+		callOpts := []grpc.CallOption{}
+		if a.cfg.CryptoKey != "" {
+			callOpts = append(callOpts, grpc.ForceCodec(encrypt.Encodec{Enc: encr}))
+		}
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+		a.gOpts = append(a.gOpts, grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(callOpts...),
+			grpc.WithUnaryInterceptor(interceptors.Logging))
+	}
+
+	return a, nil
+}
+
+func newCgroupCollector(path string) collector.Collector {
+	if path == collector.CgroupSelf {
+		var err error
+		if path, err = collector.SelfCgroup("/proc/self/cgroup"); err != nil {
+			log.Error().AnErr("SelfCgroup", err).Msg("cgroup metrics disabled")
+			return nil
+		}
+	}
+	log.Debug().Str("cgroup", path).Msg("collecting cgroup metrics")
+	return collector.NewCgroupCollector(collector.CgroupRoot, path)
+}
+
+// hostLabels returns labels configured for pushed metrics together with host name.
+func hostLabels(configured map[string]string) map[string]string {
+	labels := map[string]string{}
+	if host, err := os.Hostname(); err == nil {
+		labels["host"] = host
+	} else {
+		log.Error().AnErr("Hostname", err).Msg("hostLabels")
+	}
+	for k, v := range configured {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (a *Agent) WithEncrypter(e encrypt.Encrypter) *Agent {
+	a.client.Transport = middlewares.NewCryptoRT(e)
+	return a
+}
+
+// Run main agent loop.
+func (a *Agent) Run(ctx context.Context) {
+	if a.cfg.Debug {
+		go func() {
+			log.Debug().Msg("profiler available on: localhost:6060")
+			log.Log().AnErr("pprof", http.ListenAndServe("localhost:6060", nil)).Msg("profiler")
+		}()
+	}
+
+	if a.cfg.Grpc {
+		conn, err := grpc.Dial(a.cfg.GrpcAddress, a.gOpts...)
+		if err != nil {
+			log.Error().AnErr("Dial", err).Msgf("unable to connect to gRPC server on %s", a.cfg.GrpcAddress)
+		}
+		defer conn.Close()
+
+		a.gclient = pb.NewMetricsClient(conn)
+		a.gagents = pb.NewAgentsClient(conn)
+	}
+
+	// hints of the server are applied before tickers are created
+	a.applyHints(a.register(ctx))
+	a.localPoll, a.localReport = a.pollInterval, a.reportInterval
+
+	wg := &sync.WaitGroup{}
+	log.Info().Msgf("Agent sending metrics to: %v", a.cfg.Address)
+
+	if runner, ok := a.collector.(collector.Runner); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runner.Run(ctx)
+		}()
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		a.runHeartbeat(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		a.watchConfig(ctx)
+	}()
+
+	// tickers are re-created every time configuration profile is applied
+	for {
+		lctx, cancel := context.WithCancel(ctx)
+		lwg := a.runTickers(lctx)
+		select {
+		case p := <-a.updates:
+			cancel()
+			lwg.Wait()
+			a.apply(p)
+			continue
+		case <-ctx.Done():
+			cancel()
+			lwg.Wait()
+		}
+		break
+	}
+
+	wg.Wait()
+	log.Info().Msg("Agent stopping")
+}
+
+// runTickers starts collecting and reporting on the current intervals until ctx is done.
+func (a *Agent) runTickers(ctx context.Context) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+
+	pollTicker := time.NewTicker(a.pollInterval)
+	pollExtraTicker := time.NewTicker(a.pollInterval)
+	reportTicker := time.NewTicker(a.reportInterval)
+
+	collector := func(lctx context.Context, ticker *time.Ticker) {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.collector.Collect()
+			case <-lctx.Done():
+				return
+			}
+		}
+	}
+
+	collectorExtra := func(lctx context.Context, ticker *time.Ticker) {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.collector.CollectExtra()
+			case <-lctx.Done():
+				return
+			}
+		}
+	}
+
+	reporter := func(lctx context.Context, ticker *time.Ticker) {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if a.gclient == nil {
+					if !a.isBulk {
+						a.ReportCounterPost(ctx, a.collector.GetCounter())
+						a.ReportGaugePost(ctx, a.collector.GetGauges())
+					} else {
+						counters := a.withPending(a.collector.GetCounter())
+						if err := a.ReportBulkPost(ctx, counters, a.collector.GetGauges()); err != nil {
+							a.pending = retained(counters, err)
+						}
+					}
+				} else {
+					if !a.isBulk {
+						a.ReportCounterGRPC(ctx, a.collector.GetCounter())
+						a.ReportGaugeGRPC(ctx, a.collector.GetGauges())
+					} else {
+						counters := a.withPending(a.collector.GetCounter())
+						if err := a.ReportBulkGRPC(ctx, counters, a.collector.GetGauges()); err != nil {
+							a.pending = retained(counters, err)
+						}
+					}
+				}
+			case <-lctx.Done():
+				return
+			}
+		}
+	}
+
+	wg.Add(3)
+	go collector(ctx, pollTicker)
+	go collectorExtra(ctx, pollExtraTicker)
+	go reporter(ctx, reportTicker)
+	return wg
+}
+
+// withPending adds counters failed to report previously to counters c.
+func (a *Agent) withPending(c map[string]int64) map[string]int64 {
+	for k, v := range a.pending {
+		c[k] += v
+	}
+	a.pending = make(map[string]int64)
+	return c
+}
+
+// rejectedError - batch rejected by the server because of its metrics,
+// sending it again is rejected the same way.
+type rejectedError struct {
+	reason string
+	keep   map[string]bool // counters not applied only because of other metrics of the batch
+}
+
+func (e *rejectedError) Error() string {
+	return "metrics rejected: " + e.reason
+}
+
+// newRejectedError returns error of batch rejected with reason,
+// keeping counters of results not applied because of other metrics.
+func newRejectedError(reason string, results []bulk.UpdateResult) *rejectedError {
+	e := &rejectedError{reason: reason, keep: make(map[string]bool)}
+	for _, r := range results {
+		if r.MType == "counter" && r.Error == bulk.ErrNotApplied.Error() {
+			e.keep[r.ID] = true
+		}
+	}
+	return e
+}
+
+// retained returns counters c to report again after report failed with err:
+// all of them after transport or server failure, after rejection of the batch
+// only those not applied because of other metrics, the rest are dropped.
+func retained(c map[string]int64, err error) map[string]int64 {
+	rejected, ok := err.(*rejectedError)
+	if !ok {
+		return c
+	}
+	kept := make(map[string]int64)
+	for k, v := range c {
+		if rejected.keep[k] {
+			kept[k] = v
+		}
+	}
+	if dropped := len(c) - len(kept); dropped > 0 {
+		log.Warn().Int("dropped", dropped).Str("reason", rejected.reason).Msg("Report")
+	}
+	return kept
+}
+
+// ReportCounter - reports counter metric to the sever.
+func (a *Agent) ReportCounter(ctx context.Context, m map[string]int64) {
+	var url string
+	for k, v := range m {
+		url = fmt.Sprintf("%s/counter/%s/%v", a.baseURL, k, v)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			log.Error().AnErr("NewRequestWithContext", err).Msg("ReportCounter")
+			continue
+		}
+
+		req.Header.Set("Content-Type", "text/plain")
+		a.identify(req)
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			log.Error().AnErr("SplitHostPort", err).Msg("ReportCounter")
+			return
+		} else {
+			req.Header.Set("X-Real-IP", ip)
+		}
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			log.Error().AnErr("Do", err).Msg("ReportCounter")
+			return
+		}
+		defer resp.Body.Close()
+		log.Debug().Int("code", resp.StatusCode).Msg("ReportCounter")
+	}
+}
+
+// ReportGauge - reports gauge metric to the sever.
+func (a *Agent) ReportGauge(ctx context.Context, m map[string]float64) {
+	var url string
+	for k, v := range m {
+		url = fmt.Sprintf("%s/gauge/%s/%v", a.baseURL, k, v)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			log.Error().AnErr("NewRequestWithContext", err).Msg("ReportGauge")
+			continue
+		}
+
+		req.Header.Set("Content-Type", "text/plain")
+		a.identify(req)
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			log.Error().AnErr("SplitHostPort", err).Msg("ReportGauge")
+			return
+		} else {
+			req.Header.Set("X-Real-IP", ip)
+		}
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			log.Error().AnErr("Do", err).Msg("ReportGauge")
+			return
+		}
+		defer resp.Body.Close()
+		log.Debug().Int("code", resp.StatusCode).Msg("ReportGauge")
+	}
+}
+
+// ReportCounterPost - reports counter metric to the sever.
+func (a *Agent) ReportCounterPost(ctx context.Context, m map[string]int64) {
+	var url string
+	metric := model.Metric{}
+	buf := bytes.NewBuffer([]byte{})
+	for k, v := range m {
+		url = fmt.Sprintf("%s/", a.baseURL)
+
+		metric.ID = k
+		metric.MType = "counter"
+		metric.Delta = &v
+
+		if len(a.key) != 0 {
+			metric.Hash = hash.Create(fmt.Sprintf("%s:counter:%d", metric.ID, *metric.Delta), a.key)
+		}
+
+		if err := json.NewEncoder(buf).Encode(metric); err != nil {
+			log.Error().AnErr("Encode", err).Msg("ReportCounterPost")
+			return
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buf)
+		if err != nil {
+			log.Error().AnErr("NewRequestWithContext", err).Msg("ReportCounterPost")
+			continue
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		a.identify(req)
+
+		ipAddr := getLocalIP()
+		log.Debug().Msgf("Real IP: %v", ipAddr)
+		req.Header.Set("X-Real-IP", ipAddr)
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			log.Error().AnErr("Do", err).Msg("ReportCounterPost")
+			return
+		}
+		defer resp.Body.Close()
+		log.Debug().Int("code", resp.StatusCode).Msg("ReportCounterPost")
+	}
+}
+
+// ReportGaugePost - reports gauge metric to the sever.
+func (a *Agent) ReportGaugePost(ctx context.Context, m map[string]float64) {
+	var url string
+	metric := model.Metric{}
+	buf := bytes.NewBuffer([]byte{})
+	for k, v := range m {
+		url = fmt.Sprintf("%s/", a.baseURL)
+
+		metric.ID = k
+		metric.MType = "gauge"
+		metric.Value = &v
+
+		if len(a.key) != 0 {
+			metric.Hash = hash.Create(fmt.Sprintf("%s:gauge:%f", metric.ID, *metric.Value), a.key)
+		}
+
+		if err := json.NewEncoder(buf).Encode(metric); err != nil {
+			log.Error().AnErr("Encode", err).Msg("ReportGaugePost")
+			return
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buf)
+		if err != nil {
+			log.Error().AnErr("NewRequestWithContext", err).Msg("ReportGaugePost")
+			continue
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		a.identify(req)
+
+		ipAddr := getLocalIP()
+		log.Debug().Msgf("Real IP: %v", ipAddr)
+		req.Header.Set("X-Real-IP", ipAddr)
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			log.Error().AnErr("Do", err).Msg("ReportGaugePost")
+			return
+		}
+		defer resp.Body.Close()
+		log.Debug().Int("code", resp.StatusCode).Msg("ReportGaugePost")
+	}
+}
+
+// ReportBulkPost - reports metrics in bulk to the sever.
+// returns error if metrics are not accepted. Batch is applied atomically,
+// so counters kept pending after error are not counted twice,
+// *rejectedError is returned if the server rejected the batch.
+func (a *Agent) ReportBulkPost(ctx context.Context, c map[string]int64, g map[string]float64) error {
+	var url string
+	metrics := []model.Metric{}
+	buf := bytes.NewBuffer([]byte{})
+	url = fmt.Sprintf("%ss/?atomic=true", a.baseURL)
+	for k, v := range g {
+		metric := model.Metric{}
+
+		locV := v
+		metric.ID = k
+		metric.MType = "gauge"
+		metric.Value = &locV
+
+		if len(a.key) != 0 {
+			metric.Hash = hash.Create(fmt.Sprintf("%s:gauge:%f", metric.ID, *metric.Value), a.key)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	for k, v := range c {
+		metric := model.Metric{}
+
+		locC := v
+		metric.ID = k
+		metric.MType = "counter"
+		metric.Delta = &locC
+
+		if len(a.key) != 0 {
+			metric.Hash = hash.Create(fmt.Sprintf("%s:counter:%d", metric.ID, *metric.Delta), a.key)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if len(metrics) > 0 {
+		if err := json.NewEncoder(buf).Encode(metrics); err != nil {
+			log.Error().AnErr("Encode", err).Msg("ReportBulkPost")
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buf)
+		if err != nil {
+			log.Error().AnErr("NewRequestWithContext", err).Msg("ReportBulkPost")
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		a.identify(req)
+
+		ipAddr := getLocalIP()
+		log.Debug().Msgf("Real IP: %v", ipAddr)
+		req.Header.Set("X-Real-IP", ipAddr)
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			log.Error().AnErr("Do", err).Msg("ReportBulkPost")
+			return err
+		}
+		defer resp.Body.Close()
+		log.Debug().Int("code", resp.StatusCode).Msg("ReportBulkPost")
+		switch {
+		case resp.StatusCode == http.StatusOK:
+		case resp.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		default:
+			// report is missing if the request itself is rejected
+			var report bulk.Report
+			if resp.Header.Get("Content-Type") == "application/json" {
+				if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+					log.Error().AnErr("Decode", err).Msg("ReportBulkPost")
+				}
+			}
+			return newRejectedError(fmt.Sprintf("status code %d", resp.StatusCode), report.Results)
+		}
+	}
+	return nil
+}
+
+// identify sets headers identifying the agent to the server.
+func (a *Agent) identify(req *http.Request) {
+	if a.id != "" {
+		req.Header.Set(middlewares.HeaderAgentID, a.id)
+	}
+	req.Header.Set(middlewares.HeaderAgentVersion, a.version)
+}
+
+// identityMD returns gRPC metadata identifying the agent to the server.
+func (a *Agent) identityMD(ipAddr string) metadata.MD {
+	md := metadata.New(map[string]string{
+		"X-Real-IP":                       ipAddr,
+		interceptors.MetadataAgentVersion: a.version,
+	})
+	if a.id != "" {
+		md.Set(interceptors.MetadataAgentID, a.id)
+	}
+	return md
+}
+
+func getLocalIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, address := range addrs {
+		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			if ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+		}
+	}
+	return ""
+}
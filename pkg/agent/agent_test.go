@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go-devops/internal/bulk"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	repo := inmem.New()
+	ts := httptest.NewServer(router.SetupRouter(repo, []byte("server-key"), nil))
+	defer ts.Close()
+
+	newAgent := func(key string) *Agent {
+		cfg := config.AgentConfig{}
+		if err := config.SetDefaults(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Address = strings.TrimPrefix(ts.URL, "http://")
+		cfg.Key = key
+		a, err := New(WithConfig(cfg), WithBuild("1.0", "abc"))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return a
+	}
+
+	// agents of the same process are configured independently
+	valid, invalid := newAgent("server-key"), newAgent("other-key")
+	ctx := context.Background()
+	if err := valid.ReportBulkPost(ctx, map[string]int64{"PollCount": 2}, map[string]float64{"Alloc": 1.5}); err != nil {
+		t.Errorf("ReportBulkPost() error = %v", err)
+	}
+	if err := invalid.ReportBulkPost(ctx, map[string]int64{"PollCount": 5}, nil); err == nil {
+		t.Error("ReportBulkPost() with wrong key, error expected")
+	}
+
+	if v, err := repo.GetCounter(ctx, "PollCount"); err != nil || v != 2 {
+		t.Errorf("PollCount = %v, %v, want 2", v, err)
+	}
+	if v, err := repo.GetGauge(ctx, "Alloc"); err != nil || v != 1.5 {
+		t.Errorf("Alloc = %v, %v, want 1.5", v, err)
+	}
+}
+
+func TestRetained(t *testing.T) {
+	repo := inmem.New()
+	ts := httptest.NewServer(router.SetupRouter(repo, []byte("server-key"), nil))
+	defer ts.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "failed", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	newAgent := func(url, key string) *Agent {
+		cfg := config.AgentConfig{}
+		if err := config.SetDefaults(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Address = strings.TrimPrefix(url, "http://")
+		cfg.Key = key
+		a, err := New(WithConfig(cfg))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return a
+	}
+	ctx := context.Background()
+
+	// batch rejected for its metrics is not sent again
+	counters := map[string]int64{"PollCount": 5}
+	err := newAgent(ts.URL, "other-key").ReportBulkPost(ctx, counters, nil)
+	if kept := retained(counters, err); err == nil || len(kept) != 0 {
+		t.Errorf("retained() after rejection = %v, error = %v", kept, err)
+	}
+	// failure of the server is retried
+	err = newAgent(failing.URL, "").ReportBulkPost(ctx, counters, nil)
+	if kept := retained(counters, err); err == nil || kept["PollCount"] != 5 {
+		t.Errorf("retained() after server failure = %v, error = %v", kept, err)
+	}
+	// counters not applied because of other metrics are kept
+	err = newRejectedError("invalid metric", []bulk.UpdateResult{
+		{ID: "Invalid", MType: "counter", Error: "invalid metric: hash mismatch"},
+		{ID: "PollCount", MType: "counter", Error: bulk.ErrNotApplied.Error()},
+	})
+	kept := retained(map[string]int64{"Invalid": 1, "PollCount": 2}, err)
+	if len(kept) != 1 || kept["PollCount"] != 2 {
+		t.Errorf("retained() after partial rejection = %v", kept)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	if _, err := New(WithConfig(config.AgentConfig{Address: "localhost"})); err == nil {
+		t.Error("New() with invalid config, error expected")
+	}
+	cfg := config.AgentConfig{}
+	if err := config.SetDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.RelayAddress, cfg.RelayCryptoKey = "localhost:0", "/nonexistent/key.pem"
+	if _, err := New(WithConfig(cfg)); err == nil {
+		t.Error("New() with missing relay crypto key, error expected")
+	}
+}
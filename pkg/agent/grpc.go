@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/andrei-cloud/go-devops/internal/bulk"
 	"github.com/andrei-cloud/go-devops/internal/hash"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc/codes"
@@ -14,12 +15,11 @@ import (
 )
 
 // ReportCounterPost - reports counter metric to the sever.
-func (a *agent) ReportCounterGRPC(ctx context.Context, m map[string]int64) {
+func (a *Agent) ReportCounterGRPC(ctx context.Context, m map[string]int64) {
 	ipAddr := getLocalIP()
 	log.Debug().Msgf("Real IP: %v", ipAddr)
 
-	md := metadata.New(map[string]string{"X-Real-IP": ipAddr})
-	lctx := metadata.NewOutgoingContext(ctx, md)
+	lctx := metadata.NewOutgoingContext(ctx, a.identityMD(ipAddr))
 
 	for k, v := range m {
 		metric := pb.Metric{}
@@ -48,12 +48,11 @@ func (a *agent) ReportCounterGRPC(ctx context.Context, m map[string]int64) {
 	}
 }
 
-func (a *agent) ReportGaugeGRPC(ctx context.Context, m map[string]float64) {
+func (a *Agent) ReportGaugeGRPC(ctx context.Context, m map[string]float64) {
 	ipAddr := getLocalIP()
 	log.Debug().Msgf("Real IP: %v", ipAddr)
 
-	md := metadata.New(map[string]string{"X-Real-IP": ipAddr})
-	lctx := metadata.NewOutgoingContext(ctx, md)
+	lctx := metadata.NewOutgoingContext(ctx, a.identityMD(ipAddr))
 
 	for k, v := range m {
 		metric := pb.Metric{}
@@ -82,15 +81,17 @@ func (a *agent) ReportGaugeGRPC(ctx context.Context, m map[string]float64) {
 	}
 }
 
-// ReportBulkPost - reports metrics in bulk to the sever.
-func (a *agent) ReportBulkGRPC(ctx context.Context, c map[string]int64, g map[string]float64) {
-	var req pb.UpdMetricsRequest
+// ReportBulkGRPC - reports metrics in bulk to the sever.
+// returns error if metrics are not accepted. Batch is applied atomically,
+// so counters kept pending after error are not counted twice,
+// *rejectedError is returned if the server rejected the batch.
+func (a *Agent) ReportBulkGRPC(ctx context.Context, c map[string]int64, g map[string]float64) error {
+	req := pb.UpdMetricsRequest{Atomic: true}
 
 	ipAddr := getLocalIP()
 	log.Debug().Msgf("Real IP: %v", ipAddr)
 
-	md := metadata.New(map[string]string{"X-Real-IP": ipAddr})
-	lctx := metadata.NewOutgoingContext(ctx, md)
+	lctx := metadata.NewOutgoingContext(ctx, a.identityMD(ipAddr))
 
 	for k, v := range g {
 		metric := pb.Metric{}
@@ -121,7 +122,16 @@ func (a *agent) ReportBulkGRPC(ctx context.Context, c map[string]int64, g map[st
 	}
 
 	if len(req.Metrics) > 0 {
-		_, err := a.gclient.UpdateMetrics(lctx, &req)
+		resp, err := a.gclient.UpdateMetrics(lctx, &req)
+		if err == nil && resp.Error != "" {
+			log.Error().Int32("accepted", resp.Accepted).Int32("rejected", resp.Rejected).
+				Str("reason", resp.Error).Msg("UpdateMetrics")
+			results := make([]bulk.UpdateResult, 0, len(resp.Results))
+			for _, r := range resp.Results {
+				results = append(results, bulk.UpdateResult{ID: r.Id, MType: r.Type, Status: r.Status, Error: r.Error})
+			}
+			return newRejectedError(resp.Error, results)
+		}
 		if err != nil {
 			if e, ok := status.FromError(err); ok {
 				if e.Code() == codes.Internal {
@@ -132,6 +142,22 @@ func (a *agent) ReportBulkGRPC(ctx context.Context, c map[string]int64, g map[st
 			} else {
 				log.Error().Msgf("Unable to parse error %v", err)
 			}
+			if rejectedCode(status.Code(err)) {
+				return newRejectedError(status.Convert(err).Message(), nil)
+			}
+			return err
 		}
 	}
+	return nil
+}
+
+// rejectedCode reports whether request failed with code c is rejected
+// the same way when sent again.
+func rejectedCode(c codes.Code) bool {
+	switch c {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.PermissionDenied,
+		codes.Unauthenticated, codes.Unimplemented:
+		return true
+	}
+	return false
 }
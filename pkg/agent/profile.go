@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/andrei-cloud/go-devops/internal/collector"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+)
+
+// watchConfig receives configuration profiles of the agent until ctx is done,
+// over gRPC stream or by requesting server every config interval.
+func (a *Agent) watchConfig(ctx context.Context) {
+	if a.id == "" || a.cfg.ConfigInt.Duration <= 0 {
+		return
+	}
+	var last *profiles.Response
+	received := func(p *profiles.Response) {
+		if sameProfile(last, p) {
+			return
+		}
+		last = p
+		select {
+		case a.updates <- p:
+		case <-ctx.Done():
+		}
+	}
+
+	ticker := time.NewTicker(a.cfg.ConfigInt.Duration)
+	defer ticker.Stop()
+	for {
+		var err error
+		if a.gagents != nil {
+			err = a.streamConfig(ctx, received)
+		} else {
+			var p *profiles.Response
+			if p, err = a.fetchConfig(ctx); err == nil {
+				received(p)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Error().AnErr("Config", err).Msg("watchConfig")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fetchConfig requests configuration profile over HTTP, nil if no profile applies.
+func (a *Agent) fetchConfig(ctx context.Context) (*profiles.Response, error) {
+	var resp profiles.Response
+	found, err := a.postAgentsFound(ctx, "config", a.configRequest(), &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// streamConfig receives configuration profiles over gRPC stream until it fails.
+func (a *Agent) streamConfig(ctx context.Context, received func(*profiles.Response)) error {
+	req := a.configRequest()
+	lctx := metadata.NewOutgoingContext(ctx, a.identityMD(getLocalIP()))
+	stream, err := a.gagents.WatchConfig(lctx, &pb.ConfigRequest{
+		Id:       req.ID,
+		Hostname: req.Hostname,
+		Labels:   req.Labels,
+		Applied:  req.Applied,
+		Hash:     req.Hash,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		p, ok, err := rpc.ConfigFromProto(resp)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			received(nil)
+			continue
+		}
+		received(&p)
+	}
+}
+
+func (a *Agent) configRequest() profiles.Request {
+	req := profiles.Request{
+		ID:       a.id,
+		Hostname: a.id,
+		Labels:   a.cfg.Labels,
+		Applied:  a.appliedVersion(),
+	}
+	if len(a.key) != 0 {
+		req.Hash = registry.Sign(a.id, registry.ActionConfig, a.key)
+	}
+	return req
+}
+
+// apply applies configuration profile p, nil restores local settings.
+// must not be called while tickers are running.
+func (a *Agent) apply(p *profiles.Response) {
+	a.pollInterval, a.reportInterval = a.localPoll, a.localReport
+	version := ""
+	if p == nil {
+		a.remote.Set(nil)
+		log.Info().Msg("configuration profile removed, local settings restored")
+	} else {
+		if d := p.Settings.PollInterval.Duration; d > 0 {
+			a.pollInterval = d
+		}
+		if d := p.Settings.ReportInterval.Duration; d > 0 {
+			a.reportInterval = d
+		}
+		a.remote.Set(a.remoteCollectors(p))
+		version = p.Version
+		log.Info().Str("profile", p.Profile).Str("version", p.Version).
+			Dur("poll", a.pollInterval).Dur("report", a.reportInterval).Msg("configuration profile applied")
+	}
+
+	a.mu.Lock()
+	a.applied = version
+	a.mu.Unlock()
+}
+
+// remoteCollectors returns collectors enabled by profile p, nil if none.
+func (a *Agent) remoteCollectors(p *profiles.Response) collector.Collector {
+	group := collector.NewGroup()
+	empty := true
+	if p.Settings.RuntimeMetrics && !a.cfg.RuntimeMetrics {
+		group.Add(collector.NewRuntimeCollector())
+		empty = false
+	}
+	if len(p.Settings.Exec) > 0 {
+		group.Add(collector.NewExecCollector(p.Settings.Exec))
+		empty = false
+	}
+	if len(p.Settings.Scrape) > 0 {
+		group.Add(collector.NewScrapeCollector(p.Settings.Scrape))
+		empty = false
+	}
+	if empty {
+		return nil
+	}
+	return group
+}
+
+// appliedVersion returns version of applied configuration profile, empty if none.
+func (a *Agent) appliedVersion() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.applied
+}
+
+func sameProfile(a, b *profiles.Response) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Profile == b.Profile && a.Version == b.Version
+}
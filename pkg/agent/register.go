@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// register registers the agent on the server, returns settings suggested by the server.
+func (a *Agent) register(ctx context.Context) config.AgentHints {
+	if a.id == "" {
+		return config.AgentHints{}
+	}
+	resp, err := a.sendRegistration(ctx)
+	if err != nil {
+		log.Error().AnErr("sendRegistration", err).Msg("register")
+		a.registered = false
+		return config.AgentHints{}
+	}
+	a.registered = true
+	if resp.Status == registry.StatusUnknown {
+		log.Warn().Str("id", a.id).Msg("agent is not in allow-list of the server")
+	}
+	log.Info().Str("status", resp.Status).Msg("agent registered")
+	return resp.Hints
+}
+
+// applyHints applies non-zero intervals suggested by the server.
+func (a *Agent) applyHints(h config.AgentHints) {
+	if d := h.PollInterval.Duration; d > 0 {
+		a.pollInterval = d
+	}
+	if d := h.ReportInterval.Duration; d > 0 {
+		a.reportInterval = d
+	}
+	if d := h.HeartbeatInterval.Duration; d > 0 {
+		a.heartbeat = d
+	}
+}
+
+// runHeartbeat sends heartbeats every heartbeat interval until ctx is done,
+// the agent registers again if it is not registered on the server.
+func (a *Agent) runHeartbeat(ctx context.Context) {
+	if a.id == "" || a.heartbeat <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !a.registered {
+				a.register(ctx)
+				continue
+			}
+			resp, err := a.sendHeartbeat(ctx)
+			if err != nil {
+				log.Error().AnErr("sendHeartbeat", err).Msg("runHeartbeat")
+				continue
+			}
+			if resp.Status == registry.StatusUnregistered {
+				a.register(ctx)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *Agent) sendRegistration(ctx context.Context) (registry.RegistrationResponse, error) {
+	var resp registry.RegistrationResponse
+	reg := registry.Registration{
+		ID:         a.id,
+		Hostname:   a.id,
+		Version:    a.version,
+		Commit:     a.commit,
+		Collectors: a.collectors,
+	}
+	if len(a.key) != 0 {
+		reg.Hash = registry.Sign(a.id, registry.ActionRegister, a.key)
+	}
+
+	if a.gagents != nil {
+		lctx := metadata.NewOutgoingContext(ctx, a.identityMD(getLocalIP()))
+		r, err := a.gagents.Register(lctx, &pb.RegisterRequest{
+			Id:         reg.ID,
+			Hostname:   reg.Hostname,
+			Version:    reg.Version,
+			Commit:     reg.Commit,
+			Collectors: reg.Collectors,
+			Hash:       reg.Hash,
+		})
+		if err != nil {
+			return resp, err
+		}
+		resp.Status = r.Status
+		resp.Hints = rpc.HintsFromProto(r.Hints)
+		return resp, nil
+	}
+
+	err := a.postAgents(ctx, "register", reg, &resp)
+	return resp, err
+}
+
+func (a *Agent) sendHeartbeat(ctx context.Context) (registry.HeartbeatResponse, error) {
+	var resp registry.HeartbeatResponse
+	hb := registry.Heartbeat{ID: a.id, ConfigVersion: a.appliedVersion()}
+	if len(a.key) != 0 {
+		hb.Hash = registry.Sign(a.id, registry.ActionHeartbeat, a.key)
+	}
+
+	if a.gagents != nil {
+		lctx := metadata.NewOutgoingContext(ctx, a.identityMD(getLocalIP()))
+		r, err := a.gagents.Heartbeat(lctx, &pb.HeartbeatRequest{Id: hb.ID, Hash: hb.Hash, ConfigVersion: hb.ConfigVersion})
+		if err != nil {
+			return resp, err
+		}
+		resp.Status = r.Status
+		return resp, nil
+	}
+
+	err := a.postAgents(ctx, "heartbeat", hb, &resp)
+	return resp, err
+}
+
+// postAgents posts req to "/agents/{action}" of the server and decodes response into resp.
+func (a *Agent) postAgents(ctx context.Context, action string, req, resp interface{}) error {
+	found, err := a.postAgentsFound(ctx, action, req, resp)
+	if err == nil && !found {
+		err = fmt.Errorf("unexpected status code: %d", http.StatusNoContent)
+	}
+	return err
+}
+
+// postAgentsFound is postAgents reporting 204 No Content response as not found.
+func (a *Agent) postAgentsFound(ctx context.Context, action string, req, resp interface{}) (bool, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := json.NewEncoder(buf).Encode(req); err != nil {
+		return false, err
+	}
+
+	url := fmt.Sprintf("http://%s/agents/%s", a.cfg.Address, action)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, url, buf)
+	if err != nil {
+		return false, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	a.identify(r)
+	r.Header.Set("X-Real-IP", getLocalIP())
+
+	res, err := a.client.Do(r)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, json.NewDecoder(res.Body).Decode(resp)
+	case http.StatusNoContent:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,318 @@
+// Package client implements library reporting metrics of Go services directly to the
+// metrics server, without running separate agent.
+//
+// Metrics are registered in Client and sent in batches every flush interval
+// over HTTP ("/updates/" endpoint) or gRPC (UpdateMetrics method). Batches are
+// applied atomically, so counters of rejected batch are sent again with the next one:
+//
+//	c, err := client.New("localhost:8080", client.WithKey("secret"))
+//	requests := c.Counter("requests")
+//	c.Run(ctx)
+//	defer c.Shutdown(context.Background()) // flushes metrics collected since the last batch
+//	requests.Inc()
+//
+// Metric names may carry labels, "name;key=value", registration of malformed
+// name panics, like regexp.MustCompile, as such metric would break every batch.
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+// DefaultInterval - default interval between batches.
+const DefaultInterval = 10 * time.Second
+
+// Client - registry of metrics reporting them to the metrics server.
+type Client struct {
+	address  string
+	grpc     bool
+	key      []byte
+	id       string
+	labels   map[string]string
+	interval time.Duration
+	encr     encrypt.Encrypter
+	keyPath  string
+	http     *http.Client
+	dialOpts []grpc.DialOption
+
+	sender sender
+
+	mu         sync.Mutex
+	counters   map[string]*Counter
+	gauges     map[string]*Gauge
+	histograms map[string]*Histogram
+	pending    map[string]int64 // counter deltas failed to send, sent with the next batch
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Option - configures client created with New.
+type Option func(*Client)
+
+// WithGRPC - sends metrics over gRPC instead of HTTP, address of New is gRPC address.
+func WithGRPC() Option {
+	return func(c *Client) {
+		c.grpc = true
+	}
+}
+
+// WithKey - signs metrics with HMAC key of the server.
+func WithKey(key string) Option {
+	return func(c *Client) {
+		c.key = []byte(key)
+	}
+}
+
+// WithEncrypter - encrypts requests with e, e.g. RSA public key of the server.
+func WithEncrypter(e encrypt.Encrypter) Option {
+	return func(c *Client) {
+		c.encr = e
+	}
+}
+
+// WithPublicKey - encrypts requests with RSA public key read from PEM file at path.
+func WithPublicKey(path string) Option {
+	return func(c *Client) {
+		c.keyPath = path
+	}
+}
+
+// WithInterval - sets interval between batches, DefaultInterval is used otherwise.
+func WithInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.interval = d
+	}
+}
+
+// WithLabels - adds labels to every reported metric.
+func WithLabels(labels map[string]string) Option {
+	return func(c *Client) {
+		c.labels = labels
+	}
+}
+
+// WithID - identifies client to the server as source of updates, like agent ID.
+func WithID(id string) Option {
+	return func(c *Client) {
+		c.id = id
+	}
+}
+
+// WithHTTPClient - sets HTTP client sending metrics, its transport is replaced if requests are encrypted.
+func WithHTTPClient(cl *http.Client) Option {
+	return func(c *Client) {
+		c.http = cl
+	}
+}
+
+// WithDialOptions - adds gRPC dial options, e.g. transport credentials.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// New - creates client reporting metrics to the server at address, host:port.
+func New(address string, opts ...Option) (*Client, error) {
+	c := &Client{
+		address:    address,
+		interval:   DefaultInterval,
+		counters:   make(map[string]*Counter),
+		gauges:     make(map[string]*Gauge),
+		histograms: make(map[string]*Histogram),
+		pending:    make(map[string]int64),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.interval <= 0 {
+		return nil, fmt.Errorf("invalid interval: %v", c.interval)
+	}
+	if c.keyPath != "" {
+		e, err := encrypt.Load(c.keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		c.encr = e
+	}
+
+	var err error
+	if c.grpc {
+		c.sender, err = newGRPCSender(c)
+	} else {
+		c.sender = newHTTPSender(c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Counter - returns counter name, registering it on first call.
+// Panics if name is not a valid metric ID, e.g. with malformed labels.
+func (c *Client) Counter(name string) *Counter {
+	mustValidName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.counters[name]
+	if !ok {
+		m = &Counter{}
+		c.counters[name] = m
+	}
+	return m
+}
+
+// Gauge - returns gauge name, registering it on first call.
+// Gauge is reported after its value is set.
+// Panics if name is not a valid metric ID, e.g. with malformed labels.
+func (c *Client) Gauge(name string) *Gauge {
+	mustValidName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.gauges[name]
+	if !ok {
+		m = &Gauge{}
+		c.gauges[name] = m
+	}
+	return m
+}
+
+// Histogram - returns histogram name with bucket boundaries bounds, registering it on first call.
+// Bounds of already registered histogram are not changed.
+// Panics if name is not a valid metric ID, e.g. with malformed labels.
+func (c *Client) Histogram(name string, bounds []float64) *Histogram {
+	mustValidName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.histograms[name]
+	if !ok {
+		m = newHistogram(bounds)
+		c.histograms[name] = m
+	}
+	return m
+}
+
+// mustValidName panics if name is empty or can not be parsed as series ID,
+// such metric would be rejected with every batch.
+func mustValidName(name string) {
+	if name == "" {
+		panic("client: empty metric name")
+	}
+	if _, _, err := model.ParseSeriesID(name); err != nil {
+		panic(fmt.Sprintf("client: invalid metric name: %v", err))
+	}
+}
+
+// Run - non blocking function sending batches every interval until ctx is done or Shutdown is called.
+func (c *Client) Run(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Flush(ctx); err != nil {
+					log.Error().AnErr("Flush", err).Msg("Client")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown - stops sending batches, flushes metrics collected since the last batch and closes connection.
+// Metrics are not flushed if ctx is done before they are sent.
+func (c *Client) Shutdown(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
+	}
+	err := c.Flush(ctx)
+	if cerr := c.sender.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Flush - sends metrics collected since the last batch,
+// counter deltas are sent again with the next batch if sending fails.
+func (c *Client) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	counters := c.pending
+	c.pending = make(map[string]int64)
+	for name, m := range c.counters {
+		if d := m.take(); d != 0 {
+			counters[name] += d
+		}
+	}
+	gauges := make(map[string]float64)
+	for name, m := range c.gauges {
+		if v, ok := m.value(); ok {
+			gauges[name] = v
+		}
+	}
+	for name, m := range c.histograms {
+		for k, v := range m.gauges(name) {
+			gauges[k] = v
+		}
+	}
+	c.mu.Unlock()
+
+	metrics, err := c.batch(counters, gauges)
+	if err == nil && len(metrics) > 0 {
+		err = c.sender.send(ctx, metrics)
+	}
+	if err != nil {
+		c.mu.Lock()
+		for name, d := range counters {
+			c.pending[name] += d
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// batch builds metrics with labels and hashes.
+func (c *Client) batch(counters map[string]int64, gauges map[string]float64) ([]model.Metric, error) {
+	metrics := make([]model.Metric, 0, len(counters)+len(gauges))
+	for name, v := range counters {
+		id, err := model.WithLabels(name, c.labels)
+		if err != nil {
+			return nil, err
+		}
+		delta := v
+		m := model.Metric{ID: id, MType: "counter", Delta: &delta}
+		if len(c.key) != 0 {
+			m.Hash = hashOf(m, c.key)
+		}
+		metrics = append(metrics, m)
+	}
+	for name, v := range gauges {
+		id, err := model.WithLabels(name, c.labels)
+		if err != nil {
+			return nil, err
+		}
+		value := v
+		m := model.Metric{ID: id, MType: "gauge", Value: &value}
+		if len(c.key) != 0 {
+			m.Hash = hashOf(m, c.key)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
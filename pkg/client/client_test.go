@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+func TestClientHTTP(t *testing.T) {
+	repo := inmem.New()
+	up := true
+	h := router.SetupRouter(repo, []byte("key"), nil)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := New(strings.TrimPrefix(ts.URL, "http://"), WithKey("key"), WithLabels(map[string]string{"svc": "api"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	requests := c.Counter("requests")
+	requests.Add(2)
+	up = false
+	if err := c.Flush(ctx); err == nil {
+		t.Fatal("Flush() to unavailable server, error expected")
+	}
+
+	// counter failed to send is sent with the next batch
+	up = true
+	requests.Inc()
+	c.Gauge("queue").Set(7)
+	latency := c.Histogram("latency", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	c.Gauge("unset")
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if v, err := repo.GetCounter(ctx, "requests;svc=api"); err != nil || v != 3 {
+		t.Errorf("requests = %v, %v, want 3", v, err)
+	}
+	gauges, err := repo.GetGaugeAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"queue;svc=api": 7, "latency_count;svc=api": 2, "latency_sum;svc=api": 0.55, "latency_p50;svc=api": 0.1}
+	for k, v := range want {
+		if gauges[k] != v {
+			t.Errorf("%s = %v, want %v", k, gauges[k], v)
+		}
+	}
+	if _, ok := gauges["unset;svc=api"]; ok {
+		t.Error("gauge without value is reported")
+	}
+}
+
+func TestClientGRPC(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath := filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem")
+	writePEM(t, privPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv))
+	writePEM(t, pubPath, "PUBLIC KEY", pub)
+	decr, err := encrypt.Load(privPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := inmem.New()
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer(grpc.ForceServerCodec(encrypt.ServerCodec{Dec: decr}))
+	pb.RegisterMetricsServer(g, rpc.NewMetricsServer(repo, []byte("key")))
+	go g.Serve(lis)
+	defer g.Stop()
+
+	c, err := New("bufnet", WithGRPC(), WithKey("key"), WithPublicKey(pubPath), WithInterval(10*time.Millisecond),
+		WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	c.Run(ctx)
+	c.Counter("jobs").Add(5)
+	c.Gauge("temperature").Set(21.5)
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if v, err := repo.GetCounter(ctx, "jobs"); err != nil || v != 5 {
+		t.Errorf("jobs = %v, %v, want 5", v, err)
+	}
+	if v, err := repo.GetGauge(ctx, "temperature"); err != nil || v != 21.5 {
+		t.Errorf("temperature = %v, %v, want 21.5", v, err)
+	}
+
+	// messages of clients without public key are rejected
+	plain, err := New("bufnet", WithGRPC(), WithKey("key"), WithInterval(10*time.Millisecond),
+		WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Run(ctx)
+	plain.Counter("jobs").Add(1)
+	if err := plain.Shutdown(ctx); err == nil {
+		t.Error("Shutdown() of client without public key, error expected")
+	}
+	if v, err := repo.GetCounter(ctx, "jobs"); err != nil || v != 5 {
+		t.Errorf("jobs = %v, %v, want 5", v, err)
+	}
+}
+
+func writePEM(t *testing.T, path, typ string, b []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidName(t *testing.T) {
+	c, err := New("localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Counter("jobs;queue=default").Add(1)
+
+	for _, name := range []string{"", "a;b", "a;b="} {
+		for kind, register := range map[string]func(){
+			"counter":   func() { c.Counter(name) },
+			"gauge":     func() { c.Gauge(name) },
+			"histogram": func() { c.Histogram(name, []float64{1}) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("%s %q registered, panic expected", kind, name)
+					}
+				}()
+				register()
+			}()
+		}
+	}
+
+	metrics, err := c.batch(map[string]int64{"jobs;queue=default": 1}, nil)
+	if err != nil || len(metrics) != 1 {
+		t.Errorf("batch() = %v, %v", metrics, err)
+	}
+}
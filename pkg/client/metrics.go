@@ -0,0 +1,98 @@
+package client
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andrei-cloud/go-devops/internal/model"
+)
+
+// Counter - monotonically increasing metric, reported as delta since the previous flush.
+type Counter struct {
+	delta int64
+}
+
+// Inc - increments counter by one.
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.delta, 1)
+}
+
+// Add - increments counter by d, negative d is ignored.
+func (c *Counter) Add(d int64) {
+	if d > 0 {
+		atomic.AddInt64(&c.delta, d)
+	}
+}
+
+// take returns delta accumulated since the previous call and resets it.
+func (c *Counter) take() int64 {
+	return atomic.SwapInt64(&c.delta, 0)
+}
+
+// Gauge - metric reporting the last set value.
+type Gauge struct {
+	bits uint64
+	set  uint32
+}
+
+// Set - sets gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+	atomic.StoreUint32(&g.set, 1)
+}
+
+// Add - adds d to gauge value.
+func (g *Gauge) Add(d float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(math.Float64frombits(old)+d)) {
+			atomic.StoreUint32(&g.set, 1)
+			return
+		}
+	}
+}
+
+// value returns gauge value and whether it was ever set.
+func (g *Gauge) value() (float64, bool) {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits)), atomic.LoadUint32(&g.set) == 1
+}
+
+// Histogram - distribution of observed values, reported as gauges
+// <name>_count, <name>_sum and quantile estimations <name>_pXX.
+type Histogram struct {
+	mu sync.Mutex
+	h  model.Histogram
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	b := append([]float64{math.Inf(-1)}, sorted...)
+	b = append(b, math.Inf(1))
+	return &Histogram{h: model.Histogram{Bounds: b, Counts: make([]uint64, len(b)-1)}}
+}
+
+// Observe - adds observation v to the distribution.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// bucket i covers [Bounds[i], Bounds[i+1])
+	i := sort.Search(len(h.h.Bounds), func(i int) bool { return h.h.Bounds[i] > v }) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(h.h.Counts) {
+		i = len(h.h.Counts) - 1
+	}
+	h.h.Counts[i]++
+	h.h.Sum += v
+}
+
+// gauges returns gauges flattening the distribution observed so far.
+func (h *Histogram) gauges(name string) map[string]float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.h.Gauges(name)
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/interceptors"
+	"github.com/andrei-cloud/go-devops/internal/middlewares"
+	"github.com/andrei-cloud/go-devops/internal/model"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+// sender - transport sending batch of metrics to the server.
+type sender interface {
+	send(ctx context.Context, metrics []model.Metric) error
+	close() error
+}
+
+// hashOf returns HMAC of metric m in the format verified by the server.
+func hashOf(m model.Metric, key []byte) string {
+	if m.MType == "counter" {
+		return hash.Create(fmt.Sprintf("%s:counter:%d", m.ID, *m.Delta), key)
+	}
+	return hash.Create(fmt.Sprintf("%s:gauge:%f", m.ID, *m.Value), key)
+}
+
+type httpSender struct {
+	client *http.Client
+	url    string
+	id     string
+}
+
+func newHTTPSender(c *Client) *httpSender {
+	cl := c.http
+	if cl == nil {
+		cl = &http.Client{}
+	}
+	if c.encr != nil {
+		cl.Transport = middlewares.NewCryptoRT(c.encr)
+	}
+	return &httpSender{client: cl, url: fmt.Sprintf("http://%s/updates/?atomic=true", c.address), id: c.id}
+}
+
+func (s *httpSender) send(ctx context.Context, metrics []model.Metric) error {
+	buf := bytes.NewBuffer([]byte{})
+	if err := json.NewEncoder(buf).Encode(metrics); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Real-IP", localIP())
+	if s.id != "" {
+		req.Header.Set(middlewares.HeaderAgentID, s.id)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSender) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+type grpcSender struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+	id     string
+}
+
+func newGRPCSender(c *Client) (*grpcSender, error) {
+	callOpts := []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+	if c.encr != nil {
+		callOpts = append(callOpts, grpc.ForceCodec(encrypt.Encodec{Enc: c.encr}))
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(callOpts...),
+	}, c.dialOpts...)
+
+	conn, err := grpc.Dial(c.address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcSender{conn: conn, client: pb.NewMetricsClient(conn), id: c.id}, nil
+}
+
+func (s *grpcSender) send(ctx context.Context, metrics []model.Metric) error {
+	req := pb.UpdMetricsRequest{Atomic: true}
+	for _, m := range metrics {
+		metric := &pb.Metric{Id: m.ID, Hash: m.Hash}
+		if m.MType == "counter" {
+			metric.Mtype = pb.Metric_COUNTER
+			metric.Delta = *m.Delta
+		} else {
+			metric.Mtype = pb.Metric_GAUGE
+			metric.Value = *m.Value
+		}
+		req.Metrics = append(req.Metrics, metric)
+	}
+
+	md := metadata.New(map[string]string{"X-Real-IP": localIP()})
+	if s.id != "" {
+		md.Set(interceptors.MetadataAgentID, s.id)
+	}
+	resp, err := s.client.UpdateMetrics(metadata.NewOutgoingContext(ctx, md), &req)
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("batch rejected: %s", resp.Error)
+	}
+	return nil
+}
+
+func (s *grpcSender) close() error {
+	return s.conn.Close()
+}
+
+// localIP returns the first non-loopback IPv4 address of the host, checked against trusted subnet.
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, address := range addrs {
+		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			if ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Config - type for agent configuration.
+// Settings are loaded by Loader from default, json, env and flag tags,
+// fields without flag or env tags are available in config file only.
+type AgentConfig struct {
+	// address of metric server
+	Address string `json:"address" env:"ADDRESS" flag:"a" default:"localhost:8080" usage:"server address format: host:port"`
+	// key for metrics hashing
+	Key string `json:"key" env:"KEY" flag:"k" secret:"true" usage:"secret key"`
+	// key for encryption of metrics
+	CryptoKey string `json:"crypto_key" env:"CRYPTO_KEY" flag:"crypto-key,cyptokey" usage:"path to public key file"`
+	// interval for metrics reporting
+	ReportInt time.Duration `json:"report_interval" env:"REPORT_INTERVAL" flag:"r" default:"10s" usage:"interval between reports"`
+	// interval for metrics polling
+	PollInt time.Duration `json:"poll_interval" env:"POLL_INTERVAL" flag:"p" default:"2s" usage:"interval between polls"`
+	// flag to send metrics in bulk
+	IsBulk bool `json:"bulk" flag:"b" usage:"bulk mode"`
+	// debug flag
+	Debug bool `json:"debug" flag:"debug" usage:"sets log level to debug"`
+	// enable grpc communication
+	Grpc bool `json:"grpc" env:"ENABLE_GRPC" flag:"grpc" usage:"enable grpc communication"`
+	// enable collector based on runtime/metrics
+	RuntimeMetrics bool `json:"runtime_metrics" env:"RUNTIME_METRICS" flag:"runtime" usage:"collect all metrics supported by runtime/metrics"`
+	// cgroup v2 path to collect container resources for, "self" for agent's own cgroup
+	Cgroup string `json:"cgroup" env:"CGROUP_PATH" flag:"cgroup" usage:"cgroup v2 path to collect container metrics, \"self\" for own cgroup"`
+	// commands executed periodically, available in config file only
+	Exec []ExecCommand `json:"exec"`
+	// UDP address of StatsD listener, e.g. ":8125"
+	StatsdAddress string `json:"statsd_address" env:"STATSD_ADDRESS" flag:"statsd" usage:"UDP address of StatsD listener, e.g. :8125"`
+	// unixgram socket path of StatsD listener
+	StatsdSocket string `json:"statsd_socket" env:"STATSD_SOCKET" flag:"statsd-socket" usage:"unixgram socket path of StatsD listener"`
+	// address of local push API for applications, e.g. "localhost:8081"
+	PushAddress string `json:"push_address" env:"PUSH_ADDRESS" flag:"push" usage:"address of local push API for applications, e.g. localhost:8081"`
+	// labels added to pushed metrics in addition to host, available in config file only
+	Labels map[string]string `json:"labels"`
+	// Prometheus endpoints to scrape, available in config file only
+	Scrape []ScrapeTarget `json:"scrape"`
+	// gRPC address of metrics server
+	GrpcAddress string `json:"grpc_address" env:"GRPC_ADDRESS" flag:"grpc-address" default:":9090" usage:"gRPC server address format: host:port"`
+	// HTTP address accepting metrics of downstream agents in relay mode, empty disables relay
+	RelayAddress string `json:"relay_address" env:"RELAY_ADDRESS" flag:"relay" usage:"HTTP address accepting metrics of downstream agents, enables relay mode"`
+	// gRPC address accepting metrics of downstream agents in relay mode
+	RelayGrpcAddress string `json:"relay_grpc_address" env:"RELAY_GRPC_ADDRESS" flag:"relay-grpc" usage:"gRPC address accepting metrics of downstream agents"`
+	// key validating hashes of downstream agents
+	RelayKey string `json:"relay_key" env:"RELAY_KEY" flag:"relay-key" secret:"true" usage:"secret key of downstream agents"`
+	// private key decrypting metrics of downstream agents
+	RelayCryptoKey string `json:"relay_crypto_key" env:"RELAY_CRYPTO_KEY" flag:"relay-cryptokey" usage:"path to private key file decrypting downstream agents metrics"`
+	// subnet of downstream agents in CIDR format
+	RelaySubnet string `json:"relay_trusted_subnet" env:"RELAY_TRUSTED_SUBNET" flag:"relay-subnet" usage:"trusted subnet of downstream agents in CIDR format"`
+	// interval between heartbeats sent to server after registration
+	HeartbeatInt Duration `json:"heartbeat_interval" env:"HEARTBEAT_INTERVAL" flag:"heartbeat" default:"30s" usage:"interval between heartbeats to the server"`
+	// interval between requests of configuration profile, also delay before gRPC stream is reopened
+	ConfigInt Duration `json:"config_interval" env:"CONFIG_INTERVAL" flag:"config-interval" default:"1m" usage:"interval between requests of configuration profile"`
+}
+
+// ScrapeTarget - type for Prometheus text format endpoint scraped by agent.
+type ScrapeTarget struct {
+	URL      string   `json:"url"`      // URL of metrics endpoint, e.g. http://localhost:9100/metrics
+	Interval Duration `json:"interval"` // interval between scrapes
+	Timeout  Duration `json:"timeout"`  // scrape request timeout
+	Include  []string `json:"include"`  // glob patterns of metric names to forward, all if empty
+	Exclude  []string `json:"exclude"`  // glob patterns of metric names to drop
+}
+
+// ExecCommand - type for command producing metrics on its standard output.
+type ExecCommand struct {
+	Name     string   `json:"name"`     // name used as prefix of status metrics
+	Command  string   `json:"command"`  // executable to run
+	Args     []string `json:"args"`     // command arguments
+	Interval Duration `json:"interval"` // interval between runs
+	Timeout  Duration `json:"timeout"`  // command is killed after timeout
+	Format   string   `json:"format"`   // output format: "json" or "line"
+}
+
+// Duration - time.Duration accepting both "10s" strings and nanoseconds in JSON.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON - implements json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		d.Duration = time.Duration(value)
+	case string:
+		var err error
+		if d.Duration, err = time.ParseDuration(value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid duration: %s", string(b))
+	}
+	return nil
+}
+
+// UnmarshalText - implements encoding.TextUnmarshaler interface for environment variables.
+func (d *Duration) UnmarshalText(b []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(b))
+	return err
+}
+
+// MarshalJSON - implements json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Config - type for server configuration.
+// Settings are loaded by Loader from default, json, env and flag tags,
+// fields without flag or env tags are available in config file only.
+type ServerConfig struct {
+	// address server to bind on
+	Address string `json:"address" env:"ADDRESS" flag:"a" default:"localhost:8080" usage:"server address format: host:port"`
+	// key used for hash verifications
+	Key string `json:"key" env:"KEY" flag:"k" secret:"true" usage:"secret key"`
+	// dadabase connection string
+	Dsn string `json:"database_dsn" env:"DATABASE_DSN" flag:"d" secret:"true" usage:"database connection string"`
+	// path to the file to store metrics
+	FilePath string `json:"store_file" env:"STORE_FILE" flag:"f" default:"/tmp/devops-metrics-db.json" usage:"file path to store metrics"`
+	// key for encryption of metrics
+	CryptoKey string `json:"crypto_key" env:"CRYPTO_KEY" flag:"crypto-key,cyptokey" usage:"path to private key file"`
+	// time to wait for server shutdown
+	Shutdown time.Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"5s"`
+	// interval store metrics in persistemnt repository
+	Interval time.Duration `json:"store_interval" env:"STORE_INTERVAL" flag:"i" default:"30s" usage:"interval to store metrics"`
+	// restore metrics from file upon server start
+	Restore bool `json:"restore" env:"RESTORE" flag:"r" default:"true" usage:"restore previous values"`
+	// debug mode enables additional logging and profile enpoints
+	Debug bool `json:"debug" flag:"debug" usage:"sets log level to debug"`
+	// trusted subnet for agent
+	Subnet string `json:"trusted_subnet" env:"TRUSTED_SUBNET" flag:"t" usage:"trusted subnet in CIDR format"`
+	// enable grpc communication
+	Grpc bool `json:"grpc" env:"ENABLE_GRPC" flag:"grpc" usage:"enable grpc communication"`
+	// address gRPC server binds on
+	GrpcAddress string `json:"grpc_address" env:"GRPC_ADDRESS" flag:"grpc-address" default:":9090" usage:"gRPC server address format: host:port"`
+	// log level: "debug", "info", "warn" or "error", Debug forces "debug"
+	LogLevel string `json:"log_level" env:"LOG_LEVEL"`
+	// TCP address of Graphite plaintext listener, e.g. ":2003", empty disables listener
+	GraphiteAddress string `json:"graphite_address" env:"GRAPHITE_ADDRESS" flag:"graphite" usage:"Graphite plaintext listener address format: host:port"`
+	// limit of lines per second accepted on single Graphite connection, 0 is unlimited
+	GraphiteRate float64 `json:"graphite_rate" env:"GRAPHITE_RATE" flag:"graphite-rate" usage:"lines per second limit of Graphite connection, 0 is unlimited"`
+	// rules mapping Graphite paths to metrics, available in config file only
+	GraphiteRules []GraphiteRule `json:"graphite_rules"`
+	// OpenTelemetry metrics ingestion settings, available in config file only
+	Otlp OtlpConfig `json:"otlp"`
+	// exporters forwarding every update to downstream storages, available in config file only
+	Exporters []ExporterConfig `json:"exporters"`
+	// default expiry of push groups, zero keeps groups until deleted
+	GroupTTL Duration `json:"group_ttl" env:"GROUP_TTL" flag:"group-ttl" usage:"default expiry of push groups, 0 disables expiry"`
+	// interval between sweeps of expired push groups
+	JanitorInterval Duration `json:"janitor_interval" env:"JANITOR_INTERVAL" flag:"janitor-interval" default:"1m" usage:"interval between sweeps of expired push groups"`
+	// IDs of agents allowed to register or addresses of agents allowed to report, any agent is allowed if empty
+	AllowedAgents []string `json:"allowed_agents" env:"ALLOWED_AGENTS"`
+	// reject registration of agents not in AllowedAgents instead of flagging them
+	RejectUnknown bool `json:"reject_unknown_agents" env:"REJECT_UNKNOWN_AGENTS" flag:"reject-unknown" usage:"reject agents not in allowed agents instead of flagging them"`
+	// settings suggested to agents on registration, available in config file only
+	AgentHints AgentHints `json:"agent_hints"`
+	// configuration profiles distributed to agents, available in config file only
+	AgentProfiles []AgentProfile `json:"agent_profiles"`
+	// time without reports after which agent is listed as stale
+	StaleAfter Duration `json:"stale_after" env:"STALE_AFTER" flag:"stale-after" default:"1m" usage:"time without reports after which agent is stale"`
+	// regional servers pulled with federation, available in config file only
+	Federate []FederateSource `json:"federate"`
+	// key signing admin requests, empty disables admin endpoints
+	AdminKey string `json:"admin_key" env:"ADMIN_KEY" flag:"admin-key" secret:"true" usage:"secret key of admin requests, empty disables admin endpoints"`
+	// file appended with audit records of admin actions, empty keeps records in memory only
+	AuditLog string `json:"audit_log" env:"AUDIT_LOG" flag:"audit-log" usage:"file path of admin actions audit log"`
+}
+
+// FederateSource - type for regional server pulled over "/federate" endpoint.
+// Pulled metrics are renamed with Prefix and labelled with Label set to Name,
+// label "source" is used if neither is set.
+type FederateSource struct {
+	Name     string            `json:"name"`              // source name, value of source label
+	URL      string            `json:"url"`               // base URL of regional server, e.g. "http://eu:8080"
+	Key      string            `json:"key" secret:"true"` // HMAC key of regional server
+	Interval Duration          `json:"interval"`          // interval between pulls
+	Timeout  Duration          `json:"timeout"`           // pull request timeout
+	Prefix   string            `json:"prefix"`            // prepended to pulled metric names
+	Label    string            `json:"label"`             // label holding source name
+	Match    []string          `json:"match"`             // metric name prefixes to pull, all if empty
+	Labels   map[string]string `json:"labels"`            // label values pulled metrics must have
+}
+
+// AgentHints - type for settings suggested to agents in registration response,
+// zero values are not suggested.
+type AgentHints struct {
+	ReportInterval    Duration `json:"report_interval"`
+	PollInterval      Duration `json:"poll_interval"`
+	HeartbeatInterval Duration `json:"heartbeat_interval"`
+}
+
+// AgentProfile - type for versioned agent configuration distributed by server.
+// Profile applies to agents which host name matches any of Hosts patterns and
+// which have all Labels, profile without Hosts and Labels applies to any agent.
+type AgentProfile struct {
+	Name     string            `json:"name"`     // profile name
+	Version  string            `json:"version"`  // profile version reported back by agents
+	Hosts    []string          `json:"hosts"`    // host name patterns in path.Match syntax
+	Labels   map[string]string `json:"labels"`   // labels agent must have
+	Settings AgentSettings     `json:"settings"` // settings applied by agents
+}
+
+// AgentSettings - type for agent settings distributed by server.
+// Zero intervals keep intervals of agent, collectors are added to collectors of agent.
+type AgentSettings struct {
+	PollInterval   Duration       `json:"poll_interval"`
+	ReportInterval Duration       `json:"report_interval"`
+	RuntimeMetrics bool           `json:"runtime_metrics"`
+	Exec           []ExecCommand  `json:"exec,omitempty"`
+	Scrape         []ScrapeTarget `json:"scrape,omitempty"`
+}
+
+// ExporterConfig - type for exporter forwarding updates to downstream storage.
+type ExporterConfig struct {
+	Name          string            `json:"name"`                  // name used in self-metrics, type if empty
+	Type          string            `json:"type"`                  // "remote_write" or "influx"
+	URL           string            `json:"url"`                   // endpoint receiving batches
+	Headers       map[string]string `json:"headers" secret:"true"` // extra request headers, e.g. Authorization
+	QueueSize     int               `json:"queue_size"`            // samples buffered before dropping
+	BatchSize     int               `json:"batch_size"`            // maximum samples in single request
+	FlushInterval Duration          `json:"flush_interval"`        // maximum delay of incomplete batch
+	Timeout       Duration          `json:"timeout"`               // request timeout
+	MaxRetries    int               `json:"max_retries"`           // retries of failed batch before dropping, negative disables retries
+	RetryBackoff  Duration          `json:"retry_backoff"`         // initial delay between retries, doubled every retry
+}
+
+// OtlpConfig - type for mapping of OpenTelemetry resource and scope to metrics.
+type OtlpConfig struct {
+	// resource attributes converted to labels, service.name and service.instance.id if empty
+	ResourceLabels []string `json:"resource_labels"`
+	// add instrumentation scope name and version as otel_scope_name and otel_scope_version labels
+	ScopeLabels bool `json:"scope_labels"`
+	// resource or scope attribute which value prefixes metric names, "otel.scope.name" for scope name
+	Prefix string `json:"prefix"`
+	// accept OTLP while key is set, OpenTelemetry exporters do not sign metrics
+	AllowUnsigned bool `json:"allow_unsigned"`
+}
+
+// GraphiteRule - type for rule mapping dotted Graphite path to metric.
+// Pattern is matched segment by segment with path.Match syntax, e.g. "servers.*.cpu.*",
+// Name and label values may reference path segments as $1, $2...
+type GraphiteRule struct {
+	Pattern string            `json:"pattern"` // pattern of dotted path
+	Name    string            `json:"name"`    // metric name template, e.g. "cpu_$4"
+	Labels  map[string]string `json:"labels"`  // label templates, e.g. {"host": "$2"}
+	Type    string            `json:"type"`    // "gauge" (default) or "counter"
+}
+
+// LoadConfigFile - reads config file at path into c, which must be
+// *AgentConfig or *ServerConfig. Format is chosen by file extension:
+// ".yaml" and ".yml" for YAML, ".toml" for TOML and JSON otherwise,
+// JSON allows comments starting with "//". Settings missing in file are
+// left unchanged, errors of all invalid settings are returned together.
+func LoadConfigFile(path string, c interface{}) error {
+	switch c.(type) {
+	case *AgentConfig, *ServerConfig:
+	default:
+		return fmt.Errorf("invalid config type %T", c)
+	}
+
+	raw, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if errs := decodeFile(path, raw, reflect.ValueOf(c).Elem()); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Changed - returns names of fields differing in configs a and b of the same struct type.
+func Changed(a, b interface{}) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	var changed []string
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, va.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// Level - returns log level of agent, debug if Debug is set and info otherwise.
+func (c *AgentConfig) Level() zerolog.Level {
+	if c.Debug {
+		return zerolog.DebugLevel
+	}
+	return zerolog.InfoLevel
+}
+
+// Level - returns log level set by LogLevel, debug if Debug is set and info by default.
+func (c *ServerConfig) Level() zerolog.Level {
+	if c.Debug {
+		return zerolog.DebugLevel
+	}
+	if level, err := zerolog.ParseLevel(c.LogLevel); err == nil && c.LogLevel != "" {
+		return level
+	}
+	return zerolog.InfoLevel
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFileExamples(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		c    interface{}
+	}{
+		{"srever cfg", "../../cmd/server/server.cfg", &ServerConfig{}},
+		{"agent cfg", "../../cmd/agent/agent.cfg", &AgentConfig{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := LoadConfigFile(tt.path, tt.c); err != nil {
+				t.Errorf("LoadConfigFile() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.cfg")
+	if err := os.WriteFile(invalid, []byte(`{"address": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		c    interface{}
+	}{
+		{"missing file", filepath.Join(dir, "missing.cfg"), &ServerConfig{}},
+		{"invalid json", invalid, &ServerConfig{}},
+		{"config by value", "../../cmd/server/server.cfg", ServerConfig{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := LoadConfigFile(tt.path, tt.c); err == nil {
+				t.Error("error expected")
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	a := ServerConfig{Address: "localhost:8080", Key: "old", StaleAfter: Duration{time.Minute}}
+	b := a
+	if got := Changed(a, b); len(got) != 0 {
+		t.Errorf("Changed() = %v, want none", got)
+	}
+
+	b.Key = "new"
+	b.StaleAfter = Duration{time.Hour}
+	b.AllowedAgents = []string{"a"}
+	want := []string{"Key", "AllowedAgents", "StaleAfter"}
+	if got := Changed(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Changed() = %v, want %v", got, want)
+	}
+}
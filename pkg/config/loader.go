@@ -0,0 +1,351 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Errors - list of configuration errors, reported together.
+type Errors []error
+
+// Error - implements error interface.
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Loader - loads configuration from layered sources with precedence
+// defaults < config file < environment < flags, then validates it.
+// Sources of every setting are declared with tags of config struct fields:
+// "default", "json" for config file, "env" and "flag" with comma separated
+// flag names. Fields tagged secret:"true" are redacted by Print.
+type Loader struct {
+	fs    *flag.FlagSet
+	typ   reflect.Type
+	flags map[int]*flagValue
+	path  string
+	print bool
+}
+
+// NewLoader - creates loader of configs of the same type as cfg, pointer to
+// config struct, and registers flags of its fields in fs, including
+// "c" and "config" for config file path and "print-config".
+func NewLoader(fs *flag.FlagSet, cfg interface{}) *Loader {
+	l := &Loader{
+		fs:    fs,
+		typ:   reflect.TypeOf(cfg).Elem(),
+		flags: make(map[int]*flagValue),
+	}
+	fs.StringVar(&l.path, "config", "", "path to config file, format by extension: .json, .yaml, .yml or .toml")
+	fs.StringVar(&l.path, "c", "", "path to config file")
+	fs.BoolVar(&l.print, "print-config", false, "print effective config with secrets redacted and exit")
+
+	for i := 0; i < l.typ.NumField(); i++ {
+		field := l.typ.Field(i)
+		names := field.Tag.Get("flag")
+		if names == "" {
+			continue
+		}
+		fv := &flagValue{
+			value:  field.Tag.Get("default"),
+			isBool: field.Type.Kind() == reflect.Bool,
+		}
+		for _, name := range strings.Split(names, ",") {
+			fs.Var(fv, name, field.Tag.Get("usage"))
+		}
+		l.flags[i] = fv
+	}
+	return l
+}
+
+// Parse - parses command line arguments without program name.
+func (l *Loader) Parse(args []string) error {
+	return l.fs.Parse(args)
+}
+
+// PrintConfig - reports whether effective config is requested with "print-config" flag.
+func (l *Loader) PrintConfig() bool {
+	return l.print
+}
+
+// Load - fills cfg, pointer to config struct, from all sources and validates it.
+// Errors of all sources and validation are returned together as Errors.
+func (l *Loader) Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Type() != l.typ {
+		return fmt.Errorf("invalid config type %T", cfg)
+	}
+	v = v.Elem()
+	v.Set(reflect.Zero(l.typ))
+
+	var errs Errors
+	if err := SetDefaults(cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	if l.path != "" {
+		raw, err := readFile(l.path)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			errs = append(errs, decodeFile(l.path, raw, v)...)
+		}
+	}
+
+	for i := 0; i < l.typ.NumField(); i++ {
+		name := l.typ.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if value := os.Getenv(name); value != "" {
+			if err := setString(v.Field(i), value); err != nil {
+				errs = append(errs, fmt.Errorf("env %s: %w", name, err))
+			}
+		}
+	}
+
+	for i := 0; i < l.typ.NumField(); i++ {
+		fv, ok := l.flags[i]
+		if !ok || !fv.set {
+			continue
+		}
+		if err := setString(v.Field(i), fv.value); err != nil {
+			name := strings.Split(l.typ.Field(i).Tag.Get("flag"), ",")[0]
+			errs = append(errs, fmt.Errorf("flag -%s: %w", name, err))
+		}
+	}
+
+	if vd, ok := cfg.(interface{ Validate() error }); ok {
+		if err := vd.Validate(); err != nil {
+			if list, ok := err.(Errors); ok {
+				errs = append(errs, list...)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SetDefaults - sets fields of cfg, pointer to config struct, to values of their default tags.
+func SetDefaults(cfg interface{}) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if err := setString(v.Field(i), def); err != nil {
+				return fmt.Errorf("default of %s: %w", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// flagValue - flag.Value keeping raw flag value until config is loaded.
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	return f.value
+}
+
+func (f *flagValue) Set(s string) error {
+	f.value = s
+	f.set = true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// setString sets field from string value of environment variable, flag or default.
+// Slices of strings are comma separated.
+func setString(field reflect.Value, s string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items).Convert(field.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// readFile reads top level settings of config file as JSON values.
+func readFile(path string) (map[string]json.RawMessage, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &m)
+	case ".toml":
+		err = toml.Unmarshal(b, &m)
+	default:
+		raw := make(map[string]json.RawMessage)
+		if err = json.Unmarshal(stripComments(b), &raw); err != nil {
+			return nil, fmt.Errorf("%s: decoding json failed: %w", path, err)
+		}
+		return raw, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	raw := make(map[string]json.RawMessage, len(m))
+	for k, v := range m {
+		if raw[k], err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, k, err)
+		}
+	}
+	return raw, nil
+}
+
+// decodeFile sets fields of config v from settings raw read from file path.
+// Every setting is decoded separately, so all invalid and unknown settings are reported.
+func decodeFile(path string, raw map[string]json.RawMessage, v reflect.Value) Errors {
+	fields := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		if name := jsonName(v.Type().Field(i)); name != "" {
+			fields[name] = i
+		}
+	}
+
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs Errors
+	for _, k := range keys {
+		i, ok := fields[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, k))
+			continue
+		}
+		if err := decodeJSON(v.Field(i), raw[k]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, k, err))
+		}
+	}
+	return errs
+}
+
+// decodeJSON sets field from JSON value, time.Duration accepts "10s" strings and nanoseconds.
+func decodeJSON(field reflect.Value, b json.RawMessage) error {
+	if field.Type() != durationType {
+		return json.Unmarshal(b, field.Addr().Interface())
+	}
+	var d Duration
+	if err := d.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	field.SetInt(int64(d.Duration))
+	return nil
+}
+
+// stripComments removes comments starting with "//" outside of JSON strings.
+func stripComments(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	inString, escaped := false, false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(b) && b[i+1] == '/':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			if i < len(b) {
+				out = append(out, '\n')
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
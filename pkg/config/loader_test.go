@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newLoader(t *testing.T, cfg interface{}, args ...string) *Loader {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	l := NewLoader(fs, cfg)
+	if err := l.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLoaderPrecedence(t *testing.T) {
+	path := writeFile(t, "agent.cfg", `{
+    "address": "file:8080", // comment with "quotes" and {brackets}
+    "report_interval": "20s",
+    "poll_interval": 3000000000,
+    "key": "file//key",
+    "labels": {"dc": "eu"}
+}`)
+	t.Setenv("REPORT_INTERVAL", "30s")
+	t.Setenv("KEY", "env-key")
+
+	cfg := AgentConfig{}
+	l := newLoader(t, &cfg, "-c", path, "-k", "flag-key", "-b")
+	if err := l.Load(&cfg); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := AgentConfig{
+		Address:      "file:8080",
+		Key:          "flag-key",
+		ReportInt:    30 * time.Second,
+		PollInt:      3 * time.Second,
+		IsBulk:       true,
+		Labels:       map[string]string{"dc": "eu"},
+		GrpcAddress:  ":9090",
+		HeartbeatInt: Duration{30 * time.Second},
+		ConfigInt:    Duration{time.Minute},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("Load() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoaderFormats(t *testing.T) {
+	files := map[string]string{
+		"server.json": `{"address": ":8081", "store_interval": "5s", "restore": false,
+			"allowed_agents": ["a", "b"], "agent_hints": {"poll_interval": "1s"}}`,
+		"server.yaml": `
+address: ":8081"
+store_interval: 5s
+restore: false
+allowed_agents: [a, b]
+agent_hints:
+  poll_interval: 1s
+`,
+		"server.toml": `
+address = ":8081"
+store_interval = "5s"
+restore = false
+allowed_agents = ["a", "b"]
+
+[agent_hints]
+poll_interval = "1s"
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := ServerConfig{}
+			l := newLoader(t, &cfg, "-config", writeFile(t, name, content))
+			if err := l.Load(&cfg); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Address != ":8081" || cfg.Interval != 5*time.Second || cfg.Restore ||
+				!reflect.DeepEqual(cfg.AllowedAgents, []string{"a", "b"}) ||
+				cfg.AgentHints.PollInterval.Duration != time.Second {
+				t.Errorf("Load() = %+v", cfg)
+			}
+			if cfg.Shutdown != 5*time.Second || cfg.FilePath != "/tmp/devops-metrics-db.json" {
+				t.Errorf("defaults are not applied: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	path := writeFile(t, "server.cfg", `{"store_interval": "soon", "unknown": 1, "restore": "yes"}`)
+	t.Setenv("GRAPHITE_RATE", "fast")
+
+	cfg := ServerConfig{}
+	l := newLoader(t, &cfg, "-c", path, "-a", "localhost", "-t", "10.0.0.0", "-stale-after", "0s")
+	err := l.Load(&cfg)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Load() error = %v, want Errors", err)
+	}
+
+	for _, want := range []string{"store_interval", `unknown setting "unknown"`, "restore", "GRAPHITE_RATE",
+		"invalid address", "invalid trusted_subnet", "invalid stale_after"} {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("Load() error = %v, want error containing %q", errs, want)
+		}
+	}
+	if len(errs) != 7 {
+		t.Errorf("Load() reported %d errors, want 7: %v", len(errs), errs)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := ServerConfig{
+		Address:  "localhost:8080",
+		Key:      "secret",
+		Interval: time.Second,
+		Federate: []FederateSource{{Name: "eu", Key: "eu-secret"}},
+		Exporters: []ExporterConfig{
+			{Type: "influx", URL: "http://influx?a=1&b=2", Headers: map[string]string{"Authorization": "token"}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Print(&buf, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"secret", "eu-secret", "token"} {
+		if strings.Contains(out, `"`+secret+`"`) {
+			t.Errorf("Print() leaks %q: %s", secret, out)
+		}
+	}
+	if cfg.Key != "secret" || cfg.Federate[0].Key != "eu-secret" || cfg.Exporters[0].Headers["Authorization"] != "token" {
+		t.Error("Print() changed config")
+	}
+
+	// printed config is valid config file
+	printed := ServerConfig{}
+	if err := json.Unmarshal(buf.Bytes(), &map[string]interface{}{}); err != nil {
+		t.Fatalf("Print() output is not JSON: %v\n%s", err, out)
+	}
+	if err := LoadConfigFile(writeFile(t, "printed.cfg", out), &printed); err != nil {
+		t.Fatalf("LoadConfigFile() error = %v", err)
+	}
+	if printed.Key != Redacted || printed.Interval != time.Second || printed.Exporters[0].URL != cfg.Exporters[0].URL {
+		t.Errorf("printed config = %+v", printed)
+	}
+}
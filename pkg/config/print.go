@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Redacted - value printed instead of secret settings.
+const Redacted = "REDACTED"
+
+// Print - writes cfg, pointer to config struct, to w as JSON config file
+// with settings in declaration order. Non-empty settings tagged secret:"true"
+// are replaced with Redacted, including settings of nested structs.
+func Print(w io.Writer, cfg interface{}) error {
+	v := redact(reflect.ValueOf(cfg).Elem())
+	t := v.Type()
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	sep := "\n"
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		value := v.Field(i).Interface()
+		if v.Field(i).Type() == durationType {
+			value = time.Duration(v.Field(i).Int()).String()
+		}
+
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("    ", "    ")
+		if err := enc.Encode(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintf(&buf, "%s    %q: %s", sep, name, bytes.TrimSpace(b.Bytes()))
+		sep = ",\n"
+	}
+	buf.WriteString("\n}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// redact returns copy of v with secrets replaced, slices are copied so v is not changed.
+func redact(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" {
+				c.Field(i).Set(mask(v.Field(i)))
+			} else {
+				c.Field(i).Set(redact(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(redact(v.Index(i)))
+		}
+		return c
+	}
+	return v
+}
+
+// mask replaces non-empty string or values of map of strings with Redacted.
+func mask(v reflect.Value) reflect.Value {
+	switch {
+	case v.Kind() == reflect.String && v.Len() > 0:
+		return reflect.ValueOf(Redacted).Convert(v.Type())
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.String && v.Len() > 0:
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), reflect.ValueOf(Redacted).Convert(v.Type().Elem()))
+		}
+		return c
+	}
+	return v
+}
+
+// jsonName returns name of field in config file, empty for fields not in file.
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Validate - implements validation of loaded agent config, all invalid settings are reported.
+func (c *AgentConfig) Validate() error {
+	var errs Errors
+	errs.address("address", c.Address)
+	errs.positive("report_interval", c.ReportInt)
+	errs.positive("poll_interval", c.PollInt)
+	errs.positive("heartbeat_interval", c.HeartbeatInt.Duration)
+	errs.positive("config_interval", c.ConfigInt.Duration)
+	if c.Grpc {
+		errs.address("grpc_address", c.GrpcAddress)
+	}
+	errs.subnet("relay_trusted_subnet", c.RelaySubnet)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate - implements validation of loaded server config, all invalid settings are reported.
+func (c *ServerConfig) Validate() error {
+	var errs Errors
+	errs.address("address", c.Address)
+	if c.Dsn == "" && c.FilePath != "" {
+		errs.positive("store_interval", c.Interval)
+	}
+	if c.Shutdown < 0 {
+		errs.add("shutdown_timeout", "must not be negative")
+	}
+	errs.subnet("trusted_subnet", c.Subnet)
+	if c.LogLevel != "" {
+		if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+			errs.add("log_level", err.Error())
+		}
+	}
+	if c.GraphiteRate < 0 {
+		errs.add("graphite_rate", "must not be negative")
+	}
+	if c.GroupTTL.Duration < 0 {
+		errs.add("group_ttl", "must not be negative")
+	}
+	errs.positive("janitor_interval", c.JanitorInterval.Duration)
+	errs.positive("stale_after", c.StaleAfter.Duration)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (e *Errors) add(name, msg string) {
+	*e = append(*e, fmt.Errorf("invalid %s: %s", name, msg))
+}
+
+func (e *Errors) address(name, addr string) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		e.add(name, err.Error())
+	}
+}
+
+func (e *Errors) positive(name string, d time.Duration) {
+	if d <= 0 {
+		e.add(name, fmt.Sprintf("%v, must be positive", d))
+	}
+}
+
+func (e *Errors) subnet(name, cidr string) {
+	if cidr == "" {
+		return
+	}
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		e.add(name, err.Error())
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/storage/filestore"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// reloadable - settings applied on reload, changes of other settings require restart.
+var reloadable = map[string]bool{
+	"Key":           true,
+	"CryptoKey":     true,
+	"Subnet":        true,
+	"Interval":      true,
+	"FilePath":      true,
+	"Debug":         true,
+	"LogLevel":      true,
+	"AllowedAgents": true,
+	"RejectUnknown": true,
+	"AgentHints":    true,
+	"AgentProfiles": true,
+}
+
+// reloadResult - names of settings changed on reload.
+type reloadResult struct {
+	applied []string // settings applied at runtime
+	skipped []string // settings which take effect after restart
+}
+
+// handlerSwitch - HTTP handler replaced on reload.
+type handlerSwitch struct {
+	v atomic.Value
+}
+
+// Set - replaces handler.
+func (h *handlerSwitch) Set(handler http.Handler) {
+	h.v.Store(handler)
+}
+
+// ServeHTTP - serves request with the current handler.
+func (h *handlerSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.v.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// store stores metrics to the current file storage, if used.
+func (srv *Server) store() error {
+	srv.mu.Lock()
+	f := srv.f
+	srv.mu.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f.Store(srv.repo)
+}
+
+// watchReload reloads configuration on every SIGHUP until ctx is done.
+func (srv *Server) watchReload(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			log.Info().Msg("reloading configuration")
+			res, err := srv.reload()
+			if err != nil {
+				log.Error().AnErr("reload", err).Msg("configuration is not changed")
+				continue
+			}
+			log.Info().Strs("applied", res.applied).Strs("skipped", res.skipped).Msg("configuration reloaded")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload re-reads config file and environment and applies changed settings
+// which can change at runtime: log level, HMAC key, crypto key, trusted subnet,
+// store interval and file path, agent allow-list, hints and profiles.
+// Changes of other settings are skipped and take effect after restart.
+// Nothing is applied if any of new settings is invalid.
+func (srv *Server) reload() (reloadResult, error) {
+	var res reloadResult
+	newCfg, err := srv.load()
+	if err != nil {
+		return res, err
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	// settings to apply are copied to the current config one by one
+	old := srv.cfg
+	next := old
+	for _, name := range config.Changed(old, newCfg) {
+		live := reloadable[name]
+		if (name == "Interval" || name == "FilePath") && srv.f == nil {
+			// storage backend is chosen on start
+			live = false
+		}
+		if !live {
+			log.Warn().Str("setting", name).Msg("setting cannot change at runtime, restart required")
+			res.skipped = append(res.skipped, name)
+			continue
+		}
+		reflect.ValueOf(&next).Elem().FieldByName(name).Set(reflect.ValueOf(newCfg).FieldByName(name))
+		res.applied = append(res.applied, name)
+	}
+
+	var decr encrypt.Decrypter
+	if next.CryptoKey != "" && next.CryptoKey != old.CryptoKey {
+		if decr, err = encrypt.Load(next.CryptoKey); err != nil {
+			return reloadResult{}, fmt.Errorf("invalid crypto key: %w", err)
+		}
+	}
+	var subnet *net.IPNet
+	if next.Subnet != "" {
+		if _, subnet, err = net.ParseCIDR(next.Subnet); err != nil {
+			return reloadResult{}, fmt.Errorf("invalid trusted subnet: %w", err)
+		}
+	}
+	if srv.f != nil && next.Interval <= 0 {
+		return reloadResult{}, fmt.Errorf("invalid store interval: %v", next.Interval)
+	}
+	if srv.f != nil && next.FilePath == "" {
+		return reloadResult{}, fmt.Errorf("empty file path while file storage is used")
+	}
+
+	zerolog.SetGlobalLevel(next.Level())
+
+	if next.Key != old.Key || next.Debug != old.Debug {
+		srv.key = nil
+		if next.Key != "" {
+			srv.key = []byte(next.Key)
+		}
+		srv.handler.Set(srv.router(next, srv.key))
+		if srv.metricsRPC != nil {
+			srv.metricsRPC.SetKey(srv.key)
+			srv.agentsRPC.SetKey(srv.key)
+			srv.federationRPC.SetKey(srv.key)
+		}
+	}
+
+	if next.CryptoKey != old.CryptoKey {
+		srv.decr.Set(decr)
+	}
+
+	srv.subnet = subnet
+
+	if srv.storeTicker != nil && next.Interval != old.Interval {
+		srv.storeTicker.Reset(next.Interval)
+	}
+	if srv.f != nil && next.FilePath != old.FilePath {
+		srv.f = filestore.NewFileStorage(next.FilePath)
+		if err := srv.f.Store(srv.repo); err != nil {
+			log.Error().AnErr("Store", err).Msg("reload")
+		}
+	}
+
+	srv.agents.SetAllowList(next.AllowedAgents, next.RejectUnknown)
+	srv.agents.SetHints(next.AgentHints)
+	if !reflect.DeepEqual(next.AgentProfiles, old.AgentProfiles) {
+		srv.profiles.Set(next.AgentProfiles)
+	}
+
+	srv.cfg = next
+	return res, nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+// reloadServer creates server with key "a" storing metrics to file, reloading
+// configuration from JSON file returned with the server.
+func reloadServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.ServerConfig{}
+	require.NoError(t, config.SetDefaults(&cfg))
+	cfg.Key, cfg.FilePath, cfg.Interval = "a", filepath.Join(dir, "metrics.json"), time.Hour
+
+	path := filepath.Join(dir, "config.json")
+	load := func() (config.ServerConfig, error) {
+		c := cfg
+		err := config.LoadConfigFile(path, &c)
+		return c, err
+	}
+	srv, err := New(WithConfig(cfg), WithReload(load))
+	require.NoError(t, err)
+	// ticker is created by Run
+	srv.storeTicker = time.NewTicker(time.Hour)
+	t.Cleanup(srv.storeTicker.Stop)
+	return srv, path
+}
+
+// updateStatus returns status of counter update signed with key served by current handler of srv,
+// request body is encrypted with enc if set.
+func updateStatus(t *testing.T, srv *Server, key string, enc encrypt.Encrypter) int {
+	t.Helper()
+	body := []byte(`{"id":"PollCount","type":"counter","delta":1,"hash":"` + hash.Create("PollCount:counter:1", []byte(key)) + `"}`)
+	if enc != nil {
+		var err error
+		body, err = enc.Encrypt(body)
+		require.NoError(t, err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.s.Handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+// writeKeys writes RSA key pair to dir, returns paths of private and public keys.
+func writeKeys(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	privPath, pubPath := filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privPath,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}), 0600))
+	require.NoError(t, os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0600))
+	return privPath, pubPath
+}
+
+func TestReload(t *testing.T) {
+	srv, path := reloadServer(t)
+	dir := filepath.Dir(path)
+	privPath, pubPath := writeKeys(t, dir)
+	storePath := filepath.Join(dir, "moved.json")
+	writeConfig(t, path, fmt.Sprintf(`{"key":"b","crypto_key":%q,"store_interval":"10ms","store_file":%q}`,
+		privPath, storePath))
+
+	res, err := srv.reload()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Key", "CryptoKey", "Interval", "FilePath"}, res.applied)
+	assert.Empty(t, res.skipped)
+	assert.Equal(t, "b", srv.cfg.Key)
+
+	// handler is rebuilt with the new key and decrypts requests with the new crypto key
+	enc, err := encrypt.Load(pubPath)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, updateStatus(t, srv, "b", enc))
+	assert.Equal(t, http.StatusBadRequest, updateStatus(t, srv, "a", enc))
+	assert.Equal(t, http.StatusInternalServerError, updateStatus(t, srv, "b", nil))
+
+	// store ticker is reset and metrics are stored to the new file
+	select {
+	case <-srv.storeTicker.C:
+	case <-time.After(time.Second):
+		t.Error("store ticker is not reset")
+	}
+	_, err = os.Stat(storePath)
+	assert.NoError(t, err)
+}
+
+func TestReloadSkipped(t *testing.T) {
+	srv, path := reloadServer(t)
+	writeConfig(t, path, `{"address":"localhost:9999","key":"b"}`)
+
+	res, err := srv.reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Key"}, res.applied)
+	assert.Equal(t, []string{"Address"}, res.skipped)
+	assert.Equal(t, "localhost:8080", srv.cfg.Address)
+	assert.Equal(t, "b", srv.cfg.Key)
+}
+
+func TestReloadInvalid(t *testing.T) {
+	srv, path := reloadServer(t)
+	for _, tt := range []struct {
+		name   string
+		config string
+	}{
+		{"invalid file", `{"key":`},
+		{"missing crypto key", `{"key":"b","crypto_key":"/nonexistent/key.pem"}`},
+		{"invalid subnet", `{"key":"b","trusted_subnet":"invalid"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, path, tt.config)
+			_, err := srv.reload()
+			require.Error(t, err)
+			assert.Equal(t, "a", srv.cfg.Key)
+			assert.Equal(t, http.StatusOK, updateStatus(t, srv, "a", nil))
+			assert.Equal(t, http.StatusBadRequest, updateStatus(t, srv, "b", nil))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const selfMetricsInterval = 10 * time.Second
+
+// selfMetricsSource - server component reporting its health as gauges.
+type selfMetricsSource interface {
+	Gauges() map[string]float64
+}
+
+// reportSelfMetrics - periodically stores gauges of all sources into repository.
+func (srv *Server) reportSelfMetrics(ctx context.Context) {
+	if len(srv.selfMetrics) == 0 {
+		return
+	}
+	ticker := time.NewTicker(selfMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, src := range srv.selfMetrics {
+				for id, v := range src.Gauges() {
+					if err := srv.repo.UpdateGauge(ctx, id, v); err != nil {
+						log.Error().AnErr("UpdateGauge", err).Str("metric", id).Msg("reportSelfMetrics")
+					}
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
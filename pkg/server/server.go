@@ -0,0 +1,383 @@
+// Package server implements server for collecting metrics from agent cleints.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+	colpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/andrei-cloud/go-devops/internal/admin"
+	"github.com/andrei-cloud/go-devops/internal/encrypt"
+	"github.com/andrei-cloud/go-devops/internal/export"
+	"github.com/andrei-cloud/go-devops/internal/federate"
+	"github.com/andrei-cloud/go-devops/internal/graphite"
+	"github.com/andrei-cloud/go-devops/internal/groups"
+	"github.com/andrei-cloud/go-devops/internal/interceptors"
+	"github.com/andrei-cloud/go-devops/internal/otlp"
+	"github.com/andrei-cloud/go-devops/internal/profiles"
+	"github.com/andrei-cloud/go-devops/internal/registry"
+	"github.com/andrei-cloud/go-devops/internal/repo"
+	"github.com/andrei-cloud/go-devops/internal/router"
+	"github.com/andrei-cloud/go-devops/internal/rpc"
+	"github.com/andrei-cloud/go-devops/internal/storage/filestore"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/internal/storage/persistent"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+
+	pb "github.com/andrei-cloud/go-devops/internal/proto"
+)
+
+// Server - metrics server, created with New.
+type Server struct {
+	s       *http.Server
+	handler handlerSwitch
+	g       *grpc.Server
+	gl      net.Listener
+	gr      *graphite.Listener
+	grl     net.Listener
+	repo    repo.Repository
+	decr    *encrypt.Holder
+
+	// settings changed on reload
+	load        func() (config.ServerConfig, error)
+	mu          sync.Mutex
+	cfg         config.ServerConfig
+	f           filestore.Filestore
+	key         []byte
+	subnet      *net.IPNet
+	storeTicker *time.Ticker
+
+	receiver      *otlp.Receiver
+	metricsRPC    *rpc.MetricsServer
+	agentsRPC     *rpc.AgentsServer
+	federationRPC *rpc.FederationServer
+
+	exporters   *export.Manager
+	janitor     *groups.Janitor
+	agents      *registry.Registry
+	profiles    *profiles.Store
+	journal     *federate.Journal
+	pullers     []*federate.Puller
+	admin       *admin.Service
+	audit       *admin.AuditLog
+	selfMetrics []selfMetricsSource
+}
+
+// Option - configures server created with New.
+type Option func(*Server)
+
+// WithConfig - sets server configuration, default configuration is used otherwise.
+func WithConfig(cfg config.ServerConfig) Option {
+	return func(srv *Server) {
+		srv.cfg = cfg
+	}
+}
+
+// WithReload - enables reload of configuration on SIGHUP, load provides new configuration.
+func WithReload(load func() (config.ServerConfig, error)) Option {
+	return func(srv *Server) {
+		srv.load = load
+	}
+}
+
+// New - creates new server instance with all injected dependencies.
+func New(opts ...Option) (*Server, error) {
+	var err error
+
+	srv := &Server{}
+	if err := config.SetDefaults(&srv.cfg); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	cfg := srv.cfg
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	srv.repo = inmem.New()
+
+	if cfg.Key != "" {
+		srv.key = []byte(cfg.Key)
+	}
+
+	if cfg.Dsn != "" {
+		log.Debug().Msg("Database is used as Storage")
+		srv.repo = persistent.NewDB(cfg.Dsn)
+		if srv.repo == nil {
+			return nil, fmt.Errorf("failed to connect to DB")
+		}
+	} else if cfg.FilePath != "" {
+		log.Debug().Msg("Faile is used as Storage")
+		srv.f = filestore.NewFileStorage(cfg.FilePath)
+		// metrics are restored before decorators are applied,
+		// so they are not exported or journaled as new updates
+		if cfg.Restore {
+			if err := srv.f.Restore(srv.repo); err != nil {
+				log.Error().AnErr("Restore", err).Msg("New")
+			}
+		}
+	}
+
+	if len(cfg.Exporters) > 0 {
+		srv.exporters, err = export.NewManager(cfg.Exporters)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exporters configuration: %w", err)
+		}
+		srv.repo = export.Repository(srv.repo, srv.exporters)
+		srv.selfMetrics = append(srv.selfMetrics, srv.exporters)
+	}
+
+	srv.agents = registry.New(cfg.StaleAfter.Duration)
+	srv.agents.SetAllowList(cfg.AllowedAgents, cfg.RejectUnknown)
+	srv.agents.SetHints(cfg.AgentHints)
+	srv.profiles = profiles.New(cfg.AgentProfiles)
+	srv.repo = registry.Repository(srv.repo, srv.agents)
+
+	srv.journal = federate.NewJournal()
+	srv.repo = federate.Repository(srv.repo, srv.journal)
+	for _, src := range cfg.Federate {
+		srv.pullers = append(srv.pullers, federate.NewPuller(src, srv.repo))
+	}
+
+	srv.janitor = groups.NewJanitor(srv.repo, cfg.JanitorInterval.Duration)
+	srv.selfMetrics = append(srv.selfMetrics, srv.janitor)
+
+	// admin endpoints are available only with admin key
+	if cfg.AdminKey != "" {
+		srv.audit, err = admin.OpenAuditLog(cfg.AuditLog, admin.DefaultAuditSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		srv.admin = admin.NewService(srv.repo, []byte(cfg.AdminKey), srv.audit)
+	}
+
+	// decrypter is replaced on reload, payload is not decrypted without crypto key
+	srv.decr = encrypt.NewHolder(nil)
+	if cfg.CryptoKey != "" {
+		decr, err := encrypt.Load(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crypto key: %w", err)
+		}
+		srv.decr.Set(decr)
+	}
+
+	_, srv.subnet, err = net.ParseCIDR(cfg.Subnet)
+	if err != nil {
+		log.Error().AnErr("ParseCIDR", err).Msg("NewServer")
+		srv.subnet = nil
+	}
+
+	srv.receiver = otlp.NewReceiver(srv.repo, otlp.NewTranslator(cfg.Otlp))
+	srv.handler.Set(srv.router(cfg, srv.key))
+
+	srv.s = &http.Server{
+		Addr:           cfg.Address,
+		Handler:        &srv.handler,
+		ReadTimeout:    60 * time.Second,
+		WriteTimeout:   60 * time.Second,
+		IdleTimeout:    30 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+
+	if cfg.Grpc {
+		srv.gl, err = net.Listen("tcp", cfg.GrpcAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen port %s: %w", cfg.GrpcAddress, err)
+		}
+
+		// codec is set even without crypto key, so the key can be set on reload;
+		// OTLP exporters do not encrypt requests
+		codec := encrypt.ServerCodec{
+			Dec:   srv.decr,
+			Plain: []protoreflect.FullName{proto.MessageName(&colpb.ExportMetricsServiceRequest{})},
+		}
+		srv.g = grpc.NewServer(grpc.ForceServerCodec(codec),
+			grpc.ChainUnaryInterceptor(interceptors.CheckSubnet(srv.trustedSubnet), interceptors.SourceInject),
+			grpc.ChainStreamInterceptor(interceptors.CheckSubnetStream(srv.trustedSubnet)))
+		srv.metricsRPC = rpc.NewMetricsServer(srv.repo, srv.key)
+		srv.agentsRPC = rpc.NewAgentsServer(srv.agents, srv.profiles, srv.key)
+		srv.federationRPC = rpc.NewFederationServer(srv.repo, srv.journal, srv.key)
+		pb.RegisterMetricsServer(srv.g, srv.metricsRPC)
+		pb.RegisterAgentsServer(srv.g, srv.agentsRPC)
+		pb.RegisterFederationServer(srv.g, srv.federationRPC)
+		if srv.admin != nil {
+			pb.RegisterAdminServer(srv.g, rpc.NewAdminServer(srv.admin, srv.agents))
+		}
+		colpb.RegisterMetricsServiceServer(srv.g, otlp.Guard(srv.receiver, srv.otlpAllowed))
+	}
+
+	if cfg.GraphiteAddress != "" {
+		mapper, err := graphite.NewMapper(cfg.GraphiteRules)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Graphite rules: %w", err)
+		}
+		srv.grl, err = net.Listen("tcp", cfg.GraphiteAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen port %s: %w", cfg.GraphiteAddress, err)
+		}
+		srv.gr = graphite.NewListener(srv.repo, mapper, cfg.GraphiteRate)
+	}
+
+	return srv, nil
+}
+
+// router builds HTTP router of settings cfg validating hashes with key.
+func (srv *Server) router(cfg config.ServerConfig, key []byte) *chi.Mux {
+	r := router.SetupRouter(srv.repo, key, srv.decr)
+	// OTLP metrics are not signed, so they are accepted with key only if explicitly allowed
+	if len(key) == 0 || cfg.Otlp.AllowUnsigned {
+		r = router.WithOTLP(r, srv.receiver, srv.trustedSubnet)
+	}
+	r = router.WithGroups(r, srv.repo, key, srv.decr, cfg.GroupTTL.Duration)
+	r = router.WithFederation(r, srv.repo, srv.journal, key)
+	r = router.WithAgents(r, srv.agents, srv.profiles, key, srv.decr)
+	if srv.admin != nil {
+		r = router.WithAdmin(r, srv.admin, srv.agents, srv.decr)
+	}
+
+	if cfg.Debug {
+		r = router.WithPPROF(r)
+	}
+	return r
+}
+
+// otlpAllowed reports whether unsigned OTLP metrics are accepted with the current key.
+func (srv *Server) otlpAllowed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return len(srv.key) == 0 || srv.cfg.Otlp.AllowUnsigned
+}
+
+// trustedSubnet returns the current trusted subnet, nil allows any address.
+func (srv *Server) trustedSubnet() *net.IPNet {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.subnet
+}
+
+// Run - non blocking function starting up the server.
+func (srv *Server) Run(ctx context.Context) {
+	srv.mu.Lock()
+	cfg := srv.cfg
+	srv.mu.Unlock()
+
+	if srv.exporters != nil {
+		srv.exporters.Run()
+	}
+
+	if cfg.Dsn == "" && cfg.FilePath != "" {
+		// ticker is reset on reload
+		srv.mu.Lock()
+		srv.storeTicker = time.NewTicker(cfg.Interval)
+		storeTicker := srv.storeTicker
+		srv.mu.Unlock()
+
+		go func(ctx context.Context) {
+			for {
+				select {
+				case <-storeTicker.C:
+					if err := srv.store(); err != nil {
+						log.Error().AnErr("Store", err).Msg("Run")
+					}
+				case <-ctx.Done():
+					storeTicker.Stop()
+					return
+				}
+			}
+		}(ctx)
+	}
+
+	if srv.load != nil {
+		go srv.watchReload(ctx)
+	}
+
+	go srv.reportSelfMetrics(ctx)
+	go srv.janitor.Run(ctx)
+
+	for _, p := range srv.pullers {
+		go p.Run(ctx)
+	}
+
+	log.Info().Msgf("HTTP server listening on: %v", cfg.Address)
+	go srv.s.ListenAndServe()
+
+	if cfg.Grpc && srv.gl != nil {
+		log.Info().Msgf("gRPC server listening on: %v", srv.gl.Addr())
+		go srv.g.Serve(srv.gl)
+	}
+
+	if srv.gr != nil {
+		log.Info().Msgf("Graphite listener listening on: %v", srv.grl.Addr())
+		go func() {
+			if err := srv.gr.Serve(srv.grl); err != nil {
+				log.Error().AnErr("Serve", err).Msg("Graphite")
+			}
+		}()
+	}
+}
+
+// Shutdown - blocking function waiting signal to shutdown the server
+// signals to shutdown server:
+//
+//	os.Interrupt
+//	syscall.SIGTERM
+//	syscall.SIGQUIT
+//
+// Server will be forcefuly stopped after shutdown Timeout.
+func (srv *Server) Shutdown(ctx context.Context) {
+	<-ctx.Done()
+	srv.mu.Lock()
+	timeout := srv.cfg.Shutdown
+	srv.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.s.Shutdown(ctx); err != nil {
+		log.Error().AnErr("Shutdown", err).Msg("Shutdown")
+	}
+
+	if srv.g != nil {
+		srv.g.GracefulStop()
+		if err := srv.gl.Close(); err != nil {
+			log.Error().AnErr("listener close", err).Msg("Shutdown")
+		}
+	}
+
+	if srv.gr != nil {
+		if err := srv.gr.Shutdown(ctx); err != nil {
+			log.Error().AnErr("Graphite shutdown", err).Msg("Shutdown")
+		}
+	}
+
+	if srv.exporters != nil {
+		srv.exporters.Shutdown(ctx)
+	}
+
+	if err := srv.store(); err != nil {
+		log.Error().AnErr("Store", err).Msg("Shutdown")
+	}
+
+	if srv.repo != nil {
+		if err := srv.repo.Close(); err != nil {
+			log.Error().AnErr("Close", err).Msg("Shutdown")
+		}
+	}
+
+	if srv.audit != nil {
+		if err := srv.audit.Close(); err != nil {
+			log.Error().AnErr("audit log close", err).Msg("Shutdown")
+		}
+	}
+}
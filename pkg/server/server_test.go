@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/go-devops/internal/hash"
+	"github.com/andrei-cloud/go-devops/internal/storage/filestore"
+	"github.com/andrei-cloud/go-devops/internal/storage/inmem"
+	"github.com/andrei-cloud/go-devops/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	newServer := func(key string) *Server {
+		cfg := config.ServerConfig{}
+		if err := config.SetDefaults(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		cfg.FilePath = ""
+		cfg.Key = key
+		srv, err := New(WithConfig(cfg))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return srv
+	}
+
+	// servers of the same process are configured independently
+	a, b := newServer("a"), newServer("b")
+	body := `{"id":"PollCount","type":"counter","delta":1,"hash":"` + hash.Create("PollCount:counter:1", []byte("a")) + `"}`
+	for _, tt := range []struct {
+		name string
+		srv  *Server
+		code int
+	}{
+		{"valid key", a, http.StatusOK},
+		{"other key", b, http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			tt.srv.s.Handler.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+
+	if _, err := b.repo.GetCounter(context.Background(), "PollCount"); err == nil {
+		t.Error("update with wrong key is stored")
+	}
+}
+
+func TestNewGrpc(t *testing.T) {
+	// gRPC servers of the same process listen on their own addresses
+	for i := 0; i < 2; i++ {
+		cfg := config.ServerConfig{}
+		if err := config.SetDefaults(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		cfg.FilePath = ""
+		cfg.Grpc, cfg.GrpcAddress = true, "127.0.0.1:0"
+		srv, err := New(WithConfig(cfg))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		defer srv.gl.Close()
+	}
+}
+
+func TestOTLPAuth(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		key    string
+		allow  bool
+		subnet string
+		code   int
+	}{
+		{"no key", "", false, "", http.StatusOK},
+		{"key", "secret", false, "", http.StatusNotFound},
+		{"key allowed", "secret", true, "", http.StatusOK},
+		{"untrusted subnet", "", false, "10.0.0.0/8", http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServerConfig{}
+			if err := config.SetDefaults(&cfg); err != nil {
+				t.Fatal(err)
+			}
+			cfg.FilePath, cfg.Key, cfg.Subnet = "", tt.key, tt.subnet
+			cfg.Otlp.AllowUnsigned = tt.allow
+			srv, err := New(WithConfig(cfg))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			srv.s.Handler.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			if got := srv.otlpAllowed(); got != (tt.key == "" || tt.allow) {
+				t.Errorf("otlpAllowed() = %v", got)
+			}
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	cfg := config.ServerConfig{Address: "localhost:8080", Subnet: "10.0.0.0", LogLevel: "loud"}
+	_, err := New(WithConfig(cfg))
+	errs, ok := err.(config.Errors)
+	if !ok || len(errs) != 4 {
+		t.Errorf("New() error = %v, want 4 errors", err)
+	}
+}
+
+func TestNewRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	stored := inmem.New()
+	ctx := context.Background()
+	if err := stored.UpdateCounter(ctx, "PollCount", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := filestore.NewFileStorage(path).Store(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.ServerConfig{}
+	if err := config.SetDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.FilePath, cfg.Restore = path, true
+	srv, err := New(WithConfig(cfg))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if v, err := srv.repo.GetCounter(ctx, "PollCount"); err != nil || v != 7 {
+		t.Errorf("PollCount = %v, %v, want 7", v, err)
+	}
+	// restored metrics are not new updates of federation
+	if v := srv.journal.Version(); v != 0 {
+		t.Errorf("journal version = %d, want 0", v)
+	}
+}